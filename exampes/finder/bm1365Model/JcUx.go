@@ -3,10 +3,11 @@ package bm1365Model
 import (
 	"../../../module"
 	"../../../scheduler"
-	"encoding/json"
+	"../../../toolkit/extractor"
+	"../../../toolkit/storage"
+	"fmt"
 	"github.com/360EntSecGroup-Skylar/excelize"
 	"github.com/PuerkitoBio/goquery"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"path/filepath"
@@ -17,6 +18,9 @@ import (
 
 var excelFile *ExcelFile = nil
 
+// 保护excelFile初始化的互斥锁
+var excelInitLock sync.Mutex
+
 type ExcelFile struct {
 	ef     *excelize.File
 	row    int
@@ -42,49 +46,56 @@ type JcUx struct {
 	dom          *goquery.Document
 }
 
+// 初始地址列表接口的抽取规则
+// 列表中的每个元素会生成一个详情页的请求
+var listRuleSet = extractor.JSONRuleSet{
+	Rules: []extractor.JSONRule{
+		{
+			Name:  "bm1365-list",
+			Items: "$.page.list",
+			Follow: []extractor.JSONLinkRule{
+				{Template: "http://www.bml365.com/qy/prod/v/{create_id}-{id}"},
+			},
+		},
+	},
+}
+
 // startPage 从第几页开始
 // pageNum 一共爬多少页
 func InitReqList(startPage int, pageNum int, sched scheduler.Scheduler) {
 	logger.Info("开始拉取初始地址列表")
-	ExcelInit()
+	listExtractor, err := extractor.NewJSON(listRuleSet)
+	if err != nil {
+		logger.Errorf("创建初始地址抽取器发生异常：%s", err)
+		return
+	}
+	parse := listExtractor.ParseResponse()
 	for i := startPage; i < startPage+pageNum; i++ {
 		resp, err := http.PostForm("http://www.bml365.com/show/prod/getpmore/", url.Values{"type": {"0"}, "page": {strconv.Itoa(i)}, "order": {"favorite_desc"}, "city": {"0"}})
 		if err != nil {
 			logger.Errorf("拉取初始地址发生异常：%s", err.Error())
-		} else {
-			body, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				logger.Errorf("初始地址获取body发生异常：%s", err.Error())
-			}
-
-			var f interface{}
-			err = json.Unmarshal(body, &f)
-			if err != nil {
-				logger.Errorf("初始地址body转换json：%s", err.Error())
-			}
-			m := f.(map[string]interface{})
-			p := m["page"].(map[string]interface{})
-			l := p["list"].([]interface{})
-			for _, val := range l {
-				v := val.(map[string]interface{})
-				createId := int64(v["create_id"].(float64))
-				id := int64(v["id"].(float64))
-				url := "http://www.bml365.com/qy/prod/v/" +
-					strconv.FormatInt(createId, 10) + "-" + strconv.FormatInt(id, 10)
-				HTTPReq, err := http.NewRequest("GET", url, nil)
-				if err != nil {
-					logger.Fatal(err)
-					return
-				}
-				req := module.NewRequest(HTTPReq, 0)
+			continue
+		}
+		dataList, errs := parse(resp, 0)
+		resp.Body.Close()
+		for _, err := range errs {
+			logger.Errorf("解析初始地址发生异常：%s", err)
+		}
+		for _, data := range dataList {
+			if req, ok := data.(*module.Request); ok {
 				sched.SendReq(req)
 			}
-			resp.Body.Close()
 		}
 	}
 }
 
-func ExcelInit() {
+// 用于初始化数据表格，重复调用时不会重复初始化
+func ExcelInit() error {
+	excelInitLock.Lock()
+	defer excelInitLock.Unlock()
+	if excelFile != nil {
+		return nil
+	}
 	sheet := "Sheet1"
 	f := excelize.NewFile()
 	// 创建一个工作表
@@ -112,15 +123,50 @@ func ExcelInit() {
 		row:   2,
 		sheet: sheet,
 	}
+	return nil
 }
 
-func SaveExcel(savePath string) {
+// 用于把数据表格保存到给定的存储后端
+func SaveExcel(backend storage.Storage) error {
+	if excelFile == nil {
+		return nil
+	}
+	excelFile.efLook.Lock()
+	defer excelFile.efLook.Unlock()
 	logger.Info("数据存档中...")
-	if excelFile != nil {
-		if err := excelFile.ef.SaveAs(savePath + "/resultInfo.xlsx"); err != nil {
-			logger.Errorf("数据存档失败：%s", err)
-		}
-		logger.Info("数据存档成功！")
+	buf, err := excelFile.ef.WriteToBuffer()
+	if err == nil {
+		err = backend.Put("resultInfo.xlsx", buf)
+	}
+	if err != nil {
+		return fmt.Errorf("数据存档失败：%s", err)
+	}
+	logger.Info("数据存档成功！")
+	return nil
+}
+
+// 用于根据按抽取规则得到的条目创建信息
+// 条目的字段名称与JcUx的字段名称相同
+func newJcUx(item module.Item) JcUx {
+	field := func(name string) string {
+		value, _ := item[name].(string)
+		return value
+	}
+	return JcUx{
+		Scope:        field("Scope"),
+		Price:        field("Price"),
+		Origin:       field("Origin"),
+		Manufacturer: field("Manufacturer"),
+		Category1:    field("Category1"),
+		Category2:    field("Category2"),
+		Category3:    field("Category3"),
+		Agency:       field("Agency"),
+		Phone:        field("Phone"),
+		Address:      field("Address"),
+		Email:        field("Email"),
+		Info:         field("Info"),
+		Images:       field("Images"),
+		Title:        field("Title"),
 	}
 }
 
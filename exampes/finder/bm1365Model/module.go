@@ -5,23 +5,59 @@ import (
 	"../../../module/local/analyzer"
 	"../../../module/local/downloader"
 	"../../../module/local/pipeline"
+	"../../../toolkit/extractor"
+	"../../../toolkit/media"
+	"../../../toolkit/storage"
+	"net/http"
+	"path/filepath"
 )
 
 // 组件序列号生成器
 var snGen = module.NewSNGenertor(1, 0)
 
+// 下载器健康检查时访问的URL
+var healthCheckURL = "http://www.bml365.com/"
+
+// 下载器默认使用的请求头配置
+var headerProfiles = []downloader.HeaderProfile{
+	{
+		Name:           "chrome",
+		UserAgent:      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8",
+		AcceptLanguage: "zh-CN,zh;q=0.9,en;q=0.8",
+	},
+	{
+		Name:           "firefox",
+		UserAgent:      "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:121.0) Gecko/20100101 Firefox/121.0",
+		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		AcceptLanguage: "zh-CN,zh;q=0.8,zh-TW;q=0.7,en-US;q=0.5,en;q=0.3",
+	},
+}
+
 // 用于获取下载器列表
-func GetDownloaders(number uint8) ([]module.Downloader, error) {
+// 参数args中的健康检查URL或请求头配置为空时会使用默认值
+// 参数client为nil时使用新生成的HTTP客户端
+func GetDownloaders(number uint8, client *http.Client, args downloader.Args) ([]module.Downloader, error) {
 	downloaders := []module.Downloader{}
 	if number == 0 {
 		return downloaders, nil
 	}
+	if client == nil {
+		client = GenHTTPClient()
+	}
+	if args.HealthCheckURL == "" {
+		args.HealthCheckURL = healthCheckURL
+	}
+	if len(args.HeaderProfiles) == 0 {
+		args.HeaderProfiles = headerProfiles
+		args.HeaderRotation = downloader.HEADER_ROTATE_PER_HOST
+	}
 	for i := uint8(0); i < number; i++ {
 		mid, err := module.GenMID(module.TYPE_DOWNLOADER, snGen.Get(), nil)
 		if err != nil {
 			return downloaders, err
 		}
-		d, err := downloader.New(mid, genHTTPClient(), module.CalculateScoreSimple)
+		d, err := downloader.NewWithArgs(mid, client, args, module.CalculateScoreSimple)
 		if err != nil {
 			return downloaders, err
 		}
@@ -30,8 +66,16 @@ func GetDownloaders(number uint8) ([]module.Downloader, error) {
 	return downloaders, nil
 }
 
+// 分析器的可选参数
+// 图片等较大的响应体会被转存到临时文件，过大的响应体不会被解析
+var analyzerArgs = analyzer.Args{
+	MaxBodySize:     64 << 20,
+	MemoryThreshold: 4 << 20,
+}
+
 // 用于获取下分析器列表
-func GetAnalyzers(number uint8) ([]module.Analyzer, error) {
+// 参数ext不为nil时，网页会按抽取规则解析
+func GetAnalyzers(number uint8, ext *extractor.Extractor) ([]module.Analyzer, error) {
 	analyzers := []module.Analyzer{}
 	if number == 0 {
 		return analyzers, nil
@@ -41,7 +85,7 @@ func GetAnalyzers(number uint8) ([]module.Analyzer, error) {
 		if err != nil {
 			return analyzers, err
 		}
-		a, err := analyzer.New(mid, genResponseParsers(), module.CalculateScoreSimple)
+		a, err := analyzer.NewWithArgs(mid, genResponseRoutes(ext), analyzerArgs, module.CalculateScoreSimple)
 		if err != nil {
 			return analyzers, err
 		}
@@ -50,23 +94,92 @@ func GetAnalyzers(number uint8) ([]module.Analyzer, error) {
 	return analyzers, nil
 }
 
+// 条目处理管道接收的条目的模式
+// 条目要么是包含bmInfo的信息条目，要么是包含reader、name和ext的图片条目
+// 图片条目中的url和size用于校验图片和从断点继续下载
+var itemSchema = &module.Schema{
+	Name: "bm1365",
+	Fields: []module.Field{
+		{Name: "bmInfo", Type: module.FIELD_TYPE_ANY},
+		{Name: "reader", Type: module.FIELD_TYPE_READER},
+		{Name: "name", Type: module.FIELD_TYPE_STRING},
+		{Name: "ext", Type: module.FIELD_TYPE_STRING},
+		{Name: "url", Type: module.FIELD_TYPE_STRING},
+		{Name: "size", Type: module.FIELD_TYPE_INTEGER},
+	},
+	Strict: true,
+}
+
 // 用于获取条目处理管道列表
-func GetPipelines(number uint8, dirPath string) ([]module.Pipeline, error) {
+// 图片按内容摘要命名存放在存储后端的pictures目录中，数据表格存放在存储后端的根目录中
+// 参数backend为nil时使用以dirPath为根目录的本地存储，dirPath下的.staging目录用于暂存下载中的图片
+// 所有管道共用同一个图片存储
+// 参数client用于重新下载图片，应与下载器共用，为nil时使用新生成的HTTP客户端
+func GetPipelines(number uint8, dirPath string, backend storage.Storage,
+	client *http.Client) ([]module.Pipeline, error) {
 	pipelines := []module.Pipeline{}
 	if number == 0 {
 		return pipelines, nil
 	}
+	if client == nil {
+		client = GenHTTPClient()
+	}
+	var err error
+	if backend == nil {
+		if backend, err = storage.NewLocal(dirPath); err != nil {
+			return pipelines, err
+		}
+	}
+	store, err := media.NewStore(storage.Sub(backend, "pictures"), filepath.Join(dirPath, ".staging"))
+	if err != nil {
+		return pipelines, err
+	}
+	save := func() error {
+		if err := store.Save(); err != nil {
+			return err
+		}
+		return SaveExcel(backend)
+	}
 	for i := uint8(0); i < number; i++ {
 		mid, err := module.GenMID(module.TYPE_PIPELINE, snGen.Get(), nil)
 		if err != nil {
 			return pipelines, err
 		}
-		a, err := pipeline.New(mid, genItemProcessors(dirPath), module.CalculateScoreSimple)
+		hooks := pipeline.Hooks{
+			Open:  ExcelInit,
+			Flush: save,
+			Close: save,
+		}
+		a, err := pipeline.NewWithHooks(mid, genItemProcessors(store, client), hooks, module.CalculateScoreSimple)
 		if err != nil {
 			return pipelines, err
 		}
 		a.SetFailFast(true)
+		if err := a.(module.SchemaHolder).SetSchema(itemSchema); err != nil {
+			return pipelines, err
+		}
 		pipelines = append(pipelines, a)
 	}
 	return pipelines, nil
 }
+
+// 用于获取回放下载器列表
+// 回放下载器不访问网络，只从给定的回放数据源中取出已录制的响应
+func GetReplayers(number uint8, source downloader.ReplaySource) ([]module.Downloader, error) {
+	downloaders := []module.Downloader{}
+	if number == 0 {
+		return downloaders, nil
+	}
+	for i := uint8(0); i < number; i++ {
+		mid, err := module.GenMID(module.TYPE_DOWNLOADER, snGen.Get(), nil)
+		if err != nil {
+			return downloaders, err
+		}
+		d, err := downloader.NewReplayer(mid, source, module.CalculateScoreSimple)
+		if err != nil {
+			return downloaders, err
+		}
+		downloaders = append(downloaders, d)
+	}
+	return downloaders, nil
+}
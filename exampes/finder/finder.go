@@ -2,7 +2,16 @@ package main
 
 import (
 	"../../log"
+	"../../module"
+	"../../module/local/downloader"
 	sched "../../scheduler"
+	"../../toolkit/cookie"
+	"../../toolkit/deadletter"
+	"../../toolkit/extractor"
+	"../../toolkit/proxy"
+	"../../toolkit/recrawl"
+	"../../toolkit/storage"
+	"../../toolkit/warc"
 	"./bm1365Model"
 	lib "./bm1365Model"
 	"./monitor"
@@ -15,12 +24,28 @@ import (
 
 // 命令参数
 var (
-	firstURL  string
-	domains   string
-	depth     uint
-	dirPath   string
-	startPage int
-	pageNum   int
+	firstURL    string
+	domains     string
+	depth       uint
+	dirPath     string
+	startPage   int
+	pageNum     int
+	recrawlFile string
+	warcDir     string
+	replayPath  string
+	recordDir   string
+	balancer    string
+	deadLetter  string
+	listDead    bool
+	reinject    bool
+	rulesFile   string
+	proxyFile   string
+	proxyMode   string
+	cookieFile  string
+	loginFile   string
+	fileRoot    string
+	domainFile  string
+	storageFile string
 )
 
 // 日志记录器
@@ -37,6 +62,39 @@ func init() {
 		"保存文件的路径")
 	flag.IntVar(&startPage, "startPage", 1, "起始页")
 	flag.IntVar(&pageNum, "pageNum", 1, "爬行的页数")
+	flag.StringVar(&recrawlFile, "recrawl", "",
+		"增量爬取状态文件的路径，为空时不启用增量爬取")
+	flag.StringVar(&warcDir, "warc", "",
+		"WARC归档文件的目录，为空时不归档")
+	flag.StringVar(&replayPath, "replay", "",
+		"回放数据的路径（WARC文件或录制目录），不为空时不访问网络")
+	flag.StringVar(&recordDir, "record", "",
+		"录制目录，不为空时把下载的响应录制下来供回放使用")
+	flag.StringVar(&balancer, "balancer", module.BALANCER_SCORE,
+		"组件的负载均衡策略: score, round_robin, weighted_round_robin,"+
+			" least_handling, random_two_choices, latency_ewma")
+	flag.StringVar(&deadLetter, "deadletter", "",
+		"死信文件的路径，为空时失败的条目和请求只会被记录到日志")
+	flag.BoolVar(&listDead, "deadletter-list", false,
+		"列出死信文件中的所有死信后退出")
+	flag.BoolVar(&reinject, "deadletter-reinject", false,
+		"启动后把死信文件中的死信重新注入调度器")
+	flag.StringVar(&rulesFile, "rules", "",
+		"网页抽取规则文件的路径（JSON或YAML），为空时使用内置的解析逻辑")
+	flag.StringVar(&proxyFile, "proxies", "",
+		"代理列表文件的路径（每行一个http、https或socks5代理），为空时不使用代理池")
+	flag.StringVar(&proxyMode, "proxy-mode", string(proxy.MODE_PER_REQUEST),
+		"代理的轮换方式: per_request, per_host")
+	flag.StringVar(&cookieFile, "cookies", "",
+		"Cookie文件的路径，不为空时会话会在多次运行之间保持")
+	flag.StringVar(&loginFile, "login", "",
+		"登录脚本文件的路径（JSON），为空时不登录")
+	flag.StringVar(&fileRoot, "file-root", "",
+		"file://协议请求的根目录（如本地镜像），为空时不接受file://请求")
+	flag.StringVar(&domainFile, "domain-config", "",
+		"各域的TLS与认证配置文件的路径（JSON），为空时不使用域配置")
+	flag.StringVar(&storageFile, "storage", "",
+		"存储配置文件的路径（JSON，可选local、memory或s3），为空时保存到dir指定的目录")
 }
 
 func Usage() {
@@ -50,6 +108,24 @@ func main() {
 	flag.Usage = Usage
 	flag.Parse()
 
+	var deadLetterStore deadletter.Store
+	if deadLetter != "" {
+		var err error
+		deadLetterStore, err = deadletter.NewFileStore(deadLetter)
+		if err != nil {
+			logger.Fatalf("载入死信文件发生异常: %s", err)
+		}
+	}
+	if listDead {
+		if deadLetterStore == nil {
+			logger.Fatal("请使用 -deadletter 指定死信文件")
+		}
+		if err := listDeadLetters(deadLetterStore); err != nil {
+			logger.Fatalf("列出死信发生异常: %s", err)
+		}
+		return
+	}
+
 	// 创建调度器
 	scheduler := sched.NewScheduler()
 	// 准备调度器的初始化参数
@@ -74,23 +150,155 @@ func main() {
 		ItemMaxBufferNumber:  100,
 		ErrorBufferCap:       50,
 		ErrorMaxBufferNumber: 1,
+		DeadLetterStore:      deadLetterStore,
+	}
+	var recrawlStore recrawl.Store
+	if recrawlFile != "" {
+		var err error
+		recrawlStore, err = recrawl.NewFileStore(recrawlFile)
+		if err != nil {
+			logger.Fatalf("载入增量爬取状态发生异常: %s", err)
+		}
+	}
+	var proxyPool proxy.Pool
+	if proxyFile != "" {
+		proxies, err := proxy.LoadList(proxyFile)
+		if err != nil {
+			logger.Fatalf("载入代理列表发生异常: %s", err)
+		}
+		proxyPool, err = proxy.NewPool(proxies, proxy.Mode(proxyMode), proxy.Policy{})
+		if err != nil {
+			logger.Fatalf("创建代理池发生异常: %s", err)
+		}
+	}
+	var cookieJar cookie.Jar
+	if cookieFile != "" {
+		var err error
+		cookieJar, err = cookie.NewFileJar(cookieFile)
+		if err != nil {
+			logger.Fatalf("载入Cookie文件发生异常: %s", err)
+		}
+	}
+	var loginScripts []downloader.LoginScript
+	if loginFile != "" {
+		var err error
+		loginScripts, err = downloader.LoadLoginScripts(loginFile)
+		if err != nil {
+			logger.Fatalf("载入登录脚本发生异常: %s", err)
+		}
+	}
+	var domainConfigs []downloader.DomainConfig
+	if domainFile != "" {
+		var err error
+		domainConfigs, err = downloader.LoadDomainConfigs(domainFile)
+		if err != nil {
+			logger.Fatalf("载入域配置发生异常: %s", err)
+		}
+	}
+	// 下载器和条目处理管道共用同一个HTTP客户端
+	httpClient := lib.GenHTTPClient()
+	if cookieJar != nil {
+		httpClient.Jar = cookieJar
+	}
+	var downloaders []module.Downloader
+	var err error
+	if replayPath != "" {
+		var source downloader.ReplaySource
+		source, err = downloader.OpenReplaySource(replayPath)
+		if err != nil {
+			logger.Fatalf("打开回放数据发生异常: %s", err)
+		}
+		downloaders, err = lib.GetReplayers(1, source)
+	} else {
+		downloaderArgs := downloader.Args{
+			RecrawlStore:  recrawlStore,
+			ProxyPool:     proxyPool,
+			CookieJar:     cookieJar,
+			LoginScripts:  loginScripts,
+			DomainConfigs: domainConfigs,
+			SchemeHandlers: map[string]downloader.SchemeHandler{
+				"data": downloader.NewDataHandler(),
+			},
+		}
+		if fileRoot != "" {
+			downloaderArgs.SchemeHandlers["file"] = downloader.NewFileHandler(fileRoot)
+		}
+		downloaders, err = lib.GetDownloaders(1, httpClient, downloaderArgs)
 	}
-	downloaders, err := lib.GetDownloaders(1)
 	if err != nil {
 		logger.Fatalf("创建下载器发生异常: %s", err)
 	}
-	analyzers, err := lib.GetAnalyzers(1)
+	if recordDir != "" {
+		for i, d := range downloaders {
+			var recorder module.Downloader
+			recorder, err = downloader.NewFixtureRecorder(d, recordDir)
+			if err != nil {
+				logger.Fatalf("创建录制下载器发生异常: %s", err)
+			}
+			downloaders[i] = recorder
+		}
+	}
+	var warcWriter warc.Writer
+	if warcDir != "" {
+		warcWriter, err = warc.NewWriter(warcDir, "bml365", 0)
+		if err != nil {
+			logger.Fatalf("创建WARC写入器发生异常: %s", err)
+		}
+		for i, d := range downloaders {
+			var recorder module.Downloader
+			recorder, err = downloader.NewWARCRecorder(d, warcWriter)
+			if err != nil {
+				logger.Fatalf("创建WARC归档下载器发生异常: %s", err)
+			}
+			downloaders[i] = recorder
+		}
+	}
+	var ext *extractor.Extractor
+	if rulesFile != "" {
+		ext, err = extractor.Load(rulesFile)
+		if err != nil {
+			logger.Fatalf("载入抽取规则发生异常: %s", err)
+		}
+	}
+	analyzers, err := lib.GetAnalyzers(1, ext)
 	if err != nil {
 		logger.Fatalf("创建分析器发生异常: %s", err)
 	}
-	pipelines, err := lib.GetPipelines(1, dirPath)
+	var backend storage.Storage
+	if storageFile != "" {
+		storageConfig, err := storage.LoadConfig(storageFile)
+		if err != nil {
+			logger.Fatalf("载入存储配置发生异常: %s", err)
+		}
+		if (storageConfig.Type == "" || storageConfig.Type == storage.TYPE_LOCAL) && storageConfig.Root == "" {
+			storageConfig.Root = dirPath
+		}
+		backend, err = storage.New(storageConfig)
+		if err != nil {
+			logger.Fatalf("创建存储发生异常: %s", err)
+		}
+	}
+	pipelines, err := lib.GetPipelines(1, dirPath, backend, httpClient)
 	if err != nil {
 		logger.Fatalf("创建条目处理管道发生异常: %s", err)
 	}
+	moduleBalancer, err := module.NewBalancer(balancer)
+	if err != nil {
+		logger.Fatalf("创建负载均衡器发生异常: %s", err)
+	}
 	moduleArgs := sched.ModuleArgs{
 		Downloaders: downloaders,
 		Analyzers:   analyzers,
 		Pipelines:   pipelines,
+		Balancer:    moduleBalancer,
+		HealthPolicy: module.HealthPolicy{
+			WindowSize:    20,
+			MinSamples:    5,
+			MaxErrorRatio: 0.5,
+			Cooldown:      30 * time.Second,
+		},
+		HealthCheckInterval: 30 * time.Second,
+		FlushInterval:       time.Minute,
 	}
 	// 初始化调度器
 	err = scheduler.Init(requestArgs, dataArgs, moduleArgs)
@@ -115,10 +323,46 @@ func main() {
 	if err != nil {
 		logger.Fatalf("开启调度器发送异常: %s", err)
 	}
+	if reinject && deadLetterStore != nil {
+		number, err := sched.ReinjectDeadLetters(scheduler, deadLetterStore)
+		if err != nil {
+			logger.Errorf("重新注入死信发生异常: %s", err)
+		}
+		logger.Infof("已重新注入死信 (数量: %d)", number)
+	}
 	//自定义首次发送
 	bm1365Model.InitReqList(startPage, pageNum, scheduler)
 	// 等待监控结束
 	<-checkCountChan
-	bm1365Model.SaveExcel(dirPath)
+	if recrawlStore != nil {
+		for _, ds := range scheduler.Summary().Struct().Downloaders {
+			logger.Infof("增量爬取统计 (MID: %s): %+v", ds.ID, ds.Extra)
+		}
+	}
 	logger.Info("程序结束")
 }
+
+// 用于把死信逐条打印到标准输出
+func listDeadLetters(store deadletter.Store) error {
+	entries, err := store.Entries()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		var target string
+		switch entry.Kind {
+		case deadletter.KIND_REQUEST:
+			if entry.Request != nil {
+				target = entry.Request.Method + " " + entry.Request.URL
+			}
+		case deadletter.KIND_ITEM:
+			target = fmt.Sprintf("%v", entry.Item)
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\n", entry.ID, entry.Time.Format(time.RFC3339), entry.Kind, target)
+		for _, info := range entry.Errors {
+			fmt.Printf("\t[%s] %s %s\n", info.Type, info.Module, info.Message)
+		}
+	}
+	fmt.Printf("共 %d 条死信\n", len(entries))
+	return nil
+}
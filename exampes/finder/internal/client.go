@@ -7,7 +7,8 @@ import (
 )
 
 // 用于生成HTTP客户端
-func genHTTPClient() *http.Client {
+// 下载器与条目处理管道中的媒体下载器应共用同一个客户端，以共享连接池、代理和Cookie
+func GenHTTPClient() *http.Client {
 	return &http.Client{
 		Transport: &http.Transport{
 			Proxy: http.ProxyFromEnvironment,
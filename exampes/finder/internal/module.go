@@ -5,23 +5,31 @@ import (
 	"../../../module/local/analyzer"
 	"../../../module/local/downloader"
 	"../../../module/local/pipeline"
+	"../../../toolkit/media"
+	"../../../toolkit/storage"
+	"net/http"
+	"path/filepath"
 )
 
 // 组件序列号生成器
 var snGen = module.NewSNGenertor(1, 0)
 
 // 用于获取下载器列表
-func GetDownloaders(number uint8) ([]module.Downloader, error) {
+// 参数client为nil时使用新生成的HTTP客户端
+func GetDownloaders(number uint8, client *http.Client) ([]module.Downloader, error) {
 	downloaders := []module.Downloader{}
 	if number == 0 {
 		return downloaders, nil
 	}
+	if client == nil {
+		client = GenHTTPClient()
+	}
 	for i := uint8(0); i < number; i++ {
 		mid, err := module.GenMID(module.TYPE_DOWNLOADER, snGen.Get(), nil)
 		if err != nil {
 			return downloaders, err
 		}
-		d, err := downloader.New(mid, genHTTPClient(), module.CalculateScoreSimple)
+		d, err := downloader.New(mid, client, module.CalculateScoreSimple)
 		if err != nil {
 			return downloaders, err
 		}
@@ -41,7 +49,7 @@ func GetAnalyzers(number uint8) ([]module.Analyzer, error) {
 		if err != nil {
 			return analyzers, err
 		}
-		a, err := analyzer.New(mid, genResponseParsers(), module.CalculateScoreSimple)
+		a, err := analyzer.NewWithRoutes(mid, genResponseRoutes(), module.CalculateScoreSimple)
 		if err != nil {
 			return analyzers, err
 		}
@@ -51,17 +59,41 @@ func GetAnalyzers(number uint8) ([]module.Analyzer, error) {
 }
 
 // 用于获取条目处理管道列表
-func GetPipelines(number uint8, dirPath string) ([]module.Pipeline, error) {
+// 图片按内容摘要命名存放在给定的存储后端中，所有管道共用同一个存储
+// 参数backend为nil时使用以dirPath为根目录的本地存储，dirPath下的.staging目录用于暂存下载中的图片
+// 参数client用于重新下载图片，应与下载器共用，为nil时使用新生成的HTTP客户端
+func GetPipelines(number uint8, dirPath string, backend storage.Storage,
+	client *http.Client) ([]module.Pipeline, error) {
 	pipelines := []module.Pipeline{}
 	if number == 0 {
 		return pipelines, nil
 	}
+	if client == nil {
+		client = GenHTTPClient()
+	}
+	absDirPath, err := checkDirPath(dirPath)
+	if err != nil {
+		return pipelines, err
+	}
+	if backend == nil {
+		if backend, err = storage.NewLocal(absDirPath); err != nil {
+			return pipelines, err
+		}
+	}
+	store, err := media.NewStore(backend, filepath.Join(absDirPath, ".staging"))
+	if err != nil {
+		return pipelines, err
+	}
+	hooks := pipeline.Hooks{
+		Flush: store.Save,
+		Close: store.Save,
+	}
 	for i := uint8(0); i < number; i++ {
 		mid, err := module.GenMID(module.TYPE_PIPELINE, snGen.Get(), nil)
 		if err != nil {
 			return pipelines, err
 		}
-		a, err := pipeline.New(mid, genItemProcessors(dirPath), module.CalculateScoreSimple)
+		a, err := pipeline.NewWithHooks(mid, genItemProcessors(store, client), hooks, module.CalculateScoreSimple)
 		if err != nil {
 			return pipelines, err
 		}
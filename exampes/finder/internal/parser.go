@@ -2,17 +2,20 @@ package internal
 
 import (
 	"../../../module"
+	"../../../module/local/analyzer"
 	"github.com/PuerkitoBio/goquery"
 	"net/url"
 	"path"
 
 	"fmt"
+	"mime"
 	"net/http"
 	"strings"
 )
 
-// 用于生成响应解析器
-func genResponseParsers() []module.ParseResponse {
+// 用于生成响应解析函数的路由规则
+// 网页交给parseLink，图片交给parseImg，其他响应不会被解析
+func genResponseRoutes() []analyzer.Route {
 	parseLink := func(httpResp *http.Response, respDepth uint32) ([]module.Data, []error) {
 		dataList := make([]module.Data, 0)
 		// 检查响应
@@ -24,31 +27,12 @@ func genResponseParsers() []module.ParseResponse {
 			return nil, []error{fmt.Errorf("空的HTTP请求")}
 		}
 		reqURL := httpReq.URL
-		if httpResp.StatusCode != 200 {
-			err := fmt.Errorf("请求返回状态不是200 %d (requestURL: %s)",
-				httpResp.StatusCode, reqURL)
-			return nil, []error{err}
-		}
 		body := httpResp.Body
 		if body == nil {
 			err := fmt.Errorf("空的HTTP响应体 (requestURL: %s)",
 				reqURL)
 			return nil, []error{err}
 		}
-		// 检查HTTP响应头中的内容类型
-		var matchedContentType bool
-		if httpResp.Header != nil {
-			contentTypes := httpResp.Header["Content-Type"]
-			for _, ct := range contentTypes {
-				if strings.HasPrefix(ct, "text/html") {
-					matchedContentType = true
-					break
-				}
-			}
-		}
-		if !matchedContentType {
-			return dataList, nil
-		}
 		// 解析HTTP响应体
 		doc, err := goquery.NewDocumentFromReader(body)
 		if err != nil {
@@ -120,49 +104,41 @@ func genResponseParsers() []module.ParseResponse {
 			return nil, []error{fmt.Errorf("空的HTTP请求")}
 		}
 		reqURL := httpReq.URL
-		if httpResp.StatusCode != 200 {
-			err := fmt.Errorf("请求返回状态不是200 %d (requestURL: %s)",
-				httpResp.StatusCode, reqURL)
-			return nil, []error{err}
-		}
 		httpRespBody := httpResp.Body
 		if httpRespBody == nil {
 			err := fmt.Errorf("空的HTTP响应体 (requestURL: %s)",
 				reqURL)
 			return nil, []error{err}
 		}
-		// 检查HTTP响应头中的内容类型
+		// 从内容类型中取出图片格式
 		dataList := make([]module.Data, 0)
-		var pictureFormat string
-		if httpResp.Header != nil {
-			contentTypes := httpResp.Header["Content-Type"]
-			var contentType string
-			for _, ct := range contentTypes {
-				if strings.HasPrefix(ct, "image") {
-					contentType = ct
-					break
-				}
-			}
-			index1 := strings.Index(contentType, "/")
-			index2 := strings.Index(contentType, ";")
-			if index1 > 0 {
-				if index2 < 0 {
-					pictureFormat = contentType[index1+1:]
-				} else if index1 < index2 {
-					pictureFormat = contentType[index1+1 : index2]
-				}
-			}
-		}
-		if pictureFormat == "" {
+		mediaType, _, _ := mime.ParseMediaType(httpResp.Header.Get("Content-Type"))
+		pictureFormat := strings.TrimPrefix(mediaType, "image/")
+		if pictureFormat == "" || pictureFormat == mediaType {
 			return dataList, nil
 		}
-		// 生成条目
+		// 生成条目，响应体交由条目处理管道关闭
 		item := make(map[string]interface{})
-		item["reader"] = httpRespBody
+		item["reader"] = analyzer.TakeBody(httpResp)
 		item["name"] = path.Base(reqURL.Path)
 		item["ext"] = pictureFormat
+		item["url"] = reqURL.String()
+		if httpResp.ContentLength > 0 {
+			item["size"] = httpResp.ContentLength
+		}
 		dataList = append(dataList, module.Item(item))
 		return dataList, nil
 	}
-	return []module.ParseResponse{parseLink, parseImg}
+	return []analyzer.Route{
+		{
+			MIMETypes:   []string{"text/html"},
+			StatusCodes: []int{http.StatusOK},
+			Parsers:     []module.ParseResponse{parseLink},
+		},
+		{
+			MIMETypes:   []string{"image/*"},
+			StatusCodes: []int{http.StatusOK},
+			Parsers:     []module.ParseResponse{parseImg},
+		},
+	}
 }
@@ -2,49 +2,41 @@ package internal
 
 import (
 	"../../../module"
+	"../../../toolkit/media"
 	"errors"
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
+	"net/http"
+	"time"
 )
 
 // 用于生成条目处理器
-func genItemProcessors(dirPath string) []module.ProcessItem {
+// 图片会被存入给定的内容寻址存储，条目中的file_path为图片在存储后端中的键
+// 重新下载图片时使用给定的HTTP客户端
+func genItemProcessors(store media.Store, client *http.Client) []module.ProcessItem {
+	fetcher := media.NewFetcher(client, 3, time.Second)
 	savePicture := func(itme module.Item) (result module.Item, err error) {
 		if itme == nil {
 			return nil, errors.New("无效的条目")
 		}
 		// 检查和准备数据
-		var absDirPath string
-		if absDirPath, err = checkDirPath(dirPath); err != nil {
-			return
+		// 从死信重新注入的条目没有reader，会根据url重新下载
+		var reader io.Reader
+		if v := itme["reader"]; v != nil {
+			var ok bool
+			reader, ok = v.(io.Reader)
+			if !ok {
+				return nil, fmt.Errorf("条目处理管道 reader 类型错误: %T", v)
+			}
+			readCloser, ok := reader.(io.ReadCloser)
+			if ok {
+				defer readCloser.Close()
+			}
+		} else if _, ok := itme["url"].(string); !ok {
+			return nil, errors.New("条目处理管道缺少 reader 和 url")
 		}
-		v := itme["reader"]
-		reader, ok := v.(io.Reader)
-		if !ok {
-			return nil, fmt.Errorf("条目处理管道 reader 类型错误: %T", v)
-		}
-		readCloser, ok := reader.(io.ReadCloser)
-		if ok {
-			defer readCloser.Close()
-		}
-		v = itme["name"]
-		name, ok := v.(string)
-		if !ok {
-			return nil, fmt.Errorf("条目处理管道 name 类型错误: %T", v)
-		}
-		// 创建图片文件
-		fileName := name
-		filePath := filepath.Join(absDirPath, fileName)
-		file, err := os.Create(filePath)
-		if err != nil {
-			return nil, fmt.Errorf("创建文件失败: %s (path: %s)",
-				err, filePath)
-		}
-		defer file.Close()
 		// 写图片文件
-		_, err = io.Copy(file, reader)
+		saved, err := storePicture(store, fetcher, itme, reader)
 		if err != nil {
 			return nil, err
 		}
@@ -53,12 +45,10 @@ func genItemProcessors(dirPath string) []module.ProcessItem {
 		for k, v := range itme {
 			result[k] = v
 		}
-		result["file_path"] = filePath
-		fileInfo, err := file.Stat()
-		if err != nil {
-			return nil, err
-		}
-		result["file_size"] = fileInfo.Size()
+		result["file_path"] = saved.Key
+		result["file_size"] = saved.Size
+		result["file_hash"] = saved.Hash
+		result["duplicate"] = saved.Duplicate
 		return result, nil
 	}
 	recordPicture := func(item module.Item) (result module.Item, err error) {
@@ -72,8 +62,42 @@ func genItemProcessors(dirPath string) []module.ProcessItem {
 		if !ok {
 			return nil, fmt.Errorf("条目处理管道 file_size 类型错误: %T", v)
 		}
-		logger.Infof("保存文件: %s, 文件大小: %d byte(s).", path, size)
+		if duplicate, _ := item["duplicate"].(bool); duplicate {
+			logger.Infof("文件已存在，不再重复保存: %s, 文件大小: %d byte(s).", path, size)
+		} else {
+			logger.Infof("保存文件: %s, 文件大小: %d byte(s).", path, size)
+		}
 		return nil, nil
 	}
 	return []module.ProcessItem{savePicture, recordPicture}
 }
+
+// 用于把图片条目中的数据存入内容寻址存储
+// 条目中的url会被记入存储的索引，没有url时使用name
+// 响应体读取中断或大小不符时，若条目中有图片的URL，会重新下载该图片
+// 参数reader为nil时直接根据URL下载
+func storePicture(store media.Store, fetcher *media.Fetcher, item module.Item, reader io.Reader) (*media.Stored, error) {
+	expect := media.Expect{}
+	if size, ok := item["size"].(int64); ok && size > 0 {
+		expect.Size = size
+	}
+	ext, _ := item["ext"].(string)
+	rawURL, _ := item["url"].(string)
+	key := rawURL
+	if key == "" {
+		name, ok := item["name"].(string)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("条目处理管道 name 类型错误: %T", item["name"])
+		}
+		key = name
+	}
+	if reader == nil {
+		return store.Fetch(fetcher, rawURL, ext, expect)
+	}
+	stored, err := store.Put(key, reader, ext, expect)
+	if err == nil || rawURL == "" {
+		return stored, err
+	}
+	logger.Warnf("保存图片出现异常，尝试重新下载: %s (URL: %s)", err, rawURL)
+	return store.Fetch(fetcher, rawURL, ext, expect)
+}
@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"../../../module"
+	"../../../module/local/pipeline"
+	"../../../scheduler"
+	"../../../toolkit/deadletter"
+	"../../../toolkit/media"
+	"../../../toolkit/storage"
+)
+
+// 代表读到一半就出错的响应体
+type brokenBody struct {
+	data string
+}
+
+func (body *brokenBody) Read(p []byte) (int, error) {
+	if body.data == "" {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(p, body.data)
+	body.data = body.data[n:]
+	return n, nil
+}
+
+// 代表只把条目交给给定管道的调度器
+type pipelineScheduler struct {
+	scheduler.Scheduler
+	pipeline module.Pipeline
+	// 管道处理条目时产生的错误
+	errs []error
+	// 被发送的条目
+	items []module.Item
+}
+
+func (sched *pipelineScheduler) Status() scheduler.Status {
+	return scheduler.SCHED_STATUS_STARTED
+}
+
+func (sched *pipelineScheduler) SendItem(item module.Item) bool {
+	sched.items = append(sched.items, item)
+	sched.errs = append(sched.errs, sched.pipeline.Send(item)...)
+	return true
+}
+
+// 处理失败的图片条目放入死信存储后，重新注入时应根据URL重新下载并存入图片存储
+func TestReinjectPictureItem(t *testing.T) {
+	picture := "\x89PNG picture data"
+	var available int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&available) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte(picture))
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	store, err := media.NewStore(storage.NewMemory(), filepath.Join(dir, ".staging"))
+	if err != nil {
+		t.Fatalf("An error occurs when creating a media store: %s", err)
+	}
+	mid, _ := module.GenMID(module.TYPE_PIPELINE, 1, nil)
+	p, err := pipeline.New(mid, genItemProcessors(store, nil), module.CalculateScoreSimple)
+	if err != nil {
+		t.Fatalf("An error occurs when creating a pipeline: %s", err)
+	}
+	p.SetFailFast(true)
+	// 与parseImg生成的条目一致，但响应体读取中断且图片暂时无法重新下载
+	pictureURL := server.URL + "/a.png"
+	item := module.Item{
+		"reader": ioutil.NopCloser(&brokenBody{data: picture[:4]}),
+		"name":   "a.png",
+		"ext":    "png",
+		"url":    pictureURL,
+		"size":   int64(len(picture)),
+	}
+	errs := p.Send(item)
+	if len(errs) == 0 {
+		t.Fatalf("No error when processing a broken picture item!")
+	}
+	deadLetters, err := deadletter.NewFileStore(filepath.Join(dir, "dead.jsonl"))
+	if err != nil {
+		t.Fatalf("An error occurs when creating a dead letter store: %s", err)
+	}
+	entry := deadletter.Entry{
+		Kind:   deadletter.KIND_ITEM,
+		Errors: []deadletter.ErrorInfo{{Message: errs[0].Error()}},
+		Item:   item,
+	}
+	if err := deadLetters.Add(entry); err != nil {
+		t.Fatalf("An error occurs when adding a dead letter: %s", err)
+	}
+	atomic.StoreInt32(&available, 1)
+	sched := &pipelineScheduler{pipeline: p}
+	n, err := scheduler.ReinjectDeadLetters(sched, deadLetters)
+	if err != nil {
+		t.Fatalf("An error occurs when reinjecting dead letters: %s", err)
+	}
+	if n != 1 {
+		t.Fatalf("Inconsistent reinjected count: expected: 1, actual: %d", n)
+	}
+	if len(sched.errs) != 0 {
+		t.Fatalf("An error occurs when processing the reinjected item: %v", sched.errs)
+	}
+	if _, ok := sched.items[0]["reader"]; ok {
+		t.Fatalf("Inconsistent reinjected item: the reader should not be stored")
+	}
+	if size, ok := sched.items[0]["size"].(int64); !ok || size != int64(len(picture)) {
+		t.Fatalf("Inconsistent size: expected: int64(%d), actual: %T(%v)",
+			len(picture), sched.items[0]["size"], sched.items[0]["size"])
+	}
+	if deadLetters.Len() != 0 {
+		t.Fatalf("Inconsistent dead letter count: expected: 0, actual: %d", deadLetters.Len())
+	}
+	stored, ok := store.Lookup(pictureURL)
+	if !ok {
+		t.Fatalf("No stored picture for %s!", pictureURL)
+	}
+	if stored.Size != int64(len(picture)) || stored.Ext != "png" {
+		t.Fatalf("Inconsistent stored picture: expected: %d bytes of png, actual: %d bytes of %s",
+			len(picture), stored.Size, stored.Ext)
+	}
+}
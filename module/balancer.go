@@ -0,0 +1,329 @@
+package module
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"../errors"
+)
+
+// 组件负载均衡器的接口类型
+// 该接口的实现类型必须是并发安全的
+type Balancer interface {
+	// 用于获取负载均衡策略的名称
+	Name() string
+	// 用于从给定的候选组件中选出一个
+	// 参数candidates已按组件ID排序且不为空
+	Select(moduleType Type, candidates []Module) Module
+}
+
+// 可以接收调用反馈的负载均衡器的接口类型
+type FeedbackBalancer interface {
+	Balancer
+	// 用于报告一次组件调用的耗时与结果
+	Observe(mid MID, latency time.Duration, err error)
+}
+
+// 可以设置组件权重的负载均衡器的接口类型
+type WeightedBalancer interface {
+	Balancer
+	// 用于设置组件的权重
+	SetWeight(mid MID, weight uint32)
+}
+
+// 当前支持的负载均衡策略名称的常量
+const (
+	// 基于组件评分，评分最低者优先
+	BALANCER_SCORE = "score"
+	// 轮询
+	BALANCER_ROUND_ROBIN = "round_robin"
+	// 加权轮询
+	BALANCER_WEIGHTED_ROUND_ROBIN = "weighted_round_robin"
+	// 实时处理数最少者优先
+	BALANCER_LEAST_HANDLING = "least_handling"
+	// 随机选取两个，实时处理数较少者优先
+	BALANCER_RANDOM_TWO_CHOICES = "random_two_choices"
+	// 基于调用耗时的指数加权移动平均值
+	BALANCER_LATENCY_EWMA = "latency_ewma"
+)
+
+// 用于根据策略名称创建负载均衡器
+// 加权轮询策略在此处使用相同的权重，可以通过WeightedBalancer接口再设置各组件的权重
+func NewBalancer(name string) (Balancer, error) {
+	switch name {
+	case "", BALANCER_SCORE:
+		return NewScoreBalancer(), nil
+	case BALANCER_ROUND_ROBIN:
+		return NewRoundRobinBalancer(), nil
+	case BALANCER_WEIGHTED_ROUND_ROBIN:
+		return NewWeightedRoundRobinBalancer(nil), nil
+	case BALANCER_LEAST_HANDLING:
+		return NewLeastHandlingBalancer(), nil
+	case BALANCER_RANDOM_TWO_CHOICES:
+		return NewRandomTwoChoicesBalancer(), nil
+	case BALANCER_LATENCY_EWMA:
+		return NewLatencyBalancer(0), nil
+	default:
+		errMsg := fmt.Sprintf("不支持的负载均衡策略: %s", name)
+		return nil, errors.NewIllegalParameterError(errMsg)
+	}
+}
+
+// 代表基于组件评分的负载均衡器的实现类型
+type scoreBalancer struct{}
+
+// 用于创建一个基于组件评分的负载均衡器
+// 它会选择评分最低的组件，评分相同时选择组件ID较小者
+func NewScoreBalancer() Balancer {
+	return scoreBalancer{}
+}
+
+func (b scoreBalancer) Name() string {
+	return BALANCER_SCORE
+}
+
+func (b scoreBalancer) Select(moduleType Type, candidates []Module) Module {
+	var selected Module
+	var minScore uint64
+	for _, module := range candidates {
+		SetScore(module)
+		score := module.Score()
+		if selected == nil || score < minScore {
+			selected = module
+			minScore = score
+		}
+	}
+	return selected
+}
+
+// 代表轮询负载均衡器的实现类型
+type roundRobinBalancer struct {
+	// 代表各组件类型的下一个位置
+	next map[Type]uint64
+	// 代表互斥锁
+	lock sync.Mutex
+}
+
+// 用于创建一个轮询负载均衡器
+func NewRoundRobinBalancer() Balancer {
+	return &roundRobinBalancer{next: map[Type]uint64{}}
+}
+
+func (b *roundRobinBalancer) Name() string {
+	return BALANCER_ROUND_ROBIN
+}
+
+func (b *roundRobinBalancer) Select(moduleType Type, candidates []Module) Module {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	index := b.next[moduleType] % uint64(len(candidates))
+	b.next[moduleType]++
+	return candidates[index]
+}
+
+// 代表加权轮询负载均衡器的实现类型
+// 采用平滑加权轮询算法，避免权重大的组件被连续选中
+type weightedRoundRobinBalancer struct {
+	// 代表组件ID与权重的映射
+	weights map[MID]uint32
+	// 代表各组件当前的动态权重
+	current map[MID]int64
+	// 代表互斥锁
+	lock sync.Mutex
+}
+
+// 用于创建一个加权轮询负载均衡器
+// 参数weights中未列出的组件的权重为1，权重为0的组件不会被选中（除非别无选择）
+func NewWeightedRoundRobinBalancer(weights map[MID]uint32) Balancer {
+	innerWeights := map[MID]uint32{}
+	for mid, weight := range weights {
+		innerWeights[mid] = weight
+	}
+	return &weightedRoundRobinBalancer{
+		weights: innerWeights,
+		current: map[MID]int64{},
+	}
+}
+
+func (b *weightedRoundRobinBalancer) Name() string {
+	return BALANCER_WEIGHTED_ROUND_ROBIN
+}
+
+// 权重为0的组件不会被选中（除非别无选择）
+func (b *weightedRoundRobinBalancer) SetWeight(mid MID, weight uint32) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.weights[mid] = weight
+}
+
+func (b *weightedRoundRobinBalancer) Select(moduleType Type, candidates []Module) Module {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var selected Module
+	var total int64
+	for _, module := range candidates {
+		weight := int64(1)
+		if w, ok := b.weights[module.ID()]; ok {
+			weight = int64(w)
+		}
+		if weight == 0 {
+			continue
+		}
+		total += weight
+		b.current[module.ID()] += weight
+		if selected == nil || b.current[module.ID()] > b.current[selected.ID()] {
+			selected = module
+		}
+	}
+	if selected == nil {
+		return candidates[0]
+	}
+	b.current[selected.ID()] -= total
+	return selected
+}
+
+// 代表实时处理数最少者优先的负载均衡器的实现类型
+type leastHandlingBalancer struct {
+	// 代表各组件类型的起始查找位置，用于在实时处理数相同时轮流选择
+	offset map[Type]uint64
+	// 代表互斥锁
+	lock sync.Mutex
+}
+
+// 用于创建一个实时处理数最少者优先的负载均衡器
+func NewLeastHandlingBalancer() Balancer {
+	return &leastHandlingBalancer{offset: map[Type]uint64{}}
+}
+
+func (b *leastHandlingBalancer) Name() string {
+	return BALANCER_LEAST_HANDLING
+}
+
+func (b *leastHandlingBalancer) Select(moduleType Type, candidates []Module) Module {
+	b.lock.Lock()
+	start := b.offset[moduleType]
+	b.offset[moduleType]++
+	b.lock.Unlock()
+	var selected Module
+	var min uint64
+	length := uint64(len(candidates))
+	for i := uint64(0); i < length; i++ {
+		module := candidates[(start+i)%length]
+		handling := module.HandlingNumber()
+		if selected == nil || handling < min {
+			selected = module
+			min = handling
+		}
+	}
+	return selected
+}
+
+// 代表随机选取两个组件并择优的负载均衡器的实现类型
+type randomTwoChoicesBalancer struct {
+	// 代表随机数生成器
+	random *rand.Rand
+	// 代表保护随机数生成器的互斥锁
+	lock sync.Mutex
+}
+
+// 用于创建一个随机选取两个组件并择优的负载均衡器
+// 它会随机选取两个组件，然后选择实时处理数较少的那一个
+func NewRandomTwoChoicesBalancer() Balancer {
+	return &randomTwoChoicesBalancer{
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (b *randomTwoChoicesBalancer) Name() string {
+	return BALANCER_RANDOM_TWO_CHOICES
+}
+
+func (b *randomTwoChoicesBalancer) Select(moduleType Type, candidates []Module) Module {
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+	b.lock.Lock()
+	i := b.random.Intn(len(candidates))
+	j := b.random.Intn(len(candidates) - 1)
+	b.lock.Unlock()
+	if j >= i {
+		j++
+	}
+	first, second := candidates[i], candidates[j]
+	if second.HandlingNumber() < first.HandlingNumber() {
+		return second
+	}
+	return first
+}
+
+// 默认的耗时平滑系数
+const defaultEWMAAlpha = 0.3
+
+// 调用出错时计入的最低耗时
+const errorLatencyPenalty = time.Second
+
+// 代表基于调用耗时的负载均衡器的实现类型
+type latencyBalancer struct {
+	// 代表平滑系数，取值范围(0, 1]
+	alpha float64
+	// 代表组件ID与耗时的指数加权移动平均值（纳秒）的映射
+	ewma map[MID]float64
+	// 代表读写锁
+	rwLock sync.RWMutex
+}
+
+// 用于创建一个基于调用耗时的负载均衡器
+// 它会选择耗时的指数加权移动平均值与（实时处理数+1）之积最小的组件
+// 尚无耗时记录的组件会被优先选中，以便获得初始的记录
+// 出错的调用按惩罚耗时计入，即实际耗时、此前平均值的两倍和errorLatencyPenalty中的最大者
+// 参数alpha代表平滑系数，不在(0, 1]范围内时使用默认值
+func NewLatencyBalancer(alpha float64) FeedbackBalancer {
+	if alpha <= 0 || alpha > 1 {
+		alpha = defaultEWMAAlpha
+	}
+	return &latencyBalancer{
+		alpha: alpha,
+		ewma:  map[MID]float64{},
+	}
+}
+
+func (b *latencyBalancer) Name() string {
+	return BALANCER_LATENCY_EWMA
+}
+
+func (b *latencyBalancer) Select(moduleType Type, candidates []Module) Module {
+	b.rwLock.RLock()
+	defer b.rwLock.RUnlock()
+	var selected Module
+	var minCost float64
+	for _, module := range candidates {
+		latency, ok := b.ewma[module.ID()]
+		if !ok {
+			return module
+		}
+		cost := latency * float64(module.HandlingNumber()+1)
+		if selected == nil || cost < minCost {
+			selected = module
+			minCost = cost
+		}
+	}
+	return selected
+}
+
+func (b *latencyBalancer) Observe(mid MID, latency time.Duration, err error) {
+	b.rwLock.Lock()
+	defer b.rwLock.Unlock()
+	sample := float64(latency)
+	prev, ok := b.ewma[mid]
+	if err != nil {
+		sample = math.Max(sample, math.Max(2*prev, float64(errorLatencyPenalty)))
+	}
+	if !ok {
+		b.ewma[mid] = sample
+		return
+	}
+	b.ewma[mid] = b.alpha*sample + (1-b.alpha)*prev
+}
@@ -16,12 +16,13 @@ type Counts struct {
 
 // 组件摘要结构的类型
 type SummaryStruct struct {
-	ID        MID         `json:"id"`
-	Called    uint64      `json:"called"`
-	Accepted  uint64      `json:"accepted"`
-	Completed uint64      `json:"completed"`
-	Handling  uint64      `json:"handling"`
-	Extra     interface{} `json:"extra, omitempty"`
+	ID        MID           `json:"id"`
+	Called    uint64        `json:"called"`
+	Accepted  uint64        `json:"accepted"`
+	Completed uint64        `json:"completed"`
+	Handling  uint64        `json:"handling"`
+	Health    HealthSummary `json:"health"`
+	Extra     interface{}   `json:"extra,omitempty"`
 }
 
 // Module代表组件的基础接口类型
@@ -93,3 +94,29 @@ type Pipeline interface {
 
 // 用于处理条目的函数类型
 type ProcessItem func(item Item) (result Item, err error)
+
+// 用于批量处理条目的函数类型
+// 结果值results和errs中的第i个元素分别对应参数items中的第i个条目
+// results为nil或其中的元素为nil时，表示对应的条目保持不变
+// errs为nil或其中的元素为nil时，表示对应的条目处理成功
+type ProcessItems func(items []Item) (results []Item, errs []error)
+
+// 代表处理某个条目时出现的错误
+// 异步报告的错误使用该类型，以便调用方知道出错的是哪个条目
+type ItemError struct {
+	// 出错的条目
+	Item Item
+	// 原始的错误
+	Err error
+}
+
+func (e *ItemError) Error() string {
+	return e.Err.Error()
+}
+
+// 可以异步报告错误的组件的接口类型
+// 组件可以选择性地实现该接口，调度器会把从通道中接收到的错误发送到错误缓冲池
+type AsyncErrorReporter interface {
+	// 用于获取异步错误的接收通道，该通道会在组件关闭时被关闭
+	ErrorChan() <-chan error
+}
@@ -1,6 +1,9 @@
 package module
 
-import "net/http"
+import (
+	"net/http"
+	"net/url"
+)
 
 // 数据的接口类型
 type Data interface {
@@ -14,6 +17,8 @@ type Request struct {
 	httpReq *http.Request
 	// 请求的深度
 	depth uint32
+	// 父请求的URL，即该请求是从哪个页面中发现的
+	parent *url.URL
 }
 
 // 用于创建一个新的请求实例
@@ -34,6 +39,17 @@ func (req *Request) Depth() uint32 {
 	return req.depth
 }
 
+// 用于获取父请求的URL
+// 首个请求以及没有记录来源的请求的父请求URL为nil
+func (req *Request) Parent() *url.URL {
+	return req.parent
+}
+
+// 用于设置父请求的URL
+func (req *Request) SetParent(parent *url.URL) {
+	req.parent = parent
+}
+
 // 用于判断请求是否有效
 func (req *Request) Valid() bool {
 	return req.httpReq != nil && req.httpReq.URL != nil
@@ -45,6 +61,10 @@ type Response struct {
 	httpResp *http.Response
 	// 响应的深度
 	depth uint32
+	// 响应内容的原始字符集，由分析器在转码前探测得到
+	charset string
+	// 重定向经过的URL的列表
+	redirectChain []*url.URL
 }
 
 // 用于创建一个新的响应类型
@@ -65,6 +85,29 @@ func (resp *Response) Depth() uint32 {
 	return resp.depth
 }
 
+// 用于获取响应内容的原始字符集
+// 未经分析器探测或内容不是文本时为空
+func (resp *Response) Charset() string {
+	return resp.charset
+}
+
+// 用于设置响应内容的原始字符集
+func (resp *Response) SetCharset(charset string) {
+	resp.charset = charset
+}
+
+// 用于获取重定向经过的URL的列表
+// 列表按重定向的顺序排列，不含原始请求的URL，最后一个元素即最终的URL
+// 没有发生重定向时为空
+func (resp *Response) RedirectChain() []*url.URL {
+	return resp.redirectChain
+}
+
+// 用于设置重定向经过的URL的列表
+func (resp *Response) SetRedirectChain(chain []*url.URL) {
+	resp.redirectChain = chain
+}
+
 // 用于判断响应是否有效
 func (resp *Response) Valid() bool {
 	return resp.httpResp != nil && resp.httpResp.Body != nil
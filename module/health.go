@@ -0,0 +1,248 @@
+package module
+
+import (
+	"sync"
+	"time"
+)
+
+// 可以自检健康状况的组件的接口类型
+// 组件可以选择性地实现该接口，调度器会定期调用它
+type HealthChecker interface {
+	// 用于检查组件的健康状况，结果值为nil时表示健康
+	CheckHealth() error
+}
+
+// 代表组件健康策略的类型
+// 被动统计基于最近若干次调用的错误率，而非连续失败的次数，
+// 以免偶发的失败导致组件被移出，或时好时坏的组件始终不被移出
+type HealthPolicy struct {
+	// 统计错误率时使用的最近调用的次数，为0时使用默认值
+	WindowSize uint32 `json:"window_size"`
+	// 窗口内至少有多少次调用才会判断错误率，为0时使用默认值
+	MinSamples uint32 `json:"min_samples"`
+	// 窗口内的错误率达到该值时将组件移出选择范围，取值范围(0, 1]，超出范围时使用默认值
+	MaxErrorRatio float64 `json:"max_error_ratio"`
+	// 被动移出后经过多久重新参与选择，为0时使用默认值
+	Cooldown time.Duration `json:"cooldown"`
+}
+
+// 默认的错误率统计窗口大小
+const DEFAULT_HEALTH_WINDOW_SIZE uint32 = 20
+
+// 默认的判断错误率所需的最少调用次数
+const DEFAULT_HEALTH_MIN_SAMPLES uint32 = 5
+
+// 默认的错误率阈值
+const DEFAULT_MAX_ERROR_RATIO = 0.5
+
+// 默认的被动移出时长
+const DEFAULT_EJECT_COOLDOWN = 30 * time.Second
+
+// 用于获取填充了默认值的健康策略
+func (policy HealthPolicy) normalize() HealthPolicy {
+	if policy.WindowSize == 0 {
+		policy.WindowSize = DEFAULT_HEALTH_WINDOW_SIZE
+	}
+	if policy.MinSamples == 0 {
+		policy.MinSamples = DEFAULT_HEALTH_MIN_SAMPLES
+	}
+	if policy.MinSamples > policy.WindowSize {
+		policy.MinSamples = policy.WindowSize
+	}
+	if policy.MaxErrorRatio <= 0 || policy.MaxErrorRatio > 1 {
+		policy.MaxErrorRatio = DEFAULT_MAX_ERROR_RATIO
+	}
+	if policy.Cooldown <= 0 {
+		policy.Cooldown = DEFAULT_EJECT_COOLDOWN
+	}
+	return policy
+}
+
+// 代表组件健康状况的摘要类型
+type HealthSummary struct {
+	// 是否健康，只有健康的组件才会被负载均衡器选中
+	Healthy bool `json:"healthy"`
+	// 统计窗口内的调用次数
+	Samples uint32 `json:"samples"`
+	// 统计窗口内失败的调用次数
+	Failures uint32 `json:"failures"`
+	// 统计窗口内的错误率
+	ErrorRatio float64 `json:"error_ratio"`
+	// 最近一次的错误信息
+	LastError string `json:"last_error,omitempty"`
+	// 被动移出的截止时间，未被移出时为空
+	EjectedUntil string `json:"ejected_until,omitempty"`
+}
+
+// 代表单个组件的健康状态
+type healthState struct {
+	// 最近调用结果的环形缓冲区，true代表失败
+	window []bool
+	// 下一个结果的写入位置
+	next int
+	// 窗口内已记录的调用次数
+	samples uint32
+	// 窗口内失败的调用次数
+	failures uint32
+	// 主动检查的结果，为nil时表示检查通过或未检查
+	checkErr error
+	// 最近一次的错误
+	lastErr error
+	// 被动移出的截止时间
+	ejectedUntil time.Time
+}
+
+// 用于判断组件在给定时刻是否健康
+func (state *healthState) healthy(now time.Time) bool {
+	return state.checkErr == nil && !now.Before(state.ejectedUntil)
+}
+
+// 用于把一次调用的结果记入统计窗口
+// 窗口大小变化时会清空已有的记录
+func (state *healthState) record(failed bool, windowSize uint32) {
+	if uint32(len(state.window)) != windowSize {
+		state.window = make([]bool, windowSize)
+		state.next = 0
+		state.samples = 0
+		state.failures = 0
+	}
+	if state.samples == windowSize {
+		if state.window[state.next] {
+			state.failures--
+		}
+	} else {
+		state.samples++
+	}
+	state.window[state.next] = failed
+	if failed {
+		state.failures++
+	}
+	state.next = (state.next + 1) % len(state.window)
+}
+
+// 用于获取统计窗口内的错误率
+func (state *healthState) errorRatio() float64 {
+	if state.samples == 0 {
+		return 0
+	}
+	return float64(state.failures) / float64(state.samples)
+}
+
+// 代表组件健康状况的跟踪器
+// 主动检查与被动统计分开记录，两者都正常时组件才是健康的
+type healthTracker struct {
+	// 代表健康策略
+	policy HealthPolicy
+	// 代表组件ID与健康状态的映射
+	states map[MID]*healthState
+	// 代表读写锁
+	rwLock sync.RWMutex
+}
+
+// 用于创建一个健康状况跟踪器
+func newHealthTracker(policy HealthPolicy) *healthTracker {
+	return &healthTracker{
+		policy: policy.normalize(),
+		states: map[MID]*healthState{},
+	}
+}
+
+// 用于设置健康策略
+func (tracker *healthTracker) setPolicy(policy HealthPolicy) {
+	tracker.rwLock.Lock()
+	defer tracker.rwLock.Unlock()
+	tracker.policy = policy.normalize()
+}
+
+// 用于获取给定组件的健康状态，不存在时会创建
+// 调用方需持有写锁
+func (tracker *healthTracker) state(mid MID) *healthState {
+	state, ok := tracker.states[mid]
+	if !ok {
+		state = &healthState{}
+		tracker.states[mid] = state
+	}
+	return state
+}
+
+// 用于记录一次调用的结果
+// 调用失败且窗口内的错误率达到阈值时，组件会被移出选择范围一段时间
+// 冷却期过后若错误率仍未降到阈值以下，再次失败时组件会立即被重新移出
+func (tracker *healthTracker) observe(mid MID, err error) {
+	tracker.rwLock.Lock()
+	defer tracker.rwLock.Unlock()
+	state := tracker.state(mid)
+	state.record(err != nil, tracker.policy.WindowSize)
+	overLimit := state.samples >= tracker.policy.MinSamples &&
+		state.errorRatio() >= tracker.policy.MaxErrorRatio
+	if err == nil {
+		if !overLimit {
+			state.ejectedUntil = time.Time{}
+		}
+		return
+	}
+	state.lastErr = err
+	if overLimit {
+		state.ejectedUntil = time.Now().Add(tracker.policy.Cooldown)
+	}
+}
+
+// 用于记录一次主动检查的结果
+func (tracker *healthTracker) recordCheck(mid MID, err error) {
+	tracker.rwLock.Lock()
+	defer tracker.rwLock.Unlock()
+	state := tracker.state(mid)
+	state.checkErr = err
+	if err != nil {
+		state.lastErr = err
+	}
+}
+
+// 用于判断给定组件是否健康
+func (tracker *healthTracker) healthy(mid MID, now time.Time) bool {
+	tracker.rwLock.RLock()
+	defer tracker.rwLock.RUnlock()
+	state, ok := tracker.states[mid]
+	if !ok {
+		return true
+	}
+	return state.healthy(now)
+}
+
+// 用于获取给定组件的健康状况摘要
+func (tracker *healthTracker) summary(mid MID) HealthSummary {
+	tracker.rwLock.RLock()
+	defer tracker.rwLock.RUnlock()
+	state, ok := tracker.states[mid]
+	if !ok {
+		return HealthSummary{Healthy: true}
+	}
+	now := time.Now()
+	summary := HealthSummary{
+		Healthy:    state.healthy(now),
+		Samples:    state.samples,
+		Failures:   state.failures,
+		ErrorRatio: state.errorRatio(),
+	}
+	if state.lastErr != nil {
+		summary.LastError = state.lastErr.Error()
+	}
+	if now.Before(state.ejectedUntil) {
+		summary.EjectedUntil = state.ejectedUntil.Format(time.RFC3339)
+	}
+	return summary
+}
+
+// 用于删除给定组件的健康状态
+func (tracker *healthTracker) remove(mid MID) {
+	tracker.rwLock.Lock()
+	defer tracker.rwLock.Unlock()
+	delete(tracker.states, mid)
+}
+
+// 用于清除所有组件的健康状态
+func (tracker *healthTracker) clear() {
+	tracker.rwLock.Lock()
+	defer tracker.rwLock.Unlock()
+	tracker.states = map[MID]*healthState{}
+}
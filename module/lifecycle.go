@@ -0,0 +1,22 @@
+package module
+
+// 组件可以选择性地实现以下生命周期接口
+// 调度器会在启动时调用Open，在运行期间定期调用Flush，并在停止时依次调用Flush和Close
+
+// 需要在调度器启动时进行准备的组件的接口类型
+type Opener interface {
+	// 用于打开组件所需的资源，如文件或连接
+	Open() error
+}
+
+// 需要定期刷新缓冲数据的组件的接口类型
+type Flusher interface {
+	// 用于把缓冲的数据写出
+	Flush() error
+}
+
+// 需要在调度器停止时进行收尾的组件的接口类型
+type Closer interface {
+	// 用于写出剩余的数据并释放组件所持有的资源
+	Close() error
+}
@@ -3,9 +3,15 @@ package analyzer
 import (
 	"../../../log"
 	"../../../module"
+	"../../../toolkit/charset"
 	"../../../toolkit/reader"
 	"../../stub"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
 )
 
 // logger 代表日志记录器。
@@ -13,42 +19,87 @@ var logger = log.DLogger()
 
 // 分析器的实现类型
 type myAnalyzer struct {
+	// 未匹配任何路由的响应的数量
+	// 以下计数器放在首位以保证原子操作所需的64位对齐
+	unmatchedCount uint64
+	// 在内存中缓存过的响应体的总字节数
+	bufferedBytes uint64
+	// 转存到临时文件的响应体的总字节数
+	spilledBytes uint64
+	// 转存到临时文件的响应体的数量
+	spilledCount uint64
+	// 因超出长度上限而未被解析的响应的数量
+	oversizeCount uint64
 	// 组件基础实例
 	stub.ModuleInternal
-	// 响应解析器列表
-	respParsers []module.ParseResponse
+	// 响应解析函数的路由规则列表
+	routes []Route
+	// 产出的条目的模式
+	schema *module.Schema
+	// 条目模式专用读写锁
+	schemaLock sync.RWMutex
+	// 可选参数
+	args Args
 }
 
 // 创建一个分析器实例
+// 所有响应解析函数都会被用于解析每一个响应
 func New(mid module.MID, respParsers []module.ParseResponse,
 	scoreCalculator module.CalculateScore) (module.Analyzer, error) {
-	moduleBase, err := stub.NewModuleInternal(mid, scoreCalculator)
-	if err != nil {
-		return nil, err
-	}
 	if respParsers == nil {
 		return nil, genParameterError("nil response parsers")
 	}
 	if len(respParsers) == 0 {
 		return nil, genParameterError("empty response parser list")
 	}
-	var innerParsers []module.ParseResponse
 	for i, parser := range respParsers {
 		if parser == nil {
 			return nil, genParameterError(fmt.Sprintf("nil response parser[%d]", i))
 		}
-		innerParsers = append(innerParsers, parser)
+	}
+	return NewWithRoutes(mid, []Route{{Parsers: respParsers}}, scoreCalculator)
+}
+
+// 用于创建一个按路由规则分派响应的分析器实例
+// 响应只会被交给与之匹配的路由的响应解析函数，未匹配任何路由的响应不会被读取
+func NewWithRoutes(mid module.MID, routes []Route,
+	scoreCalculator module.CalculateScore) (module.Analyzer, error) {
+	return NewWithArgs(mid, routes, Args{}, scoreCalculator)
+}
+
+// 用于创建一个按路由规则分派响应并使用给定可选参数的分析器实例
+func NewWithArgs(mid module.MID, routes []Route, args Args,
+	scoreCalculator module.CalculateScore) (module.Analyzer, error) {
+	if err := args.Check(); err != nil {
+		return nil, err
+	}
+	moduleBase, err := stub.NewModuleInternal(mid, scoreCalculator)
+	if err != nil {
+		return nil, err
+	}
+	if len(routes) == 0 {
+		return nil, genParameterError("空的路由规则列表")
+	}
+	innerRoutes := make([]Route, len(routes))
+	for i, route := range routes {
+		if err := route.check(i); err != nil {
+			return nil, err
+		}
+		route.Parsers = append([]module.ParseResponse(nil), route.Parsers...)
+		innerRoutes[i] = route
 	}
 	return &myAnalyzer{
 		ModuleInternal: moduleBase,
-		respParsers:    innerParsers,
+		routes:         innerRoutes,
+		args:           args,
 	}, nil
-
 }
 
 func (analyzer *myAnalyzer) RespParsers() []module.ParseResponse {
-	parsers := make([]module.ParseResponse, len(analyzer.respParsers))
-	copy(parsers, analyzer.respParsers)
+	var parsers []module.ParseResponse
+	for _, route := range analyzer.routes {
+		parsers = append(parsers, route.Parsers...)
+	}
 	return parsers
 }
 
@@ -77,27 +128,84 @@ func (analyzer *myAnalyzer) Analyze(resp *module.Response) (dataList []module.Da
 	}
 	analyzer.ModuleInternal.IncrAcceptedCount()
 	respDepth := resp.Depth()
+	if httpResp.Body != nil {
+		defer httpResp.Body.Close()
+	}
+	respParsers := analyzer.matchParsers(httpResp)
+	if len(respParsers) == 0 {
+		atomic.AddUint64(&analyzer.unmatchedCount, 1)
+		logger.Infof("没有与响应匹配的解析函数 (URL: %s, 状态码: %d, 内容类型: %q)",
+			reqURL, httpResp.StatusCode, httpResp.Header.Get("Content-Type"))
+		analyzer.ModuleInternal.IncrCompletedCount()
+		return nil, nil
+	}
 	logger.Infof("分析器正在解析响应 (URL: %s, 深度: %d)... \n", reqURL, respDepth)
 
-	// 解析HTTP响应
+	// 把文本内容转码为UTF-8
+	var body io.Reader
 	if httpResp.Body != nil {
-		defer httpResp.Body.Close()
+		body = httpResp.Body
+	}
+	contentType := httpResp.Header.Get("Content-Type")
+	textType := contentType
+	if body != nil && contentType == "" {
+		sniffed, mediaType, err := charset.Sniff(body)
+		if err != nil {
+			errorList = append(errorList, genError(err.Error()))
+			return
+		}
+		body = sniffed
+		textType = mediaType
+	}
+	if body != nil && charset.IsText(textType) {
+		utf8Reader, result, err := charset.NewUTF8Reader(body, contentType, charset.DEFAULT_FALLBACK)
+		if err != nil {
+			errorList = append(errorList, genError(err.Error()))
+			return
+		}
+		body = utf8Reader
+		resp.SetCharset(result.Name)
+		if httpResp.Header == nil {
+			httpResp.Header = http.Header{}
+		}
+		httpResp.Header.Set(charset.HEADER_ORIGINAL_CHARSET, result.Name)
+		if contentType != "" {
+			httpResp.Header.Set("Content-Type", charset.ToUTF8ContentType(contentType))
+		}
+		logger.Infof("响应内容的字符集为%s (URL: %s, 确定: %v)", result.Name, reqURL, result.Certain)
 	}
-	multipleReader, err := reader.NewMultipleReader(httpResp.Body)
+
+	// 解析HTTP响应
+	multipleReader, err := reader.NewMultipleReaderWithOptions(body, analyzer.args.readerOptions())
 	if err != nil {
+		if _, ok := err.(*reader.TooLargeError); ok {
+			atomic.AddUint64(&analyzer.oversizeCount, 1)
+			err = fmt.Errorf("%s (URL: %s)", err, reqURL)
+		}
 		errorList = append(errorList, genError(err.Error()))
 		return
 	}
+	defer multipleReader.Close()
+	if multipleReader.Spilled() {
+		atomic.AddUint64(&analyzer.spilledBytes, uint64(multipleReader.Size()))
+		atomic.AddUint64(&analyzer.spilledCount, 1)
+	} else {
+		atomic.AddUint64(&analyzer.bufferedBytes, uint64(multipleReader.Size()))
+	}
 	dataList = []module.Data{}
-	for _, respParser := range analyzer.respParsers {
-		httpResp.Body = multipleReader.Reader()
+	for _, respParser := range respParsers {
+		body := &parserBody{ReadCloser: multipleReader.Reader()}
+		httpResp.Body = body
 		pDataList, pErrorList := respParser(httpResp, respDepth)
+		if !body.taken {
+			body.Close()
+		}
 		if pDataList != nil {
 			for _, pData := range pDataList {
 				if pData == nil {
 					continue
 				}
-				dataList = appendDataList(dataList, pData, respDepth)
+				dataList = appendDataList(dataList, pData, respDepth, reqURL)
 			}
 		}
 		if pErrorList != nil {
@@ -116,7 +224,9 @@ func (analyzer *myAnalyzer) Analyze(resp *module.Response) (dataList []module.Da
 }
 
 // 用于添加请求值或条目到列表
-func appendDataList(dataList []module.Data, data module.Data, respDepth uint32) []module.Data {
+// 请求的父请求URL未设置时会被设置为响应对应的请求的URL
+func appendDataList(dataList []module.Data, data module.Data,
+	respDepth uint32, parent *url.URL) []module.Data {
 	if data == nil {
 		return dataList
 	}
@@ -126,7 +236,35 @@ func appendDataList(dataList []module.Data, data module.Data, respDepth uint32)
 	}
 	newDepth := respDepth + 1
 	if req.Depth() != newDepth {
-		req = module.NewRequest(req.HTTPReq(), newDepth)
+		newReq := module.NewRequest(req.HTTPReq(), newDepth)
+		newReq.SetParent(req.Parent())
+		req = newReq
+	}
+	if req.Parent() == nil {
+		req.SetParent(parent)
 	}
 	return append(dataList, req)
 }
+
+// 代表分析器额外信息的摘要类型
+type extraSummaryStruct struct {
+	RouteNumber    int    `json:"route_number"`
+	UnmatchedCount uint64 `json:"unmatched_count"`
+	BufferedBytes  uint64 `json:"buffered_bytes"`
+	SpilledBytes   uint64 `json:"spilled_bytes"`
+	SpilledCount   uint64 `json:"spilled_count"`
+	OversizeCount  uint64 `json:"oversize_count"`
+}
+
+func (analyzer *myAnalyzer) Summary() module.SummaryStruct {
+	summary := analyzer.ModuleInternal.Summary()
+	summary.Extra = extraSummaryStruct{
+		RouteNumber:    len(analyzer.routes),
+		UnmatchedCount: atomic.LoadUint64(&analyzer.unmatchedCount),
+		BufferedBytes:  atomic.LoadUint64(&analyzer.bufferedBytes),
+		SpilledBytes:   atomic.LoadUint64(&analyzer.spilledBytes),
+		SpilledCount:   atomic.LoadUint64(&analyzer.spilledCount),
+		OversizeCount:  atomic.LoadUint64(&analyzer.oversizeCount),
+	}
+	return summary
+}
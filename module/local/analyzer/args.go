@@ -0,0 +1,39 @@
+package analyzer
+
+import (
+	"fmt"
+
+	"../../../toolkit/reader"
+)
+
+// 代表分析器的可选参数的容器类型
+type Args struct {
+	// MaxBodySize 代表响应体的最大长度（字节）
+	// 超出该长度的响应不会被解析，为0时不限制
+	MaxBodySize int64
+	// MemoryThreshold 代表在内存中缓存的响应体的最大长度（字节）
+	// 超出该长度的响应体会被转存到临时文件，为0时不转存
+	MemoryThreshold int64
+	// TempDir 代表临时文件所在的目录，为空时使用系统默认的临时目录
+	TempDir string
+}
+
+// 用于自检参数的有效性
+func (args *Args) Check() error {
+	if args.MaxBodySize < 0 {
+		return genParameterError(fmt.Sprintf("无效的响应体最大长度: %d", args.MaxBodySize))
+	}
+	if args.MemoryThreshold < 0 {
+		return genParameterError(fmt.Sprintf("无效的内存缓存长度: %d", args.MemoryThreshold))
+	}
+	return nil
+}
+
+// 用于生成多重读取器的参数
+func (args *Args) readerOptions() reader.Options {
+	return reader.Options{
+		MaxSize:         args.MaxBodySize,
+		MemoryThreshold: args.MemoryThreshold,
+		TempDir:         args.TempDir,
+	}
+}
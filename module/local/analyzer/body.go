@@ -0,0 +1,28 @@
+package analyzer
+
+import (
+	"io"
+	"net/http"
+)
+
+// 代表交给解析函数的响应体
+// 解析函数返回后，未被取走的响应体会由分析器关闭
+type parserBody struct {
+	io.ReadCloser
+	// 是否已被解析函数取走
+	taken bool
+}
+
+// 用于从响应中取走响应体，供解析函数放入条目等在解析结束后继续使用
+// 取走的响应体不会在解析函数返回后被分析器关闭，由取走方负责关闭
+// 分析器之外的响应体会被原样返回
+func TakeBody(httpResp *http.Response) io.ReadCloser {
+	if httpResp == nil {
+		return nil
+	}
+	if body, ok := httpResp.Body.(*parserBody); ok {
+		body.taken = true
+		return body.ReadCloser
+	}
+	return httpResp.Body
+}
@@ -0,0 +1,116 @@
+package analyzer
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"../../../module"
+)
+
+// 代表响应解析函数的路由规则
+// 只有同时满足各项条件的响应才会被交给该规则的响应解析函数
+type Route struct {
+	// 匹配的MIME类型，如"text/html"或"image/*"，为空时匹配所有类型
+	MIMETypes []string
+	// 匹配的URL正则表达式，为nil时匹配所有URL
+	URLPattern *regexp.Regexp
+	// 匹配的状态码，为空时匹配所有状态码
+	StatusCodes []int
+	// 响应匹配时依次使用的响应解析函数
+	Parsers []module.ParseResponse
+}
+
+// 用于检查路由规则的有效性
+func (route *Route) check(index int) error {
+	if len(route.Parsers) == 0 {
+		return genParameterError(fmt.Sprintf("路由[%d]的响应解析函数列表为空", index))
+	}
+	for i, parser := range route.Parsers {
+		if parser == nil {
+			return genParameterError(fmt.Sprintf("路由[%d]的响应解析函数[%d]为空", index, i))
+		}
+	}
+	for _, mimeType := range route.MIMETypes {
+		if strings.Count(mimeType, "/") != 1 {
+			return genParameterError(fmt.Sprintf("路由[%d]的MIME类型无效: %q", index, mimeType))
+		}
+	}
+	return nil
+}
+
+// 用于判断给定的响应是否匹配该路由
+func (route *Route) match(httpResp *http.Response, mediaType string) bool {
+	if len(route.StatusCodes) > 0 {
+		var matched bool
+		for _, code := range route.StatusCodes {
+			if code == httpResp.StatusCode {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if route.URLPattern != nil &&
+		!route.URLPattern.MatchString(httpResp.Request.URL.String()) {
+		return false
+	}
+	if len(route.MIMETypes) > 0 {
+		var matched bool
+		for _, mimeType := range route.MIMETypes {
+			if matchMIMEType(strings.ToLower(mimeType), mediaType) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// 用于判断媒体类型是否匹配给定的MIME类型模式
+// 模式支持"*/*"以及"type/*"形式的通配
+func matchMIMEType(pattern string, mediaType string) bool {
+	if mediaType == "" {
+		return false
+	}
+	if pattern == "*/*" || pattern == mediaType {
+		return true
+	}
+	if strings.HasSuffix(pattern, "/*") {
+		return strings.HasPrefix(mediaType, strings.TrimSuffix(pattern, "*"))
+	}
+	return false
+}
+
+// 用于获取响应的媒体类型（小写且不含参数），无法获取时为空
+func mediaTypeOf(httpResp *http.Response) string {
+	contentType := httpResp.Header.Get("Content-Type")
+	if contentType == "" {
+		return ""
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(mediaType)
+}
+
+// 用于获取与给定响应匹配的所有响应解析函数
+// 多个路由匹配时，按路由的顺序合并它们的响应解析函数
+func (analyzer *myAnalyzer) matchParsers(httpResp *http.Response) []module.ParseResponse {
+	mediaType := mediaTypeOf(httpResp)
+	var parsers []module.ParseResponse
+	for i := range analyzer.routes {
+		if analyzer.routes[i].match(httpResp, mediaType) {
+			parsers = append(parsers, analyzer.routes[i].Parsers...)
+		}
+	}
+	return parsers
+}
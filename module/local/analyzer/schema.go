@@ -0,0 +1,21 @@
+package analyzer
+
+import "../../../module"
+
+func (analyzer *myAnalyzer) Schema() *module.Schema {
+	analyzer.schemaLock.RLock()
+	defer analyzer.schemaLock.RUnlock()
+	return analyzer.schema
+}
+
+func (analyzer *myAnalyzer) SetSchema(schema *module.Schema) error {
+	if schema != nil {
+		if err := schema.Check(); err != nil {
+			return genParameterError(err.Error())
+		}
+	}
+	analyzer.schemaLock.Lock()
+	defer analyzer.schemaLock.Unlock()
+	analyzer.schema = schema
+	return nil
+}
@@ -0,0 +1,115 @@
+package downloader
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"../../../toolkit/cookie"
+	"../../../toolkit/proxy"
+	"../../../toolkit/recrawl"
+)
+
+// 代表下载器的可选参数的容器类型
+type Args struct {
+	// RecrawlStore 代表增量爬取的状态存储
+	// 不为nil时，下载器会发送条件请求并跳过未变化的页面
+	RecrawlStore recrawl.Store
+	// RecrawlHashLimit 代表增量爬取时计算内容摘要的响应体的最大长度（字节）
+	// 为0时使用DEFAULT_RECRAWL_HASH_LIMIT，更长的响应体总被视为有变化
+	RecrawlHashLimit int64
+	// RecrawlListingPatterns 代表列表页URL的正则表达式
+	// 列表页不发送条件请求，且即使内容未变化也会被分析，以便重新提取其中的链接
+	RecrawlListingPatterns []string
+	// HealthCheckURL 代表健康检查时访问的URL
+	// 为空时下载器的健康检查总会通过
+	HealthCheckURL string
+	// ProxyPool 代表代理池
+	// 不为nil时，下载器会经由代理池中的代理发送请求
+	// 健康检查URL不为空时，健康检查会逐一检查代理池中的代理
+	ProxyPool proxy.Pool
+	// HeaderProfiles 代表请求头配置的列表
+	// 不为空时，下载器会按轮换方式为每个请求选用一个配置
+	HeaderProfiles []HeaderProfile
+	// HeaderRotation 代表请求头配置的轮换方式，为空时使用HEADER_ROTATE_PER_REQUEST
+	HeaderRotation HeaderRotation
+	// CookieJar 代表Cookie容器
+	// 不为nil时会替换HTTP客户端的Cookie容器，并在刷新和关闭下载器时被持久化
+	CookieJar cookie.Jar
+	// LoginScripts 代表各主机的登录脚本
+	// 下载器会在首次请求某个主机前执行其登录脚本，并在检测到登出时重新登录
+	LoginScripts []LoginScript
+	// LoginTimeout 代表单个登录步骤的超时时间，为0时使用DEFAULT_LOGIN_TIMEOUT
+	LoginTimeout time.Duration
+	// Middlewares 代表包裹在下载过程外层的中间件，排在前面的位于外层
+	Middlewares []Middleware
+	// SchemeHandlers 代表协议（小写形式）与协议处理器的映射
+	// 下载器默认只支持http和https，出于安全考虑，file协议需要显式注册
+	SchemeHandlers map[string]SchemeHandler
+	// MaxRedirects 代表单个请求的最大重定向次数，为0时使用DEFAULT_MAX_REDIRECTS
+	// 重定向由下载器自行跟随，每一跳都会经过调度器的爬取范围检查
+	MaxRedirects uint32
+	// DomainConfigs 代表各域的TLS与认证配置
+	// 下载器会为有TLS配置的域使用专用的Transport，并自动为请求设置相应的认证请求头
+	DomainConfigs []DomainConfig
+}
+
+// 用于自检参数的有效性
+func (args *Args) Check() error {
+	if args.HealthCheckURL != "" {
+		u, err := url.Parse(args.HealthCheckURL)
+		if err != nil || !u.IsAbs() {
+			return genParameterError(fmt.Sprintf("无效的健康检查URL: %q", args.HealthCheckURL))
+		}
+	}
+	if args.RecrawlHashLimit < 0 {
+		return genParameterError(fmt.Sprintf("无效的内容摘要长度限制: %d", args.RecrawlHashLimit))
+	}
+	for i, pattern := range args.RecrawlListingPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return genParameterError(fmt.Sprintf("无效的列表页URL正则表达式[%d]: %s", i, err))
+		}
+	}
+	switch args.HeaderRotation {
+	case "", HEADER_ROTATE_PER_REQUEST, HEADER_ROTATE_PER_HOST:
+	default:
+		return genParameterError(fmt.Sprintf("不支持的请求头配置轮换方式: %s", args.HeaderRotation))
+	}
+	for i := range args.HeaderProfiles {
+		if err := args.HeaderProfiles[i].check(i); err != nil {
+			return err
+		}
+	}
+	for i, middleware := range args.Middlewares {
+		if middleware == nil {
+			return genParameterError(fmt.Sprintf("空的中间件[%d]", i))
+		}
+	}
+	for scheme, handler := range args.SchemeHandlers {
+		if scheme == "" || scheme != strings.ToLower(scheme) {
+			return genParameterError(fmt.Sprintf("无效的协议名称: %q", scheme))
+		}
+		if scheme == "http" || scheme == "https" {
+			return genParameterError(fmt.Sprintf("不能为协议%s注册协议处理器", scheme))
+		}
+		if handler == nil {
+			return genParameterError(fmt.Sprintf("空的协议处理器 (协议: %s)", scheme))
+		}
+	}
+	for i := range args.DomainConfigs {
+		if err := args.DomainConfigs[i].check(i); err != nil {
+			return err
+		}
+	}
+	if args.LoginTimeout < 0 {
+		return genParameterError(fmt.Sprintf("无效的登录超时时间: %s", args.LoginTimeout))
+	}
+	for i := range args.LoginScripts {
+		if err := args.LoginScripts[i].check(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package downloader
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// 当前支持的认证方式的常量
+const (
+	// HTTP基本认证
+	AUTH_BASIC = "basic"
+	// Bearer令牌
+	AUTH_BEARER = "bearer"
+	// 自定义请求头
+	AUTH_HEADER = "header"
+)
+
+// 代表某个域的TLS配置的类型
+type TLSConfig struct {
+	// CA证书文件（PEM格式）的路径，其中的证书会被加入系统的根证书列表
+	CAFile string `json:"ca_file"`
+	// 客户端证书文件（PEM格式）的路径
+	CertFile string `json:"cert_file"`
+	// 客户端私钥文件（PEM格式）的路径
+	KeyFile string `json:"key_file"`
+	// TLS的最低版本，可选值为1.0、1.1、1.2和1.3，为空时使用Go的默认值
+	MinVersion string `json:"min_version"`
+	// 是否跳过服务端证书的验证，仅应用于测试环境
+	InsecureSkipVerify bool `json:"insecure_skip_verify"`
+}
+
+// 用于生成tls.Config
+func (config *TLSConfig) build() (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+	switch config.MinVersion {
+	case "":
+	case "1.0":
+		tlsConfig.MinVersion = tls.VersionTLS10
+	case "1.1":
+		tlsConfig.MinVersion = tls.VersionTLS11
+	case "1.2":
+		tlsConfig.MinVersion = tls.VersionTLS12
+	case "1.3":
+		tlsConfig.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("不支持的TLS版本: %q", config.MinVersion)
+	}
+	if config.CAFile != "" {
+		pem, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取CA证书文件出现异常: %s", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA证书文件中没有有效的证书 (path: %s)", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if config.CertFile != "" || config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("载入客户端证书出现异常: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// 代表某个域的认证配置的类型
+// 密码、令牌和请求头的值中的${VAR}会被替换为环境变量的值
+type AuthConfig struct {
+	// 认证方式，可选值为basic、bearer和header
+	Type string `json:"type"`
+	// 用户名，用于basic
+	Username string `json:"username"`
+	// 密码，用于basic
+	Password string `json:"password"`
+	// 令牌，用于bearer
+	Token string `json:"token"`
+	// 请求头的名称，用于header
+	Header string `json:"header"`
+	// 请求头的值，用于header
+	Value string `json:"value"`
+}
+
+// 用于自检认证配置的有效性
+func (config *AuthConfig) check() error {
+	switch config.Type {
+	case AUTH_BASIC:
+		if config.Username == "" {
+			return fmt.Errorf("basic认证缺少用户名")
+		}
+	case AUTH_BEARER:
+		if config.Token == "" {
+			return fmt.Errorf("bearer认证缺少令牌")
+		}
+	case AUTH_HEADER:
+		if config.Header == "" {
+			return fmt.Errorf("header认证缺少请求头的名称")
+		}
+	default:
+		return fmt.Errorf("不支持的认证方式: %q", config.Type)
+	}
+	return nil
+}
+
+// 用于把认证信息写入请求头，请求中已有的认证请求头不会被覆盖
+func (config *AuthConfig) apply(httpReq *http.Request) {
+	switch config.Type {
+	case AUTH_BASIC:
+		if httpReq.Header.Get("Authorization") == "" {
+			httpReq.SetBasicAuth(config.Username, os.ExpandEnv(config.Password))
+		}
+	case AUTH_BEARER:
+		setDefault(httpReq.Header, "Authorization", "Bearer "+os.ExpandEnv(config.Token))
+	case AUTH_HEADER:
+		setDefault(httpReq.Header, config.Header, os.ExpandEnv(config.Value))
+	}
+}
+
+// 代表某个域的配置的类型
+type DomainConfig struct {
+	// 域名，会匹配该域名本身及其所有子域名
+	// 多个配置都匹配时，使用域名最长的那个
+	Domain string `json:"domain"`
+	// TLS配置，为nil时使用HTTP客户端的默认配置
+	TLS *TLSConfig `json:"tls"`
+	// 认证配置，为nil时不设置认证请求头
+	Auth *AuthConfig `json:"auth"`
+}
+
+// 用于自检域配置的有效性
+func (config *DomainConfig) check(index int) error {
+	if config.Domain == "" {
+		return genParameterError(fmt.Sprintf("域配置[%d]缺少域名", index))
+	}
+	if config.Auth != nil {
+		if err := config.Auth.check(); err != nil {
+			return genParameterError(fmt.Sprintf("域配置[%d]中%s (域名: %s)", index, err, config.Domain))
+		}
+	}
+	return nil
+}
+
+// 用于判断域配置是否适用于给定的主机名
+func (config *DomainConfig) match(host string) bool {
+	domain := strings.ToLower(config.Domain)
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// 用于从JSON文件中加载域配置列表
+func LoadDomainConfigs(path string) ([]DomainConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, genError(fmt.Sprintf("读取域配置文件出现异常: %s (path: %s)", err, path))
+	}
+	var configs []DomainConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, genError(fmt.Sprintf("解析域配置文件出现异常: %s (path: %s)", err, path))
+	}
+	return configs, nil
+}
+
+// 代表按域名选择配置的类型
+type domainConfigs struct {
+	// 域配置的列表
+	configs []DomainConfig
+}
+
+// 用于创建域配置的选择器，参数configs为空时返回nil
+func newDomainConfigs(configs []DomainConfig) *domainConfigs {
+	if len(configs) == 0 {
+		return nil
+	}
+	return &domainConfigs{configs: append([]DomainConfig(nil), configs...)}
+}
+
+// 用于获取适用于给定主机名的域配置，没有时返回nil
+func (dc *domainConfigs) lookup(host string) *DomainConfig {
+	if dc == nil {
+		return nil
+	}
+	host = strings.ToLower(host)
+	var matched *DomainConfig
+	for i := range dc.configs {
+		config := &dc.configs[i]
+		if config.match(host) && (matched == nil || len(config.Domain) > len(matched.Domain)) {
+			matched = config
+		}
+	}
+	return matched
+}
+
+// 用于把适用的认证配置应用到请求
+func (dc *domainConfigs) applyAuth(httpReq *http.Request) {
+	config := dc.lookup(httpReq.URL.Hostname())
+	if config == nil || config.Auth == nil {
+		return
+	}
+	config.Auth.apply(httpReq)
+}
+
+// 用于从跨主机的重定向请求中删除来源主机的自定义认证请求头
+func (dc *domainConfigs) stripAuth(next *http.Request, from *url.URL) {
+	if strings.EqualFold(next.URL.Hostname(), from.Hostname()) {
+		return
+	}
+	config := dc.lookup(from.Hostname())
+	if config == nil || config.Auth == nil || config.Auth.Type != AUTH_HEADER {
+		return
+	}
+	next.Header.Del(config.Auth.Header)
+}
+
+// 代表按域名选用不同Transport的RoundTripper的实现类型
+type domainTransport struct {
+	// 域配置
+	configs *domainConfigs
+	// 域名与Transport的映射，只包含有TLS配置的域
+	transports map[string]http.RoundTripper
+	// 默认的Transport
+	base http.RoundTripper
+}
+
+func (t *domainTransport) RoundTrip(httpReq *http.Request) (*http.Response, error) {
+	if config := t.configs.lookup(httpReq.URL.Hostname()); config != nil {
+		if transport, ok := t.transports[config.Domain]; ok {
+			return transport.RoundTrip(httpReq)
+		}
+	}
+	return t.base.RoundTrip(httpReq)
+}
+
+// 用于为有TLS配置的域生成专用的Transport
+// 专用的Transport复制自HTTP客户端的Transport，因此代理等设置会被保留
+func withDomainTransport(client http.Client, configs *domainConfigs) (http.Client, error) {
+	transports := map[string]http.RoundTripper{}
+	for _, config := range configs.configs {
+		if config.TLS == nil {
+			continue
+		}
+		var transport *http.Transport
+		switch t := client.Transport.(type) {
+		case nil:
+			transport = http.DefaultTransport.(*http.Transport).Clone()
+		case *http.Transport:
+			transport = t.Clone()
+		default:
+			return client, genParameterError(fmt.Sprintf("使用域TLS配置时不支持的Transport类型: %T", t))
+		}
+		tlsConfig, err := config.TLS.build()
+		if err != nil {
+			return client, genParameterError(fmt.Sprintf("%s (域名: %s)", err, config.Domain))
+		}
+		if config.TLS.InsecureSkipVerify {
+			logger.Warnf("已跳过服务端证书的验证 (域名: %s)", config.Domain)
+		}
+		transport.TLSClientConfig = tlsConfig
+		transports[config.Domain] = transport
+	}
+	if len(transports) == 0 {
+		return client, nil
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client.Transport = &domainTransport{
+		configs:    configs,
+		transports: transports,
+		base:       base,
+	}
+	return client, nil
+}
@@ -1,10 +1,14 @@
 package downloader
 
 import (
+	"fmt"
 	"net/http"
 
 	"../../../log"
 	"../../../module"
+	"../../../toolkit/cookie"
+	"../../../toolkit/proxy"
+	"../../../toolkit/recrawl"
 	"../../stub"
 )
 
@@ -17,10 +21,42 @@ type myDownloader struct {
 	stub.ModuleInternal
 	// 代表下载用的HTTP客户端
 	httpClient http.Client
+	// 代表增量爬取的状态存储
+	recrawlStore recrawl.Store
+	// 代表增量爬取的计数
+	recrawlCounts recrawlCounts
+	// 代表增量爬取的策略
+	recrawlPolicy recrawlPolicy
+	// 代表健康检查时访问的URL
+	healthCheckURL string
+	// 代表代理池
+	proxyPool proxy.Pool
+	// 代表请求头配置轮换器，为nil时不设置请求头
+	headerRotator *headerRotator
+	// 代表Cookie容器
+	cookieJar cookie.Jar
+	// 代表会话管理器，为nil时不需要登录
+	sessions *sessionManager
+	// 代表包裹了所有中间件的下载处理函数
+	handler Handler
+	// 代表协议与协议处理器的映射
+	schemeHandlers map[string]SchemeHandler
+	// 代表重定向控制器
+	redirector *redirector
+	// 代表各域的配置，为nil时没有域配置
+	domains *domainConfigs
+	// 代表未变化的响应的录制目标，为nil时不录制
+	notModifiedWriter ExchangeWriter
 }
 
 // 用于创建一个下载器实例
 func New(mid module.MID, client *http.Client, scoreCalculator module.CalculateScore) (module.Downloader, error) {
+	return NewWithArgs(mid, client, Args{}, scoreCalculator)
+}
+
+// 用于根据给定的可选参数创建一个下载器实例
+func NewWithArgs(mid module.MID, client *http.Client, args Args,
+	scoreCalculator module.CalculateScore) (module.Downloader, error) {
 	moduleBase, err := stub.NewModuleInternal(mid, scoreCalculator)
 	if err != nil {
 		return nil, err
@@ -28,10 +64,54 @@ func New(mid module.MID, client *http.Client, scoreCalculator module.CalculateSc
 	if client == nil {
 		return nil, genParameterError("空HTTP客户端")
 	}
-	return &myDownloader{
+	if err := args.Check(); err != nil {
+		return nil, err
+	}
+	httpClient := *client
+	if args.ProxyPool != nil {
+		if httpClient, err = withProxyTransport(httpClient); err != nil {
+			return nil, err
+		}
+	}
+	domains := newDomainConfigs(args.DomainConfigs)
+	if domains != nil {
+		if httpClient, err = withDomainTransport(httpClient, domains); err != nil {
+			return nil, err
+		}
+	}
+	cookieJar := args.CookieJar
+	if cookieJar == nil && len(args.LoginScripts) > 0 && httpClient.Jar == nil {
+		if cookieJar, err = cookie.NewFileJar(""); err != nil {
+			return nil, genError(fmt.Sprintf("创建Cookie容器失败: %s", err))
+		}
+	}
+	if cookieJar != nil {
+		httpClient.Jar = cookieJar
+	}
+	var clientPolicy RedirectPolicy
+	if httpClient.CheckRedirect != nil {
+		clientPolicy = httpClient.CheckRedirect
+	}
+	httpClient.CheckRedirect = stopRedirect
+	downloader := &myDownloader{
 		ModuleInternal: moduleBase,
-		httpClient:     *client,
-	}, nil
+		httpClient:     httpClient,
+		recrawlStore:   args.RecrawlStore,
+		recrawlPolicy:  newRecrawlPolicy(args),
+		healthCheckURL: args.HealthCheckURL,
+		proxyPool:      args.ProxyPool,
+		headerRotator:  newHeaderRotator(args.HeaderProfiles, args.HeaderRotation),
+		cookieJar:      cookieJar,
+		sessions:       newSessionManager(args.LoginScripts, args.LoginTimeout),
+		schemeHandlers: map[string]SchemeHandler{},
+		redirector:     newRedirector(args.MaxRedirects, clientPolicy),
+		domains:        domains,
+	}
+	for scheme, handler := range args.SchemeHandlers {
+		downloader.schemeHandlers[scheme] = handler
+	}
+	downloader.handler = Chain(args.Middlewares...)(downloader.fetch)
+	return downloader, nil
 }
 
 func (downloader *myDownloader) Download(req *module.Request) (*module.Response, error) {
@@ -47,10 +127,109 @@ func (downloader *myDownloader) Download(req *module.Request) (*module.Response,
 	}
 	downloader.ModuleInternal.IncrAcceptedCount()
 	logger.Infof("下载器正在进行请求 (URL: %s, depth: %d)... \n", httpReq.URL, req.Depth())
-	httpResp, err := downloader.httpClient.Do(httpReq)
+	resp, err := downloader.handler(req)
 	if err != nil {
 		return nil, err
 	}
 	downloader.ModuleInternal.IncrCompletedCount()
-	return module.NewResponse(httpResp, req.Depth()), nil
+	return resp, nil
+}
+
+// 用于下载给定的请求，是中间件链的最内层
+// 结果值均为nil时表示页面未变化，不需要分析
+func (downloader *myDownloader) fetch(req *module.Request) (*module.Response, error) {
+	httpReq := req.HTTPReq()
+	if downloader.headerRotator != nil {
+		downloader.headerRotator.pick(httpReq.URL.Host).apply(httpReq, req.Parent())
+	}
+	listing := downloader.recrawlPolicy.isListing(httpReq.URL.String())
+	if downloader.recrawlStore != nil && !listing {
+		setConditionalHeaders(httpReq, downloader.recrawlStore)
+	}
+	session := downloader.sessions.session(httpReq.URL)
+	if session != nil {
+		if err := downloader.login(session, false); err != nil {
+			return nil, err
+		}
+		httpReq = withProxy(httpReq, session.proxy())
+	}
+	httpResp, chain, err := downloader.do(httpReq)
+	if err == nil && session != nil && session.loggedOut(httpResp) && replayable(httpReq) {
+		logger.Infof("检测到会话已登出，重新登录 (URL: %s)\n", httpReq.URL)
+		closeBody(httpResp)
+		if err := downloader.login(session, true); err != nil {
+			return nil, err
+		}
+		retry, err := replay(httpReq)
+		if err != nil {
+			return nil, genError(fmt.Sprintf("重新发送请求失败: %s", err))
+		}
+		httpResp, chain, err = downloader.do(retry)
+	}
+	if err != nil {
+		if _, ok := err.(*RedirectOutOfScopeError); ok {
+			logger.Infof("%s，跳过分析 (URL: %s)\n", err, httpReq.URL)
+			return nil, nil
+		}
+		return nil, err
+	}
+	if downloader.recrawlStore != nil {
+		changed, err := checkChanged(httpReq, httpResp, downloader.recrawlStore,
+			&downloader.recrawlCounts, downloader.recrawlPolicy.hashLimit)
+		if err != nil {
+			return nil, err
+		}
+		if !changed && listing {
+			logger.Infof("列表页未变化，仍然分析以提取链接 (URL: %s)\n", httpReq.URL)
+		} else if !changed {
+			logger.Infof("页面未变化，跳过分析 (URL: %s)\n", httpReq.URL)
+			downloader.recordUnchanged(httpReq, httpResp)
+			return nil, nil
+		}
+	}
+	resp := module.NewResponse(httpResp, req.Depth())
+	resp.SetRedirectChain(chain)
+	return resp, nil
+}
+
+// 用于经由代理池（若有）发送请求
+// 非HTTP协议的请求会被交给相应的协议处理器
+// 认证请求头会在每一跳发送前按目标主机设置
+func (downloader *myDownloader) send(httpReq *http.Request) (*http.Response, error) {
+	if handler := downloader.schemeHandler(httpReq); handler != nil {
+		return handler.RoundTrip(httpReq)
+	}
+	// 认证信息只加在这一跳的副本上，以免泄露到原请求及由其派生的请求中
+	httpReq = httpReq.Clone(httpReq.Context())
+	downloader.domains.applyAuth(httpReq)
+	httpReq, proxyURL, err := downloader.pickProxy(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	httpResp, err := downloader.httpClient.Do(httpReq)
+	downloader.observeProxy(proxyURL, httpResp, err)
+	return httpResp, err
+}
+
+// 代表下载器额外信息的摘要类型
+// 未使用代理池时不包含代理池的摘要
+type extraSummaryStruct struct {
+	Recrawl  recrawlSummaryStruct  `json:"recrawl"`
+	Redirect redirectSummaryStruct `json:"redirect"`
+	Proxy    *proxy.Summary        `json:"proxy,omitempty"`
+}
+
+func (downloader *myDownloader) Summary() module.SummaryStruct {
+	summary := downloader.ModuleInternal.Summary()
+	extra := extraSummaryStruct{
+		Redirect: downloader.redirector.summary(),
+	}
+	if downloader.recrawlStore != nil {
+		extra.Recrawl = downloader.recrawlCounts.summary()
+	}
+	if downloader.proxyPool != nil {
+		extra.Proxy = downloader.proxyPool.Summary()
+	}
+	summary.Extra = extra
+	return summary
 }
@@ -0,0 +1,133 @@
+package downloader
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"../../../module"
+	"../../../toolkit/warc"
+)
+
+// 代表录制文件的扩展名
+const fixtureExt = ".http"
+
+// 用于生成请求对应的录制文件名
+// 文件名是回放键（见replayKey）的SHA-1摘要，同一请求总是对应同一文件
+func fixtureName(httpReq *http.Request, body []byte) string {
+	sum := sha1.Sum([]byte(replayKey(httpReq.Method, httpReq.URL.String(), body)))
+	return hex.EncodeToString(sum[:]) + fixtureExt
+}
+
+// 代表把响应录制到目录中的写入器的实现类型
+// 每个响应保存为一个文件，内容是原样的HTTP响应报文
+type fixtureWriter struct {
+	// 代表录制目录
+	dir string
+	// 代表已写入的文件数量
+	count uint64
+}
+
+// 用于创建一个录制下载器
+// 该下载器下载成功的每一个响应都会被保存到给定目录中，
+// 供NewFixtureSource创建的回放数据源使用
+func NewFixtureRecorder(downloader module.Downloader, dir string) (module.Downloader, error) {
+	return NewFixtureRecorderWithArgs(downloader, dir, RecorderArgs{})
+}
+
+// 用于根据给定的可选参数创建一个录制下载器
+func NewFixtureRecorderWithArgs(downloader module.Downloader, dir string,
+	args RecorderArgs) (module.Downloader, error) {
+	if dir == "" {
+		return nil, genParameterError("空的录制目录")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, genError("创建录制目录出现异常: " + err.Error())
+	}
+	return newRecorder(downloader, &fixtureWriter{dir: dir}, args)
+}
+
+// 未变化（304）的响应不会覆盖已录制的完整响应
+func (writer *fixtureWriter) WriteExchange(httpReq *http.Request, reqBody []byte,
+	httpResp *http.Response, respBody warc.Body) error {
+	path := filepath.Join(writer.dir, fixtureName(httpReq, reqBody))
+	if httpResp.StatusCode == http.StatusNotModified {
+		if _, err := os.Stat(path); err == nil {
+			return nil
+		}
+	}
+	record, err := warc.NewResponseRecord(httpResp, respBody, time.Now())
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := writeFixture(tmpPath, record); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	atomic.AddUint64(&writer.count, 1)
+	return nil
+}
+
+// 用于把记录块（即原样的HTTP响应报文）写入给定文件
+func writeFixture(path string, record *warc.Record) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(record.Block)
+	if err == nil && record.Payload != nil {
+		payload := record.Payload.Reader()
+		_, err = io.Copy(file, payload)
+		payload.Close()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (writer *fixtureWriter) RecordCount() uint64 {
+	return atomic.LoadUint64(&writer.count)
+}
+
+// 代表基于录制目录的回放数据源的实现类型
+type fixtureSource struct {
+	// 代表录制目录
+	dir string
+}
+
+// 用于创建一个基于录制目录的回放数据源
+func NewFixtureSource(dir string) (ReplaySource, error) {
+	fileInfo, err := os.Stat(dir)
+	if err != nil {
+		return nil, genParameterError("无效的录制目录: " + err.Error())
+	}
+	if !fileInfo.IsDir() {
+		return nil, genParameterError("不是目录: " + dir)
+	}
+	return &fixtureSource{dir: dir}, nil
+}
+
+func (source *fixtureSource) Lookup(httpReq *http.Request) (*http.Response, error) {
+	path := filepath.Join(source.dir, fixtureName(httpReq, requestBody(httpReq)))
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), httpReq)
+}
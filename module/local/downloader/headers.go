@@ -0,0 +1,173 @@
+package downloader
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// 代表请求头配置的轮换方式的类型
+type HeaderRotation string
+
+// 当前支持的请求头配置轮换方式的常量
+const (
+	// 每个请求依次使用下一个请求头配置
+	HEADER_ROTATE_PER_REQUEST HeaderRotation = "per_request"
+	// 同一主机的请求固定使用同一个请求头配置
+	HEADER_ROTATE_PER_HOST HeaderRotation = "per_host"
+)
+
+// 代表Referer策略的类型
+type RefererPolicy string
+
+// 当前支持的Referer策略的常量
+const (
+	// 发送完整的父请求URL，但从HTTPS页面发往HTTP页面的请求不发送
+	REFERER_NO_DOWNGRADE RefererPolicy = "no-referrer-when-downgrade"
+	// 只发送父请求URL的源（协议、主机与端口）
+	REFERER_ORIGIN RefererPolicy = "origin"
+	// 同源请求发送完整的父请求URL，跨源请求不发送
+	REFERER_SAME_ORIGIN RefererPolicy = "same-origin"
+	// 同源请求发送完整的父请求URL，跨源请求只发送源
+	REFERER_ORIGIN_WHEN_CROSS_ORIGIN RefererPolicy = "origin-when-cross-origin"
+	// 总是发送完整的父请求URL
+	REFERER_UNSAFE_URL RefererPolicy = "unsafe-url"
+	// 不发送Referer
+	REFERER_NONE RefererPolicy = "no-referrer"
+)
+
+// 代表请求头配置的类型
+// 请求中已有的请求头不会被覆盖
+type HeaderProfile struct {
+	// 配置的名称，仅用于日志和摘要
+	Name string `json:"name"`
+	// User-Agent请求头的值
+	UserAgent string `json:"user_agent"`
+	// Accept请求头的值
+	Accept string `json:"accept"`
+	// Accept-Language请求头的值
+	AcceptLanguage string `json:"accept_language"`
+	// Referer策略，为空时使用REFERER_NO_DOWNGRADE
+	RefererPolicy RefererPolicy `json:"referer_policy"`
+}
+
+// 用于自检请求头配置的有效性
+func (profile *HeaderProfile) check(index int) error {
+	switch profile.RefererPolicy {
+	case "", REFERER_NO_DOWNGRADE, REFERER_ORIGIN, REFERER_SAME_ORIGIN,
+		REFERER_ORIGIN_WHEN_CROSS_ORIGIN, REFERER_UNSAFE_URL, REFERER_NONE:
+		return nil
+	default:
+		return genParameterError(fmt.Sprintf("请求头配置[%d]中不支持的Referer策略: %s",
+			index, profile.RefererPolicy))
+	}
+}
+
+// 用于把请求头配置应用到给定的请求
+// 参数parent代表父请求的URL，为nil时不设置Referer
+func (profile *HeaderProfile) apply(httpReq *http.Request, parent *url.URL) {
+	if httpReq.Header == nil {
+		httpReq.Header = http.Header{}
+	}
+	setDefault(httpReq.Header, "User-Agent", profile.UserAgent)
+	setDefault(httpReq.Header, "Accept", profile.Accept)
+	setDefault(httpReq.Header, "Accept-Language", profile.AcceptLanguage)
+	if parent != nil {
+		setDefault(httpReq.Header, "Referer", referer(profile.RefererPolicy, parent, httpReq.URL))
+	}
+}
+
+// 用于在请求头不存在时设置它
+func setDefault(header http.Header, key string, value string) {
+	if value == "" || header.Get(key) != "" {
+		return
+	}
+	header.Set(key, value)
+}
+
+// 用于按照Referer策略生成Referer请求头的值
+// 结果值为空时表示不发送Referer
+func referer(policy RefererPolicy, parent *url.URL, target *url.URL) string {
+	if parent.Scheme != "http" && parent.Scheme != "https" {
+		return ""
+	}
+	stripped := *parent
+	stripped.User = nil
+	stripped.Fragment = ""
+	full := stripped.String()
+	origin := (&url.URL{Scheme: parent.Scheme, Host: parent.Host, Path: "/"}).String()
+	sameOrigin := target != nil &&
+		target.Scheme == parent.Scheme && target.Host == parent.Host
+	downgrade := target != nil && parent.Scheme == "https" && target.Scheme != "https"
+	switch policy {
+	case REFERER_NONE:
+		return ""
+	case REFERER_UNSAFE_URL:
+		return full
+	case REFERER_ORIGIN:
+		return origin
+	case REFERER_SAME_ORIGIN:
+		if sameOrigin {
+			return full
+		}
+		return ""
+	case REFERER_ORIGIN_WHEN_CROSS_ORIGIN:
+		if sameOrigin {
+			return full
+		}
+		return origin
+	default:
+		if downgrade {
+			return ""
+		}
+		return full
+	}
+}
+
+// 代表请求头配置轮换器的类型
+type headerRotator struct {
+	// 请求头配置的列表
+	profiles []HeaderProfile
+	// 轮换方式
+	rotation HeaderRotation
+	// 下一次轮换的位置
+	next int
+	// 主机与请求头配置的索引的映射，仅用于HEADER_ROTATE_PER_HOST
+	sticky map[string]int
+	// 互斥锁
+	lock sync.Mutex
+}
+
+// 用于创建一个请求头配置轮换器
+// 参数profiles为空时返回nil
+func newHeaderRotator(profiles []HeaderProfile, rotation HeaderRotation) *headerRotator {
+	if len(profiles) == 0 {
+		return nil
+	}
+	if rotation == "" {
+		rotation = HEADER_ROTATE_PER_REQUEST
+	}
+	return &headerRotator{
+		profiles: append([]HeaderProfile(nil), profiles...),
+		rotation: rotation,
+		sticky:   map[string]int{},
+	}
+}
+
+// 用于为给定主机的请求选择一个请求头配置
+func (rotator *headerRotator) pick(host string) *HeaderProfile {
+	rotator.lock.Lock()
+	defer rotator.lock.Unlock()
+	if rotator.rotation == HEADER_ROTATE_PER_HOST {
+		if index, ok := rotator.sticky[host]; ok {
+			return &rotator.profiles[index]
+		}
+	}
+	index := rotator.next
+	rotator.next = (rotator.next + 1) % len(rotator.profiles)
+	if rotator.rotation == HEADER_ROTATE_PER_HOST {
+		rotator.sticky[host] = index
+	}
+	return &rotator.profiles[index]
+}
@@ -0,0 +1,38 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// 健康检查请求的超时时间
+const healthCheckTimeout = 10 * time.Second
+
+// 用于检查下载器的健康状况
+// 下载器会使用自身的HTTP客户端访问健康检查URL，
+// 因此代理或网络故障都会反映在检查结果中
+// 使用代理池时，只要有一个代理可用，检查就会通过
+func (downloader *myDownloader) CheckHealth() error {
+	if downloader.healthCheckURL == "" {
+		return nil
+	}
+	if downloader.proxyPool != nil {
+		return downloader.checkProxies()
+	}
+	client := downloader.httpClient
+	client.Timeout = healthCheckTimeout
+	httpResp, err := client.Head(downloader.healthCheckURL)
+	if err != nil {
+		return genError(fmt.Sprintf("健康检查失败: %s", err))
+	}
+	io.Copy(ioutil.Discard, httpResp.Body)
+	httpResp.Body.Close()
+	if httpResp.StatusCode >= http.StatusInternalServerError {
+		return genError(fmt.Sprintf("健康检查失败: 状态码 %d (URL: %s)",
+			httpResp.StatusCode, downloader.healthCheckURL))
+	}
+	return nil
+}
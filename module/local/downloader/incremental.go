@@ -0,0 +1,162 @@
+package downloader
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"../../../toolkit/recrawl"
+)
+
+// 默认的增量爬取内容摘要的最大长度（字节）
+const DEFAULT_RECRAWL_HASH_LIMIT = 8 << 20
+
+// 代表增量爬取计数的类型
+type recrawlCounts struct {
+	// 首次抓取的页面数
+	newCount uint64
+	// 内容有变化的页面数
+	changedCount uint64
+	// 内容未变化的页面数
+	unchangedCount uint64
+}
+
+// 代表增量爬取计数的摘要类型
+type recrawlSummaryStruct struct {
+	New       uint64 `json:"new"`
+	Changed   uint64 `json:"changed"`
+	Unchanged uint64 `json:"unchanged"`
+}
+
+func (counts *recrawlCounts) summary() recrawlSummaryStruct {
+	return recrawlSummaryStruct{
+		New:       atomic.LoadUint64(&counts.newCount),
+		Changed:   atomic.LoadUint64(&counts.changedCount),
+		Unchanged: atomic.LoadUint64(&counts.unchangedCount),
+	}
+}
+
+// 用于根据已有的抓取记录为请求添加条件请求头
+func setConditionalHeaders(httpReq *http.Request, store recrawl.Store) {
+	if httpReq.Method != "" && httpReq.Method != http.MethodGet {
+		return
+	}
+	entry, ok := store.Get(httpReq.URL.String())
+	if !ok {
+		return
+	}
+	if entry.ETag != "" {
+		httpReq.Header.Set("If-None-Match", entry.ETag)
+	}
+	if entry.LastModified != "" {
+		httpReq.Header.Set("If-Modified-Since", entry.LastModified)
+	}
+}
+
+// 代表增量爬取策略的类型
+type recrawlPolicy struct {
+	// 内容摘要的最大长度
+	hashLimit int64
+	// 列表页URL的正则表达式
+	listingPatterns []*regexp.Regexp
+}
+
+// 用于根据可选参数创建增量爬取策略
+// 正则表达式已在参数自检时验证过
+func newRecrawlPolicy(args Args) recrawlPolicy {
+	policy := recrawlPolicy{hashLimit: args.RecrawlHashLimit}
+	if policy.hashLimit == 0 {
+		policy.hashLimit = DEFAULT_RECRAWL_HASH_LIMIT
+	}
+	for _, pattern := range args.RecrawlListingPatterns {
+		policy.listingPatterns = append(policy.listingPatterns, regexp.MustCompile(pattern))
+	}
+	return policy
+}
+
+// 用于判断给定URL是否属于列表页
+// 列表页即使未变化也需要分析，以便重新提取其中的链接
+func (policy recrawlPolicy) isListing(url string) bool {
+	for _, pattern := range policy.listingPatterns {
+		if pattern.MatchString(url) {
+			return true
+		}
+	}
+	return false
+}
+
+// 代表先读出已缓冲的数据再读出剩余响应体的读取器
+type prefixedBody struct {
+	io.Reader
+	// 原响应体
+	body io.Closer
+}
+
+func (pb *prefixedBody) Close() error {
+	return pb.body.Close()
+}
+
+// 用于检查响应的内容相对于上一次抓取是否有变化，并更新抓取记录
+// 结果值为false时说明内容未变化，此时响应体已被关闭，无需再做分析
+// 只有不超过hashLimit的响应体才会被读入内存并计算摘要，
+// 更长的响应体总被视为有变化，其抓取记录中只保留ETag和Last-Modified
+func checkChanged(httpReq *http.Request, httpResp *http.Response,
+	store recrawl.Store, counts *recrawlCounts, hashLimit int64) (bool, error) {
+	if httpReq.Method != "" && httpReq.Method != http.MethodGet {
+		return true, nil
+	}
+	url := httpReq.URL.String()
+	entry, existed := store.Get(url)
+	if httpResp.StatusCode == http.StatusNotModified {
+		httpResp.Body.Close()
+		entry.FetchedAt = time.Now()
+		atomic.AddUint64(&counts.unchangedCount, 1)
+		return false, store.Put(url, entry)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return true, nil
+	}
+	// 多读一个字节以判断响应体是否超出了限制
+	data, err := ioutil.ReadAll(io.LimitReader(httpResp.Body, hashLimit+1))
+	if err != nil {
+		httpResp.Body.Close()
+		return false, genError("读取响应体出现异常: " + err.Error())
+	}
+	var hash string
+	if int64(len(data)) > hashLimit {
+		httpResp.Body = &prefixedBody{
+			Reader: io.MultiReader(bytes.NewReader(data), httpResp.Body),
+			body:   httpResp.Body,
+		}
+	} else {
+		httpResp.Body.Close()
+		httpResp.Body = ioutil.NopCloser(bytes.NewReader(data))
+		sum := sha256.Sum256(data)
+		hash = hex.EncodeToString(sum[:])
+	}
+	changed := !existed || hash == "" || entry.ContentHash != hash
+	switch {
+	case !existed:
+		atomic.AddUint64(&counts.newCount, 1)
+	case changed:
+		atomic.AddUint64(&counts.changedCount, 1)
+	default:
+		atomic.AddUint64(&counts.unchangedCount, 1)
+	}
+	newEntry := recrawl.Entry{
+		ETag:         httpResp.Header.Get("ETag"),
+		LastModified: httpResp.Header.Get("Last-Modified"),
+		ContentHash:  hash,
+		FetchedAt:    time.Now(),
+	}
+	if err := store.Put(url, newEntry); err != nil {
+		return changed, err
+	}
+	return changed, nil
+}
@@ -0,0 +1,58 @@
+package downloader
+
+import (
+	"io"
+
+	"../../../module"
+)
+
+// 用于把增量爬取的状态和Cookie持久化
+func (downloader *myDownloader) Flush() error {
+	if downloader.recrawlStore != nil {
+		if err := downloader.recrawlStore.Save(); err != nil {
+			return err
+		}
+	}
+	if downloader.cookieJar != nil {
+		if err := downloader.cookieJar.Save(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 用于在调度器停止时把增量爬取的状态和Cookie持久化
+func (downloader *myDownloader) Close() error {
+	return downloader.Flush()
+}
+
+// 用于把打开操作转交给被装饰的下载器
+func (downloader *recordingDownloader) Open() error {
+	if opener, ok := downloader.Downloader.(module.Opener); ok {
+		return opener.Open()
+	}
+	return nil
+}
+
+// 用于把刷新操作转交给被装饰的下载器
+func (downloader *recordingDownloader) Flush() error {
+	if flusher, ok := downloader.Downloader.(module.Flusher); ok {
+		return flusher.Flush()
+	}
+	return nil
+}
+
+// 用于关闭被装饰的下载器和录制目标
+// 录制目标（如WARC写入器）实现了io.Closer时会被关闭
+func (downloader *recordingDownloader) Close() error {
+	var err error
+	if closer, ok := downloader.Downloader.(module.Closer); ok {
+		err = closer.Close()
+	}
+	if closer, ok := downloader.writer.(io.Closer); ok {
+		if cerr := closer.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
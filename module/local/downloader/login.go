@@ -0,0 +1,245 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 默认的单个登录步骤的超时时间
+const DEFAULT_LOGIN_TIMEOUT = 30 * time.Second
+
+// 代表登录脚本中的一个步骤
+// 每个步骤都是一次表单提交，响应设置的Cookie会被存入下载器的Cookie容器
+type LoginStep struct {
+	// 请求的方法，为空时使用POST
+	Method string `json:"method"`
+	// 请求的URL
+	URL string `json:"url"`
+	// 表单字段
+	Form map[string]string `json:"form"`
+}
+
+// 代表针对某个主机的登录脚本
+type LoginScript struct {
+	// 脚本适用的主机名（不含端口）
+	Host string `json:"host"`
+	// 依次执行的登录步骤
+	Steps []LoginStep `json:"steps"`
+	// 登录页面URL的正则表达式
+	// 请求被重定向到与之匹配的URL时，会被视为已登出
+	LoginURLPattern string `json:"login_url_pattern"`
+	// 代表已登出的状态码，如401
+	LoggedOutStatus []int `json:"logged_out_status"`
+}
+
+// 用于自检登录脚本的有效性
+func (script *LoginScript) check(index int) error {
+	if script.Host == "" {
+		return genParameterError(fmt.Sprintf("登录脚本[%d]缺少主机名", index))
+	}
+	if len(script.Steps) == 0 {
+		return genParameterError(fmt.Sprintf("登录脚本[%d]没有登录步骤 (主机: %s)", index, script.Host))
+	}
+	for i, step := range script.Steps {
+		u, err := url.Parse(step.URL)
+		if err != nil || !u.IsAbs() {
+			return genParameterError(fmt.Sprintf("登录脚本[%d]的步骤[%d]中无效的URL: %q",
+				index, i, step.URL))
+		}
+	}
+	if script.LoginURLPattern != "" {
+		if _, err := regexp.Compile(script.LoginURLPattern); err != nil {
+			return genParameterError(fmt.Sprintf("登录脚本[%d]中无效的登录页面URL正则表达式: %s",
+				index, err))
+		}
+	}
+	return nil
+}
+
+// 用于从JSON文件中加载登录脚本列表
+func LoadLoginScripts(path string) ([]LoginScript, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, genError(fmt.Sprintf("读取登录脚本文件出现异常: %s (path: %s)", err, path))
+	}
+	var scripts []LoginScript
+	if err := json.Unmarshal(data, &scripts); err != nil {
+		return nil, genError(fmt.Sprintf("解析登录脚本文件出现异常: %s (path: %s)", err, path))
+	}
+	return scripts, nil
+}
+
+// 代表某个主机的会话状态
+type session struct {
+	// 登录脚本
+	script LoginScript
+	// 登录页面URL的正则表达式
+	loginURLRegexp *regexp.Regexp
+	// 是否已登录
+	loggedIn bool
+	// 登录的次数
+	loginCount uint64
+	// 登录时从代理池中选择的代理，会话内的请求都经由该代理发出，未使用代理池时为nil
+	proxyURL *url.URL
+	// 保护会话状态的互斥锁，同一主机的登录不会并发进行
+	lock sync.Mutex
+}
+
+// 用于获取会话固定使用的代理
+func (s *session) proxy() *url.URL {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.proxyURL
+}
+
+// 用于判断给定的响应是否表明会话已登出
+func (s *session) loggedOut(httpResp *http.Response) bool {
+	for _, code := range s.script.LoggedOutStatus {
+		if httpResp.StatusCode == code {
+			return true
+		}
+	}
+	if s.loginURLRegexp != nil && httpResp.Request != nil && httpResp.Request.URL != nil {
+		return s.loginURLRegexp.MatchString(httpResp.Request.URL.String())
+	}
+	return false
+}
+
+// 代表会话管理器的类型
+type sessionManager struct {
+	// 主机名与会话状态的映射
+	sessions map[string]*session
+	// 单个登录步骤的超时时间
+	timeout time.Duration
+}
+
+// 用于创建一个会话管理器
+// 参数scripts为空时返回nil，参数timeout为0时使用DEFAULT_LOGIN_TIMEOUT
+func newSessionManager(scripts []LoginScript, timeout time.Duration) *sessionManager {
+	if len(scripts) == 0 {
+		return nil
+	}
+	if timeout == 0 {
+		timeout = DEFAULT_LOGIN_TIMEOUT
+	}
+	manager := &sessionManager{
+		sessions: map[string]*session{},
+		timeout:  timeout,
+	}
+	for _, script := range scripts {
+		s := &session{script: script}
+		if script.LoginURLPattern != "" {
+			s.loginURLRegexp = regexp.MustCompile(script.LoginURLPattern)
+		}
+		manager.sessions[strings.ToLower(script.Host)] = s
+	}
+	return manager
+}
+
+// 用于获取给定URL对应的会话状态，不需要登录时返回nil
+func (manager *sessionManager) session(u *url.URL) *session {
+	if manager == nil || u == nil {
+		return nil
+	}
+	return manager.sessions[strings.ToLower(u.Hostname())]
+}
+
+// 用于确保下载器已登录给定的会话
+// 参数force为true时，即使已登录也会重新登录
+// 使用代理池时，每次登录都会为会话重新选择一个代理，登录步骤和之后的请求都经由该代理发出
+func (downloader *myDownloader) login(s *session, force bool) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.loggedIn && !force {
+		return nil
+	}
+	s.loggedIn = false
+	s.proxyURL = nil
+	if downloader.proxyPool != nil {
+		proxyURL, err := downloader.proxyPool.Pick(strings.ToLower(s.script.Host))
+		if err != nil {
+			return genError(fmt.Sprintf("登录失败: %s (主机: %s)", err, s.script.Host))
+		}
+		s.proxyURL = proxyURL
+	}
+	for i, step := range s.script.Steps {
+		if err := downloader.doLoginStep(step, s.proxyURL); err != nil {
+			return genError(fmt.Sprintf("登录失败: 步骤[%d]: %s (主机: %s)", i, err, s.script.Host))
+		}
+	}
+	s.loggedIn = true
+	s.loginCount++
+	logger.Infof("已登录 (主机: %s, 次数: %d)", s.script.Host, s.loginCount)
+	return nil
+}
+
+// 用于执行一个登录步骤
+// 请求与普通请求一样经由send发出，因此会带上域配置中的认证信息
+func (downloader *myDownloader) doLoginStep(step LoginStep, proxyURL *url.URL) error {
+	method := step.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	form := url.Values{}
+	for key, value := range step.Form {
+		form.Set(key, value)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), downloader.sessions.timeout)
+	defer cancel()
+	var httpReq *http.Request
+	var err error
+	if method == http.MethodGet {
+		httpReq, err = http.NewRequestWithContext(ctx, method, step.URL, nil)
+		if err == nil && len(form) > 0 {
+			httpReq.URL.RawQuery = form.Encode()
+		}
+	} else {
+		httpReq, err = http.NewRequestWithContext(ctx, method, step.URL, strings.NewReader(form.Encode()))
+		if err == nil {
+			httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	httpResp, err := downloader.send(withProxy(httpReq, proxyURL))
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, httpResp.Body)
+	httpResp.Body.Close()
+	if httpResp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("状态码 %d (URL: %s)", httpResp.StatusCode, step.URL)
+	}
+	return nil
+}
+
+// 用于判断请求能否被重新发送
+func replayable(httpReq *http.Request) bool {
+	return httpReq.Body == nil || httpReq.Body == http.NoBody || httpReq.GetBody != nil
+}
+
+// 用于生成可重新发送的请求副本
+// HTTP客户端发送请求时会把Cookie容器中的Cookie写入请求头，
+// 因此副本中的Cookie请求头会被删除，以便使用重新登录后的Cookie
+func replay(httpReq *http.Request) (*http.Request, error) {
+	retry := httpReq.Clone(httpReq.Context())
+	retry.Header.Del("Cookie")
+	if httpReq.GetBody != nil {
+		body, err := httpReq.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		retry.Body = body
+	}
+	return retry, nil
+}
@@ -0,0 +1,256 @@
+package downloader
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"../../../module"
+)
+
+// 代表下载处理函数的类型
+// 结果值均为nil时表示不需要分析的响应（如未变化的页面）
+type Handler func(req *module.Request) (*module.Response, error)
+
+// 代表下载器中间件的类型
+// 中间件接收下一层的下载处理函数，并返回包裹了它的新的下载处理函数
+type Middleware func(next Handler) Handler
+
+// 用于把多个中间件组合成一个，排在前面的中间件位于外层
+func Chain(middlewares ...Middleware) Middleware {
+	return func(next Handler) Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			next = middlewares[i](next)
+		}
+		return next
+	}
+}
+
+// 用于生成在发送前修改请求的中间件
+// 参数mutate返回非nil的错误值时，请求不会被发送
+func RequestMiddleware(mutate func(httpReq *http.Request) error) Middleware {
+	return func(next Handler) Handler {
+		return func(req *module.Request) (*module.Response, error) {
+			if err := mutate(req.HTTPReq()); err != nil {
+				return nil, genError(err.Error())
+			}
+			return next(req)
+		}
+	}
+}
+
+// 用于生成检查响应的中间件
+// 参数inspect返回非nil的错误值时，响应体会被关闭并丢弃
+func ResponseMiddleware(inspect func(httpResp *http.Response) error) Middleware {
+	return func(next Handler) Handler {
+		return func(req *module.Request) (*module.Response, error) {
+			resp, err := next(req)
+			if err != nil || resp == nil || resp.HTTPResp() == nil {
+				return resp, err
+			}
+			httpResp := resp.HTTPResp()
+			if err := inspect(httpResp); err != nil {
+				if httpResp.Body != nil {
+					httpResp.Body.Close()
+				}
+				return nil, genError(err.Error())
+			}
+			return resp, nil
+		}
+	}
+}
+
+// 用于判断请求的主机是否在给定的主机列表中，列表为空时总是返回true
+func hostIn(httpReq *http.Request, hosts []string) bool {
+	if len(hosts) == 0 {
+		return true
+	}
+	host := strings.ToLower(httpReq.URL.Hostname())
+	for _, h := range hosts {
+		if strings.ToLower(h) == host {
+			return true
+		}
+	}
+	return false
+}
+
+// 用于生成设置认证请求头的中间件
+// 参数hosts为空时对所有主机生效，否则只对列出的主机生效
+func AuthHeader(key string, value string, hosts ...string) Middleware {
+	return RequestMiddleware(func(httpReq *http.Request) error {
+		if hostIn(httpReq, hosts) {
+			httpReq.Header.Set(key, value)
+		}
+		return nil
+	})
+}
+
+// 用于生成设置HTTP基本认证的中间件
+func BasicAuth(username string, password string, hosts ...string) Middleware {
+	return RequestMiddleware(func(httpReq *http.Request) error {
+		if hostIn(httpReq, hosts) {
+			httpReq.SetBasicAuth(username, password)
+		}
+		return nil
+	})
+}
+
+// 用于生成设置Bearer令牌的中间件
+func BearerToken(token string, hosts ...string) Middleware {
+	return AuthHeader("Authorization", "Bearer "+token, hosts...)
+}
+
+// 请求签名所用的时间戳请求头
+const HEADER_SIGNATURE_TIMESTAMP = "X-Signature-Timestamp"
+
+// 用于生成以HMAC-SHA256对请求签名的中间件
+// 被签名的内容依次为请求方法、URL、时间戳和请求体的SHA-256摘要（十六进制），以换行符分隔
+// 签名会以“HMAC-SHA256 keyId=<keyID>, signature=<十六进制签名>”的形式写入Authorization请求头
+func SignHMAC(keyID string, secret []byte, hosts ...string) Middleware {
+	return RequestMiddleware(func(httpReq *http.Request) error {
+		if !hostIn(httpReq, hosts) {
+			return nil
+		}
+		bodyHash := sha256.New()
+		if httpReq.Body != nil && httpReq.Body != http.NoBody {
+			if httpReq.GetBody == nil {
+				return errors.New("请求签名失败: 请求体无法被重新读取")
+			}
+			body, err := httpReq.GetBody()
+			if err != nil {
+				return fmt.Errorf("请求签名失败: %s", err)
+			}
+			_, err = io.Copy(bodyHash, body)
+			body.Close()
+			if err != nil {
+				return fmt.Errorf("请求签名失败: %s", err)
+			}
+		}
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, secret)
+		fmt.Fprintf(mac, "%s\n%s\n%s\n%s", httpReq.Method, httpReq.URL,
+			timestamp, hex.EncodeToString(bodyHash.Sum(nil)))
+		httpReq.Header.Set(HEADER_SIGNATURE_TIMESTAMP, timestamp)
+		httpReq.Header.Set("Authorization", fmt.Sprintf("HMAC-SHA256 keyId=%s, signature=%s",
+			keyID, hex.EncodeToString(mac.Sum(nil))))
+		return nil
+	})
+}
+
+// 用于生成限制响应体长度的中间件
+// Content-Length超出上限的响应会被直接丢弃，
+// 其他响应的响应体在读取超出上限时会返回错误
+func MaxResponseSize(limit int64) Middleware {
+	return ResponseMiddleware(func(httpResp *http.Response) error {
+		if httpResp.ContentLength > limit {
+			return fmt.Errorf("响应体过大: %d 字节 (上限: %d 字节, URL: %s)",
+				httpResp.ContentLength, limit, httpResp.Request.URL)
+		}
+		if httpResp.Body != nil {
+			httpResp.Body = &limitedBody{body: httpResp.Body, remaining: limit, limit: limit}
+		}
+		return nil
+	})
+}
+
+// 代表有长度上限的响应体
+type limitedBody struct {
+	// 原响应体
+	body io.ReadCloser
+	// 剩余可读的字节数
+	remaining int64
+	// 长度上限
+	limit int64
+}
+
+func (body *limitedBody) Read(p []byte) (int, error) {
+	if body.remaining < 0 {
+		return 0, fmt.Errorf("响应体过大 (上限: %d 字节)", body.limit)
+	}
+	if int64(len(p)) > body.remaining+1 {
+		p = p[:body.remaining+1]
+	}
+	n, err := body.body.Read(p)
+	body.remaining -= int64(n)
+	if body.remaining < 0 {
+		return n, fmt.Errorf("响应体过大 (上限: %d 字节)", body.limit)
+	}
+	return n, err
+}
+
+func (body *limitedBody) Close() error {
+	return body.body.Close()
+}
+
+// 代表重定向策略的类型
+// 它会在每次重定向前被调用，参数via是已发送的请求，返回非nil的错误值时停止重定向
+// 返回http.ErrUseLastResponse时，最后一个响应会被原样返回
+type RedirectPolicy func(httpReq *http.Request, via []*http.Request) error
+
+// 代表请求上下文中存放重定向策略的键的类型
+type redirectContextKey struct{}
+
+// 用于生成使用给定重定向策略的中间件
+// 该策略会在下载器的重定向次数与爬取范围检查之后被调用
+func Redirects(policy RedirectPolicy) Middleware {
+	return func(next Handler) Handler {
+		return func(req *module.Request) (*module.Response, error) {
+			httpReq := req.HTTPReq()
+			ctx := context.WithValue(httpReq.Context(), redirectContextKey{}, policy)
+			return next(withHTTPReq(req, httpReq.WithContext(ctx)))
+		}
+	}
+}
+
+// 用于生成限制重定向次数的重定向策略
+// 参数sameHost为true时不跟随到其他主机的重定向
+// 不被跟随的重定向会使最后一个响应被原样返回
+func LimitRedirects(max int, sameHost bool) RedirectPolicy {
+	return func(httpReq *http.Request, via []*http.Request) error {
+		if len(via) > max {
+			return http.ErrUseLastResponse
+		}
+		if sameHost && len(via) > 0 && httpReq.URL.Host != via[0].URL.Host {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}
+}
+
+// 用于生成记录请求与响应的中间件
+func Logging() Middleware {
+	return func(next Handler) Handler {
+		return func(req *module.Request) (*module.Response, error) {
+			httpReq := req.HTTPReq()
+			start := time.Now()
+			resp, err := next(req)
+			elapsed := time.Since(start)
+			switch {
+			case err != nil:
+				logger.Warnf("下载失败: %s (%s %s, 耗时: %s)", err, httpReq.Method, httpReq.URL, elapsed)
+			case resp == nil || resp.HTTPResp() == nil:
+				logger.Infof("下载完成，无需分析 (%s %s, 耗时: %s)", httpReq.Method, httpReq.URL, elapsed)
+			default:
+				httpResp := resp.HTTPResp()
+				logger.Infof("下载完成 (%s %s, 状态码: %d, 长度: %d, 耗时: %s)",
+					httpReq.Method, httpReq.URL, httpResp.StatusCode, httpResp.ContentLength, elapsed)
+			}
+			return resp, err
+		}
+	}
+}
+
+// 用于生成使用给定HTTP请求的请求副本，深度与父请求URL保持不变
+func withHTTPReq(req *module.Request, httpReq *http.Request) *module.Request {
+	newReq := module.NewRequest(httpReq, req.Depth())
+	newReq.SetParent(req.Parent())
+	return newReq
+}
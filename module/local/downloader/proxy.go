@@ -0,0 +1,116 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// 代表请求上下文中存放代理URL的键的类型
+type proxyContextKey struct{}
+
+// 用于从请求的上下文中获取代理URL，可作为http.Transport的Proxy字段的值
+func proxyFromContext(req *http.Request) (*url.URL, error) {
+	proxyURL, _ := req.Context().Value(proxyContextKey{}).(*url.URL)
+	return proxyURL, nil
+}
+
+// 用于生成经由代理池发送请求的HTTP客户端
+// 客户端的Transport必须为nil或*http.Transport类型
+func withProxyTransport(client http.Client) (http.Client, error) {
+	var transport *http.Transport
+	switch t := client.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return client, genParameterError(fmt.Sprintf("使用代理池时不支持的Transport类型: %T", t))
+	}
+	transport.Proxy = proxyFromContext
+	client.Transport = transport
+	return client, nil
+}
+
+// 用于从代理池中为请求选择代理
+// 结果值中的请求是携带了代理URL的副本
+// 请求的上下文中已指定代理（如登录会话固定的代理）时直接使用该代理
+func (downloader *myDownloader) pickProxy(httpReq *http.Request) (*http.Request, *url.URL, error) {
+	if downloader.proxyPool == nil {
+		return httpReq, nil, nil
+	}
+	if proxyURL, _ := proxyFromContext(httpReq); proxyURL != nil {
+		return httpReq, proxyURL, nil
+	}
+	proxyURL, err := downloader.proxyPool.Pick(httpReq.URL.Host)
+	if err != nil {
+		return nil, nil, genError(err.Error())
+	}
+	ctx := context.WithValue(httpReq.Context(), proxyContextKey{}, proxyURL)
+	return httpReq.WithContext(ctx), proxyURL, nil
+}
+
+// 用于向代理池报告经给定代理发出的请求的结果
+// 状态码407表示代理认证失败，也会被视为代理的失败
+func (downloader *myDownloader) observeProxy(proxyURL *url.URL, httpResp *http.Response, err error) {
+	if proxyURL == nil {
+		return
+	}
+	if err == nil && httpResp.StatusCode == http.StatusProxyAuthRequired {
+		err = fmt.Errorf("代理认证失败: 状态码 %d", httpResp.StatusCode)
+	}
+	downloader.proxyPool.Observe(proxyURL, err)
+}
+
+// 用于经由代理池中的每个代理访问健康检查URL，并记录检查结果
+// 若没有任何可用的代理，则返回错误值
+func (downloader *myDownloader) checkProxies() error {
+	client := downloader.httpClient
+	client.Timeout = healthCheckTimeout
+	var lastErr error
+	healthy := 0
+	for _, proxyURL := range downloader.proxyPool.Proxies() {
+		err := headThroughProxy(client, downloader.healthCheckURL, proxyURL)
+		downloader.proxyPool.RecordCheck(proxyURL, err)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		healthy++
+	}
+	if healthy == 0 {
+		return genError(fmt.Sprintf("健康检查失败: 没有可用的代理 (最近一次错误: %s)", lastErr))
+	}
+	return nil
+}
+
+// 用于经由给定代理发送HEAD请求
+func headThroughProxy(client http.Client, checkURL string, proxyURL *url.URL) error {
+	httpReq, err := http.NewRequest(http.MethodHead, checkURL, nil)
+	if err != nil {
+		return err
+	}
+	ctx := context.WithValue(httpReq.Context(), proxyContextKey{}, proxyURL)
+	httpResp, err := client.Do(httpReq.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, httpResp.Body)
+	httpResp.Body.Close()
+	if httpResp.StatusCode == http.StatusProxyAuthRequired ||
+		httpResp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("状态码 %d", httpResp.StatusCode)
+	}
+	return nil
+}
+
+// 用于生成固定使用给定代理的请求副本，参数proxyURL为nil时返回原请求
+func withProxy(httpReq *http.Request, proxyURL *url.URL) *http.Request {
+	if proxyURL == nil {
+		return httpReq
+	}
+	return httpReq.WithContext(context.WithValue(httpReq.Context(), proxyContextKey{}, proxyURL))
+}
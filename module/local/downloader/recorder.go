@@ -0,0 +1,314 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+
+	"../../../module"
+	"../../../toolkit/reader"
+	"../../../toolkit/warc"
+)
+
+// 默认的可录制的响应体的最大长度（字节）
+const DEFAULT_RECORD_MAX_BODY_SIZE int64 = 64 << 20
+
+// 默认的录制时在内存中缓存的响应体的最大长度（字节）
+const DEFAULT_RECORD_MEMORY_THRESHOLD int64 = 4 << 20
+
+// 代表录制下载器的可选参数的容器类型
+type RecorderArgs struct {
+	// MaxBodySize 代表可录制的响应体的最大长度（字节）
+	// 超出该长度的响应会原样交给后续处理，但不会被录制，为0时使用DEFAULT_RECORD_MAX_BODY_SIZE
+	MaxBodySize int64
+	// MemoryThreshold 代表在内存中缓存的响应体的最大长度（字节）
+	// 超出该长度的响应体会被转存到临时文件，为0时使用DEFAULT_RECORD_MEMORY_THRESHOLD
+	MemoryThreshold int64
+	// TempDir 代表临时文件所在的目录，为空时使用系统默认的临时目录
+	TempDir string
+}
+
+// 用于自检参数的有效性
+func (args *RecorderArgs) Check() error {
+	if args.MaxBodySize < 0 {
+		return genParameterError(fmt.Sprintf("无效的响应体最大长度: %d", args.MaxBodySize))
+	}
+	if args.MemoryThreshold < 0 {
+		return genParameterError(fmt.Sprintf("无效的内存缓存长度: %d", args.MemoryThreshold))
+	}
+	return nil
+}
+
+// 用于生成多重读取器的参数
+// 不限制数据的最大长度，超长的响应体由调用方通过限制读取的长度来判断
+func (args *RecorderArgs) readerOptions() reader.Options {
+	opts := reader.Options{
+		MemoryThreshold: args.MemoryThreshold,
+		TempDir:         args.TempDir,
+	}
+	if opts.MemoryThreshold == 0 {
+		opts.MemoryThreshold = DEFAULT_RECORD_MEMORY_THRESHOLD
+	}
+	return opts
+}
+
+// 用于获取可录制的响应体的最大长度
+func (args *RecorderArgs) maxBodySize() int64 {
+	if args.MaxBodySize == 0 {
+		return DEFAULT_RECORD_MAX_BODY_SIZE
+	}
+	return args.MaxBodySize
+}
+
+// 代表请求-响应对的录制目标的接口类型
+// 该接口的实现类型必须是并发安全的
+type ExchangeWriter interface {
+	// 用于写入一对请求与响应
+	// 参数reqBody代表已完整读出的请求体，respBody代表响应体，可以为nil
+	WriteExchange(httpReq *http.Request, reqBody []byte,
+		httpResp *http.Response, respBody warc.Body) error
+	// 用于获取已写入的记录数量
+	RecordCount() uint64
+}
+
+// 代表录制请求与响应的下载器的实现类型
+// 它会装饰另一个下载器，组件ID与计数都沿用被装饰的下载器
+type recordingDownloader struct {
+	// 代表被装饰的下载器
+	module.Downloader
+	// 代表因超长而未录制的响应的数量
+	oversizeCount uint64
+	// 代表录制目标
+	writer ExchangeWriter
+	// 代表可选参数
+	args RecorderArgs
+}
+
+// 代表可以录制未变化的响应的下载器
+// 增量爬取时未变化的页面（包括304响应）不会被交给后续处理，只能由下载器自己录制
+type notModifiedRecorder interface {
+	// 用于设置未变化的响应的录制目标
+	setNotModifiedWriter(writer ExchangeWriter)
+}
+
+func (downloader *myDownloader) setNotModifiedWriter(writer ExchangeWriter) {
+	downloader.notModifiedWriter = writer
+}
+
+// 用于录制未变化的响应
+// 304响应没有响应体，其他响应的响应体已在检查变化时被读入内存
+func (downloader *myDownloader) recordUnchanged(httpReq *http.Request, httpResp *http.Response) {
+	if downloader.notModifiedWriter == nil {
+		return
+	}
+	var respBody warc.Body
+	if httpResp.StatusCode != http.StatusNotModified && httpResp.Body != nil {
+		body, err := reader.NewMultipleReader(httpResp.Body)
+		httpResp.Body.Close()
+		if err != nil {
+			logger.Errorf("录制未变化的响应出现异常: %s (URL: %s)", err, httpReq.URL)
+			return
+		}
+		respBody = body
+	}
+	err := downloader.notModifiedWriter.WriteExchange(httpReq, requestBody(httpReq), httpResp, respBody)
+	if err != nil {
+		logger.Errorf("录制未变化的响应出现异常: %s (URL: %s)", err, httpReq.URL)
+	}
+}
+
+// 用于创建一个WARC归档下载器
+// 该下载器下载成功的每一对请求与响应都会被写入WARC文件
+func NewWARCRecorder(downloader module.Downloader, writer warc.Writer) (module.Downloader, error) {
+	return NewWARCRecorderWithArgs(downloader, writer, RecorderArgs{})
+}
+
+// 用于根据给定的可选参数创建一个WARC归档下载器
+func NewWARCRecorderWithArgs(downloader module.Downloader, writer warc.Writer,
+	args RecorderArgs) (module.Downloader, error) {
+	if writer == nil {
+		return nil, genParameterError("空的WARC写入器")
+	}
+	return newRecorder(downloader, writer, args)
+}
+
+// 用于创建一个录制下载器
+// 被装饰的下载器支持录制未变化的响应时，未变化的响应也会被写入录制目标
+func newRecorder(downloader module.Downloader, writer ExchangeWriter,
+	args RecorderArgs) (module.Downloader, error) {
+	if downloader == nil {
+		return nil, genParameterError("空的下载器")
+	}
+	if err := args.Check(); err != nil {
+		return nil, err
+	}
+	if inner, ok := downloader.(notModifiedRecorder); ok {
+		inner.setNotModifiedWriter(writer)
+	}
+	return &recordingDownloader{
+		Downloader: downloader,
+		writer:     writer,
+		args:       args,
+	}, nil
+}
+
+// 响应体会先被缓冲（较长时转存到临时文件）再写入录制目标，之后原样交给后续处理
+// 超长的响应不会被录制，写入失败时仍会返回响应，同时返回错误值以便上报
+func (downloader *recordingDownloader) Download(req *module.Request) (*module.Response, error) {
+	resp, err := downloader.Downloader.Download(req)
+	if resp == nil || err != nil {
+		return resp, err
+	}
+	httpResp := resp.HTTPResp()
+	if httpResp == nil {
+		return resp, nil
+	}
+	var body reader.MultipleReader
+	if httpResp.Body != nil {
+		limit := downloader.args.maxBodySize()
+		// 多读一个字节以判断响应体是否超出了限制
+		body, err = reader.NewMultipleReaderWithOptions(
+			io.LimitReader(httpResp.Body, limit+1), downloader.args.readerOptions())
+		if err != nil {
+			httpResp.Body.Close()
+			return nil, genError("读取响应体出现异常: " + err.Error())
+		}
+		if body.Size() > limit {
+			atomic.AddUint64(&downloader.oversizeCount, 1)
+			logger.Warnf("响应体超出可录制的最大长度，不予录制 (URL: %s, 上限: %d 字节)\n",
+				req.HTTPReq().URL, limit)
+			head := body.Reader()
+			httpResp.Body = &bufferedBody{
+				Reader:  io.MultiReader(head, httpResp.Body),
+				closers: []io.Closer{head, httpResp.Body, body},
+			}
+			return resp, nil
+		}
+		httpResp.Body.Close()
+		buffered := body.Reader()
+		httpResp.Body = &bufferedBody{
+			Reader:  buffered,
+			closers: []io.Closer{buffered, body},
+		}
+	}
+	httpReq := req.HTTPReq()
+	reqBody := requestBody(httpReq)
+	// 先把重定向经过的每一跳录制为指向下一跳的重定向响应，
+	// 使回放时可以从原始请求跟随到最终的响应
+	current := httpReq
+	for _, next := range resp.RedirectChain() {
+		hopResp := redirectResponse(current, next)
+		if err := downloader.writer.WriteExchange(current, reqBody, hopResp, nil); err != nil {
+			return resp, genError(err.Error())
+		}
+		current = hopRequest(httpReq, next)
+	}
+	var respBody warc.Body
+	if body != nil {
+		respBody = body
+	}
+	if err := downloader.writer.WriteExchange(current, reqBody, httpResp, respBody); err != nil {
+		return resp, genError(err.Error())
+	}
+	return resp, nil
+}
+
+// 用于生成录制用的重定向响应
+// 使用307状态码，以便回放时沿用原始请求的方法
+func redirectResponse(httpReq *http.Request, target *url.URL) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusTemporaryRedirect,
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Location": {target.String()}},
+		Request:    httpReq,
+	}
+}
+
+// 用于生成重定向中某一跳的录制用请求
+// 它沿用原始请求的方法和请求头，只替换URL
+func hopRequest(httpReq *http.Request, target *url.URL) *http.Request {
+	hop := httpReq.Clone(httpReq.Context())
+	hop.URL = target
+	hop.Host = ""
+	return hop
+}
+
+// 代表由缓冲的数据构成的响应体
+// 关闭时会一并释放缓冲所用的资源
+type bufferedBody struct {
+	io.Reader
+	// 需要一并关闭的资源
+	closers []io.Closer
+}
+
+func (body *bufferedBody) Close() error {
+	var firstErr error
+	for _, closer := range body.closers {
+		if err := closer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// 代表录制下载器额外信息的摘要类型
+type recorderSummaryStruct struct {
+	Inner    interface{} `json:"inner,omitempty"`
+	Records  uint64      `json:"records"`
+	Oversize uint64      `json:"oversize"`
+}
+
+func (downloader *recordingDownloader) Summary() module.SummaryStruct {
+	summary := downloader.Downloader.Summary()
+	summary.Extra = recorderSummaryStruct{
+		Inner:    summary.Extra,
+		Records:  downloader.writer.RecordCount(),
+		Oversize: atomic.LoadUint64(&downloader.oversizeCount),
+	}
+	return summary
+}
+
+// 用于在不影响原请求的情况下读出请求体
+// 只有可以通过GetBody重新获取的请求体才会被归档
+func requestBody(httpReq *http.Request) []byte {
+	if httpReq.GetBody == nil {
+		return nil
+	}
+	body, err := httpReq.GetBody()
+	if err != nil {
+		return nil
+	}
+	defer body.Close()
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// 用于把健康检查转交给被装饰的下载器
+func (downloader *recordingDownloader) CheckHealth() error {
+	if checker, ok := downloader.Downloader.(module.HealthChecker); ok {
+		return checker.CheckHealth()
+	}
+	return nil
+}
+
+// 用于把协议支持情况的判断转交给被装饰的下载器
+func (downloader *recordingDownloader) SupportsScheme(scheme string) bool {
+	if supporter, ok := downloader.Downloader.(module.SchemeSupporter); ok {
+		return supporter.SupportsScheme(scheme)
+	}
+	return scheme == "http" || scheme == "https"
+}
+
+// 用于把重定向范围检查函数转交给被装饰的下载器
+func (downloader *recordingDownloader) SetRedirectScope(scope module.RedirectScope) {
+	if scoper, ok := downloader.Downloader.(module.RedirectScoper); ok {
+		scoper.SetRedirectScope(scope)
+	}
+}
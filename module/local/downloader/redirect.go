@@ -0,0 +1,239 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"../../../module"
+)
+
+// 默认的最大重定向次数
+const DEFAULT_MAX_REDIRECTS uint32 = 10
+
+// 代表重定向目标超出爬取范围的错误类型
+type RedirectOutOfScopeError struct {
+	// 重定向的目标URL
+	Target *url.URL
+	// 范围检查函数给出的原因
+	Reason error
+}
+
+func (err *RedirectOutOfScopeError) Error() string {
+	return fmt.Sprintf("重定向目标超出爬取范围: %s (目标: %s)", err.Reason, err.Target)
+}
+
+// 用于禁止HTTP客户端自动跟随重定向，重定向由下载器自行处理
+func stopRedirect(httpReq *http.Request, via []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+// 代表重定向控制器的类型
+type redirector struct {
+	// 被跟随的重定向的次数
+	// 以下计数器放在首位以保证原子操作所需的64位对齐
+	followedCount uint64
+	// 因超出爬取范围而被拦截的重定向的次数
+	blockedCount uint64
+	// 最大重定向次数
+	maxRedirects uint32
+	// HTTP客户端原有的重定向策略，可以为nil
+	clientPolicy RedirectPolicy
+	// 调度器设置的范围检查函数，可以为nil
+	scope module.RedirectScope
+	// 范围检查函数专用读写锁
+	scopeLock sync.RWMutex
+}
+
+// 用于创建一个重定向控制器
+// 参数maxRedirects为0时使用默认值
+func newRedirector(maxRedirects uint32, clientPolicy RedirectPolicy) *redirector {
+	if maxRedirects == 0 {
+		maxRedirects = DEFAULT_MAX_REDIRECTS
+	}
+	return &redirector{
+		maxRedirects: maxRedirects,
+		clientPolicy: clientPolicy,
+	}
+}
+
+// 用于检查是否应跟随到给定请求的重定向
+// 检查的顺序依次为重定向次数、协议、爬取范围、请求上下文中的重定向策略和HTTP客户端原有的重定向策略
+func (r *redirector) check(next *http.Request, via []*http.Request) error {
+	if uint32(len(via)) > r.maxRedirects {
+		return fmt.Errorf("重定向次数超出上限 %d (URL: %s)", r.maxRedirects, via[0].URL)
+	}
+	// 网络请求不能被重定向到本地文件或内嵌数据等其他协议
+	from := strings.ToLower(via[len(via)-1].URL.Scheme)
+	to := strings.ToLower(next.URL.Scheme)
+	if isHTTPScheme(from) && !isHTTPScheme(to) {
+		return &RedirectOutOfScopeError{
+			Target: next.URL,
+			Reason: fmt.Errorf("不允许从 %q 协议重定向到 %q 协议", from, to),
+		}
+	}
+	r.scopeLock.RLock()
+	scope := r.scope
+	r.scopeLock.RUnlock()
+	if scope != nil {
+		if err := scope(next.URL); err != nil {
+			return &RedirectOutOfScopeError{Target: next.URL, Reason: err}
+		}
+	}
+	if policy, ok := next.Context().Value(redirectContextKey{}).(RedirectPolicy); ok {
+		if err := policy(next, via); err != nil {
+			return err
+		}
+	}
+	if r.clientPolicy != nil {
+		return r.clientPolicy(next, via)
+	}
+	return nil
+}
+
+// 用于判断给定协议是否为http或https
+func isHTTPScheme(scheme string) bool {
+	return scheme == "http" || scheme == "https"
+}
+
+// 用于根据重定向响应生成下一个请求
+// 响应不是重定向或重定向无法被跟随时，结果值为nil
+func redirectRequest(httpReq *http.Request, httpResp *http.Response, hasJar bool) (*http.Request, error) {
+	method := httpReq.Method
+	keepBody := false
+	switch httpResp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther:
+		if method != http.MethodGet && method != http.MethodHead {
+			method = http.MethodGet
+		}
+	case http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		keepBody = true
+		if httpReq.GetBody == nil && httpReq.Body != nil && httpReq.Body != http.NoBody {
+			return nil, nil
+		}
+	default:
+		return nil, nil
+	}
+	location := httpResp.Header.Get("Location")
+	if location == "" {
+		return nil, nil
+	}
+	target, err := httpReq.URL.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("无效的重定向地址: %q (%s)", location, err)
+	}
+	next, err := http.NewRequest(method, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	next = next.WithContext(httpReq.Context())
+	if keepBody && httpReq.GetBody != nil {
+		if next.Body, err = httpReq.GetBody(); err != nil {
+			return nil, err
+		}
+		next.GetBody = httpReq.GetBody
+		next.ContentLength = httpReq.ContentLength
+	}
+	for key, values := range httpReq.Header {
+		next.Header[key] = append([]string(nil), values...)
+	}
+	if !keepBody {
+		next.Header.Del("Content-Type")
+		next.Header.Del("Content-Length")
+	}
+	// Cookie容器会为每一跳重新生成Cookie请求头
+	if hasJar {
+		next.Header.Del("Cookie")
+	}
+	// 敏感的请求头不会被发送到其他主机
+	if !strings.EqualFold(target.Hostname(), httpReq.URL.Hostname()) {
+		next.Header.Del("Authorization")
+		next.Header.Del("Www-Authenticate")
+		next.Header.Del("Cookie")
+	}
+	next.Header.Del("Referer")
+	if httpReq.URL.Scheme != "https" || target.Scheme == "https" {
+		referer := *httpReq.URL
+		referer.User = nil
+		referer.Fragment = ""
+		next.Header.Set("Referer", referer.String())
+	}
+	return next, nil
+}
+
+// 用于发送请求并跟随重定向
+// 第二个结果值为重定向经过的URL的列表
+// 重定向目标超出爬取范围时，会返回*RedirectOutOfScopeError类型的错误值
+func (downloader *myDownloader) do(httpReq *http.Request) (*http.Response, []*url.URL, error) {
+	var via []*http.Request
+	var chain []*url.URL
+	current := httpReq
+	for {
+		httpResp, err := downloader.send(current)
+		if err != nil {
+			return nil, chain, err
+		}
+		next, err := redirectRequest(current, httpResp, downloader.httpClient.Jar != nil)
+		if err != nil {
+			closeBody(httpResp)
+			return nil, chain, genError(err.Error())
+		}
+		if next == nil {
+			return httpResp, chain, nil
+		}
+		downloader.domains.stripAuth(next, current.URL)
+		via = append(via, current)
+		if err := downloader.redirector.check(next, via); err != nil {
+			if err == http.ErrUseLastResponse {
+				return httpResp, chain, nil
+			}
+			closeBody(httpResp)
+			if scopeErr, ok := err.(*RedirectOutOfScopeError); ok {
+				atomic.AddUint64(&downloader.redirector.blockedCount, 1)
+				return nil, chain, scopeErr
+			}
+			return nil, chain, genError(err.Error())
+		}
+		closeBody(httpResp)
+		atomic.AddUint64(&downloader.redirector.followedCount, 1)
+		logger.Infof("跟随重定向 (%s -> %s)\n", current.URL, next.URL)
+		chain = append(chain, next.URL)
+		current = next
+	}
+}
+
+// 用于丢弃并关闭响应体
+func closeBody(httpResp *http.Response) {
+	if httpResp.Body == nil {
+		return
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(httpResp.Body, 4096))
+	httpResp.Body.Close()
+}
+
+func (downloader *myDownloader) SetRedirectScope(scope module.RedirectScope) {
+	downloader.redirector.scopeLock.Lock()
+	defer downloader.redirector.scopeLock.Unlock()
+	downloader.redirector.scope = scope
+}
+
+// 代表重定向的摘要类型
+type redirectSummaryStruct struct {
+	MaxRedirects uint32 `json:"max_redirects"`
+	Followed     uint64 `json:"followed"`
+	Blocked      uint64 `json:"blocked"`
+}
+
+// 用于获取重定向的摘要
+func (r *redirector) summary() redirectSummaryStruct {
+	return redirectSummaryStruct{
+		MaxRedirects: r.maxRedirects,
+		Followed:     atomic.LoadUint64(&r.followedCount),
+		Blocked:      atomic.LoadUint64(&r.blockedCount),
+	}
+}
@@ -0,0 +1,228 @@
+package downloader
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"../../../module"
+	"../../../toolkit/warc"
+	"../../stub"
+)
+
+// 代表回放数据源的接口类型
+// 该接口的实现类型必须是并发安全的
+type ReplaySource interface {
+	// 用于查找与给定请求对应的已录制响应
+	// 若未找到，则两个结果值都为nil
+	Lookup(httpReq *http.Request) (*http.Response, error)
+}
+
+// 用于根据路径创建回放数据源
+// 路径为目录时视为录制目录，否则视为WARC文件
+func OpenReplaySource(path string) (ReplaySource, error) {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return nil, genParameterError("无效的回放路径: " + err.Error())
+	}
+	if fileInfo.IsDir() {
+		return NewFixtureSource(path)
+	}
+	return NewWARCSource(path)
+}
+
+// 代表基于WARC文件的回放数据源的实现类型
+type warcSource struct {
+	// 代表请求键与响应报文的映射
+	responses map[string][]byte
+}
+
+// 用于创建一个基于WARC文件的回放数据源
+// 所有response记录都会被载入内存，同一请求出现多次时以最后一次为准，
+// 但未变化（304）的响应不会替换已载入的完整响应
+func NewWARCSource(paths ...string) (ReplaySource, error) {
+	if len(paths) == 0 {
+		return nil, genParameterError("空的WARC文件列表")
+	}
+	source := &warcSource{responses: map[string][]byte{}}
+	for _, path := range paths {
+		// 响应记录ID与请求报文的映射，由request记录的WARC-Concurrent-To得出
+		requests := map[string][]byte{}
+		blocks := map[string]*warc.Record{}
+		var order []string
+		err := warc.ReadFile(path, func(record *warc.Record) error {
+			switch record.Type() {
+			case warc.RECORD_TYPE_REQUEST:
+				respID := record.Header.Get(warc.HEADER_CONCURRENT_TO)
+				if respID != "" {
+					requests[respID] = record.Block
+				}
+			case warc.RECORD_TYPE_RESPONSE:
+				id := record.Header.Get(warc.HEADER_RECORD_ID)
+				blocks[id] = record
+				order = append(order, id)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, genError(err.Error())
+		}
+		for _, id := range order {
+			record := blocks[id]
+			method, body := splitRequest(requests[id])
+			key := replayKey(method, record.TargetURI(), body)
+			if _, ok := source.responses[key]; ok && notModified(record.Block) {
+				continue
+			}
+			source.responses[key] = record.Block
+		}
+	}
+	return source, nil
+}
+
+func (source *warcSource) Lookup(httpReq *http.Request) (*http.Response, error) {
+	key := replayKey(httpReq.Method, httpReq.URL.String(), requestBody(httpReq))
+	block, ok := source.responses[key]
+	if !ok {
+		return nil, nil
+	}
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(block)), httpReq)
+}
+
+// 用于生成查找已录制响应所用的回放键
+// 带有请求体的请求（如表单POST）会把请求体的摘要计入键中，
+// 以免同一URL下请求体不同的请求（如分页请求）互相覆盖
+func replayKey(method string, rawURL string, body []byte) string {
+	if method == "" {
+		method = http.MethodGet
+	}
+	key := method + " " + rawURL
+	if len(body) == 0 {
+		return key
+	}
+	sum := sha1.Sum(body)
+	return key + "#" + hex.EncodeToString(sum[:])
+}
+
+// 用于从请求报文中取出请求方法和请求体
+func splitRequest(block []byte) (string, []byte) {
+	var method string
+	if index := bytes.IndexByte(block, ' '); index > 0 {
+		method = string(block[:index])
+	}
+	var body []byte
+	if index := bytes.Index(block, []byte("\r\n\r\n")); index >= 0 {
+		body = block[index+4:]
+	}
+	return method, body
+}
+
+// 用于判断响应报文的状态码是否为304
+func notModified(block []byte) bool {
+	line := block
+	if index := bytes.IndexByte(block, '\n'); index >= 0 {
+		line = block[:index]
+	}
+	fields := bytes.Fields(line)
+	return len(fields) >= 2 && string(fields[1]) == "304"
+}
+
+// 代表回放下载器的实现类型
+// 它不访问网络，而是从回放数据源中取出已录制的响应
+type replayDownloader struct {
+	// 代表组件基础实例
+	stub.ModuleInternal
+	// 代表回放数据源
+	source ReplaySource
+}
+
+// 用于创建一个回放下载器实例
+func NewReplayer(mid module.MID, source ReplaySource,
+	scoreCalculator module.CalculateScore) (module.Downloader, error) {
+	moduleBase, err := stub.NewModuleInternal(mid, scoreCalculator)
+	if err != nil {
+		return nil, err
+	}
+	if source == nil {
+		return nil, genParameterError("空的回放数据源")
+	}
+	return &replayDownloader{
+		ModuleInternal: moduleBase,
+		source:         source,
+	}, nil
+}
+
+func (downloader *replayDownloader) Download(req *module.Request) (*module.Response, error) {
+	downloader.ModuleInternal.IncrHandlingNumber()
+	defer downloader.ModuleInternal.DecrHandlingNumber()
+	downloader.ModuleInternal.IncrCalledCount()
+	if req == nil {
+		return nil, genParameterError("空的请求")
+	}
+	httpReq := req.HTTPReq()
+	if httpReq == nil || httpReq.URL == nil {
+		return nil, genParameterError("空的 HTTP 请求")
+	}
+	downloader.ModuleInternal.IncrAcceptedCount()
+	logger.Infof("下载器正在回放请求 (URL: %s, depth: %d)... \n", httpReq.URL, req.Depth())
+	httpResp, chain, err := downloader.lookup(httpReq)
+	if err != nil {
+		return nil, genError(fmt.Sprintf("读取已录制的响应出现异常: %s (URL: %s)", err, httpReq.URL))
+	}
+	if httpResp == nil {
+		return nil, genError(fmt.Sprintf("未找到已录制的响应 (URL: %s)", httpReq.URL))
+	}
+	downloader.ModuleInternal.IncrCompletedCount()
+	resp := module.NewResponse(httpResp, req.Depth())
+	resp.SetRedirectChain(chain)
+	return resp, nil
+}
+
+// 用于查找已录制的响应，并跟随其中已录制了目标的重定向
+// 第二个结果值为重定向经过的URL的列表
+func (downloader *replayDownloader) lookup(httpReq *http.Request) (*http.Response, []*url.URL, error) {
+	var chain []*url.URL
+	current := httpReq
+	httpResp, err := downloader.source.Lookup(current)
+	if err != nil || httpResp == nil {
+		return nil, nil, err
+	}
+	for uint32(len(chain)) < DEFAULT_MAX_REDIRECTS && isRedirect(httpResp.StatusCode) {
+		location := httpResp.Header.Get("Location")
+		if location == "" {
+			break
+		}
+		target, err := current.URL.Parse(location)
+		if err != nil {
+			break
+		}
+		next := hopRequest(httpReq, target)
+		nextResp, err := downloader.source.Lookup(next)
+		if err != nil {
+			httpResp.Body.Close()
+			return nil, chain, err
+		}
+		if nextResp == nil {
+			break
+		}
+		httpResp.Body.Close()
+		httpResp, current = nextResp, next
+		chain = append(chain, target)
+	}
+	return httpResp, chain, nil
+}
+
+// 用于判断状态码是否代表重定向
+func isRedirect(statusCode int) bool {
+	switch statusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
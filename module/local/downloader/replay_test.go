@@ -0,0 +1,177 @@
+package downloader
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"../../../module"
+	"../../../toolkit/warc"
+)
+
+// 用于启动一个带有重定向的测试服务器
+// /start会被重定向到/final，/plain直接返回内容，/pages按表单中的页码返回内容
+func newReplayTestServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/final", http.StatusFound)
+	})
+	mux.HandleFunc("/final", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<a href="next">next</a>`))
+	})
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("plain"))
+	})
+	mux.HandleFunc("/pages", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("page " + r.PostFormValue("page")))
+	})
+	return httptest.NewServer(mux)
+}
+
+func newTestDownloader(t *testing.T, serialNumber uint64) module.Downloader {
+	mid, err := module.GenMID(module.TYPE_DOWNLOADER, serialNumber, nil)
+	if err != nil {
+		t.Fatalf("An error occurs when generating MID: %s", err)
+	}
+	downloader, err := New(mid, &http.Client{}, module.CalculateScoreSimple)
+	if err != nil {
+		t.Fatalf("An error occurs when creating a downloader: %s", err)
+	}
+	return downloader
+}
+
+// 用于下载给定的URL并读出响应体
+func download(t *testing.T, downloader module.Downloader, rawURL string) (*module.Response, string) {
+	httpReq, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		t.Fatalf("An error occurs when creating a request: %s", err)
+	}
+	return downloadRequest(t, downloader, httpReq)
+}
+
+// 用于以表单POST请求给定页码的分页内容并读出响应体
+func downloadPage(t *testing.T, downloader module.Downloader, rawURL string, page string) string {
+	httpReq, err := http.NewRequest(http.MethodPost, rawURL, strings.NewReader("page="+page))
+	if err != nil {
+		t.Fatalf("An error occurs when creating a request: %s", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, body := downloadRequest(t, downloader, httpReq)
+	return body
+}
+
+// 用于发送给定的请求并读出响应体
+func downloadRequest(t *testing.T, downloader module.Downloader,
+	httpReq *http.Request) (*module.Response, string) {
+	rawURL := httpReq.URL.String()
+	resp, err := downloader.Download(module.NewRequest(httpReq, 0))
+	if err != nil {
+		t.Fatalf("An error occurs when downloading %s: %s", rawURL, err)
+	}
+	if resp == nil {
+		t.Fatalf("No response for %s!", rawURL)
+	}
+	body := resp.HTTPResp().Body
+	defer body.Close()
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatalf("An error occurs when reading the body of %s: %s", rawURL, err)
+	}
+	return resp, string(data)
+}
+
+// 用于先录制再回放，并检查回放的结果与录制时一致
+func testRoundTrip(t *testing.T, server *httptest.Server,
+	recorder module.Downloader, openSource func() ReplaySource) {
+	paths := []string{"/start", "/plain"}
+	expected := map[string]string{}
+	for _, path := range paths {
+		_, body := download(t, recorder, server.URL+path)
+		expected[path] = body
+	}
+	// 同一URL下请求体不同的分页请求应分别录制
+	pages := []string{"1", "2"}
+	for _, page := range pages {
+		downloadPage(t, recorder, server.URL+"/pages", page)
+	}
+	mid, _ := module.GenMID(module.TYPE_DOWNLOADER, 2, nil)
+	replayer, err := NewReplayer(mid, openSource(), module.CalculateScoreSimple)
+	if err != nil {
+		t.Fatalf("An error occurs when creating a replayer: %s", err)
+	}
+	for _, path := range paths {
+		_, body := download(t, replayer, server.URL+path)
+		if body != expected[path] {
+			t.Fatalf("Inconsistent body for %s: expected: %q, actual: %q",
+				path, expected[path], body)
+		}
+	}
+	for _, page := range pages {
+		expectedPage := "page " + page
+		if body := downloadPage(t, replayer, server.URL+"/pages", page); body != expectedPage {
+			t.Fatalf("Inconsistent body for page %s: expected: %q, actual: %q", page, expectedPage, body)
+		}
+	}
+	resp, _ := download(t, replayer, server.URL+"/start")
+	finalURL := server.URL + "/final"
+	if actual := resp.HTTPResp().Request.URL.String(); actual != finalURL {
+		t.Fatalf("Inconsistent final URL: expected: %s, actual: %s", finalURL, actual)
+	}
+	chain := resp.RedirectChain()
+	if len(chain) != 1 || chain[0].String() != finalURL {
+		t.Fatalf("Inconsistent redirect chain: expected: [%s], actual: %v", finalURL, chain)
+	}
+	missing, _ := http.NewRequest(http.MethodGet, server.URL+"/missing", nil)
+	if _, err := replayer.Download(module.NewRequest(missing, 0)); err == nil {
+		t.Fatalf("No error when replaying an unrecorded request!")
+	}
+}
+
+func TestFixtureRoundTrip(t *testing.T) {
+	server := newReplayTestServer()
+	defer server.Close()
+	dir := t.TempDir()
+	recorder, err := NewFixtureRecorder(newTestDownloader(t, 1), dir)
+	if err != nil {
+		t.Fatalf("An error occurs when creating a fixture recorder: %s", err)
+	}
+	testRoundTrip(t, server, recorder, func() ReplaySource {
+		source, err := OpenReplaySource(dir)
+		if err != nil {
+			t.Fatalf("An error occurs when opening the fixture directory: %s", err)
+		}
+		return source
+	})
+}
+
+func TestWARCRoundTrip(t *testing.T) {
+	server := newReplayTestServer()
+	defer server.Close()
+	dir := t.TempDir()
+	writer, err := warc.NewWriter(dir, "test", 0)
+	if err != nil {
+		t.Fatalf("An error occurs when creating a WARC writer: %s", err)
+	}
+	recorder, err := NewWARCRecorder(newTestDownloader(t, 1), writer)
+	if err != nil {
+		t.Fatalf("An error occurs when creating a WARC recorder: %s", err)
+	}
+	testRoundTrip(t, server, recorder, func() ReplaySource {
+		if err := writer.Close(); err != nil {
+			t.Fatalf("An error occurs when closing the WARC writer: %s", err)
+		}
+		files, _ := filepath.Glob(filepath.Join(dir, "*.warc"))
+		if len(files) != 1 {
+			t.Fatalf("Inconsistent WARC file count: expected: 1, actual: %d", len(files))
+		}
+		source, err := OpenReplaySource(files[0])
+		if err != nil {
+			t.Fatalf("An error occurs when opening the WARC file: %s", err)
+		}
+		return source
+	})
+}
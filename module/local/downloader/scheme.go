@@ -0,0 +1,115 @@
+package downloader
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// 代表协议处理器的类型
+// 下载器会把相应协议的请求交给它处理，而不经过HTTP客户端（及其代理、Cookie和重定向处理）
+type SchemeHandler interface {
+	http.RoundTripper
+}
+
+// 用于创建一个处理file://协议的协议处理器
+// URL中的路径会被解释为相对于根目录root的路径，请求无法访问根目录之外的文件
+// 请求目录时会返回目录下的index.html或目录列表，文件不存在时返回状态码为404的响应
+func NewFileHandler(root string) SchemeHandler {
+	return http.NewFileTransport(http.Dir(root))
+}
+
+// 代表处理data:协议的协议处理器的实现类型
+type dataHandler struct{}
+
+// 用于创建一个处理data:协议的协议处理器
+// 它会按照RFC 2397解析URL中的媒体类型和数据
+func NewDataHandler() SchemeHandler {
+	return dataHandler{}
+}
+
+func (handler dataHandler) RoundTrip(httpReq *http.Request) (*http.Response, error) {
+	mediaType, data, err := parseDataURL(httpReq.URL)
+	if err != nil {
+		return nil, err
+	}
+	if httpReq.Body != nil {
+		httpReq.Body.Close()
+	}
+	header := http.Header{}
+	header.Set("Content-Type", mediaType)
+	header.Set("Content-Length", strconv.Itoa(len(data)))
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.0",
+		ProtoMajor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       httpReq,
+	}, nil
+}
+
+// 用于解析data:协议的URL，结果值依次为媒体类型和数据
+func parseDataURL(u *url.URL) (string, []byte, error) {
+	raw := u.Opaque
+	if raw == "" {
+		raw = strings.TrimPrefix(u.String(), u.Scheme+":")
+	}
+	i := strings.Index(raw, ",")
+	if i < 0 {
+		return "", nil, fmt.Errorf("无效的data URL: 缺少逗号 (URL: %.64s)", u)
+	}
+	meta, payload := raw[:i], raw[i+1:]
+	isBase64 := false
+	if strings.HasSuffix(strings.ToLower(meta), ";base64") {
+		isBase64 = true
+		meta = meta[:len(meta)-len(";base64")]
+	}
+	mediaType, err := url.PathUnescape(meta)
+	if err != nil {
+		return "", nil, fmt.Errorf("无效的data URL: %s (URL: %.64s)", err, u)
+	}
+	if mediaType == "" {
+		mediaType = "text/plain;charset=US-ASCII"
+	} else if strings.HasPrefix(mediaType, ";") {
+		mediaType = "text/plain" + mediaType
+	}
+	data, err := url.PathUnescape(payload)
+	if err != nil {
+		return "", nil, fmt.Errorf("无效的data URL: %s (URL: %.64s)", err, u)
+	}
+	if !isBase64 {
+		return mediaType, []byte(data), nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		decoded, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(data, "="))
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("无效的data URL: %s (URL: %.64s)", err, u)
+	}
+	return mediaType, decoded, nil
+}
+
+// 用于获取给定请求的协议处理器，http和https请求的结果值为nil
+func (downloader *myDownloader) schemeHandler(httpReq *http.Request) SchemeHandler {
+	if len(downloader.schemeHandlers) == 0 {
+		return nil
+	}
+	return downloader.schemeHandlers[strings.ToLower(httpReq.URL.Scheme)]
+}
+
+func (downloader *myDownloader) SupportsScheme(scheme string) bool {
+	if scheme == "http" || scheme == "https" {
+		return true
+	}
+	_, ok := downloader.schemeHandlers[scheme]
+	return ok
+}
@@ -0,0 +1,358 @@
+package pipeline
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"../../../module"
+	"../../stub"
+)
+
+// 默认的批量大小
+const DEFAULT_BATCH_SIZE = 100
+
+// 默认的批量最长等待时间
+const DEFAULT_BATCH_LATENCY = time.Second
+
+// 异步错误通道的容量
+const errorChanCap = 1024
+
+// 代表批量处理的参数
+type BatchArgs struct {
+	// 批量大小，攒够该数量的条目后会立即处理，为0时使用默认值
+	Size uint32
+	// 最长等待时间，批次中的第一个条目最多等待该时长就会被处理，为0时使用默认值
+	Latency time.Duration
+}
+
+// 用于获取填充了默认值的批量处理参数
+func (args BatchArgs) normalize() BatchArgs {
+	if args.Size == 0 {
+		args.Size = DEFAULT_BATCH_SIZE
+	}
+	if args.Latency <= 0 {
+		args.Latency = DEFAULT_BATCH_LATENCY
+	}
+	return args
+}
+
+// 代表批量条目处理管道的实现类型
+// 条目会先被放入当前批次，批次满或等待超时后才会被依次交给各批量处理函数
+// 处理时产生的错误会以*module.ItemError的形式通过ErrorChan方法返回的通道异步报告
+// 无论批次是因已满、超时还是因调用Flush或Close而被处理，条目的错误都只经由该通道报告，
+// Flush和Close的结果值只包含钩子函数返回的错误，因此每个条目错误只会被报告一次，
+// 并且总能被调度器用于健康统计和死信存储
+type myBatchPipeline struct {
+	// 代表组件基础实例
+	stub.ModuleInternal
+	// 代表接收的条目的模式
+	schemaHolder
+	// 代表批量条目处理函数的列表
+	itemsProcessors []module.ProcessItems
+	// 代表处理是否需要快速失败
+	failFast bool
+	// 代表批量处理的参数
+	args BatchArgs
+	// 代表生命周期钩子
+	hooks Hooks
+	// 代表尚未处理的条目
+	pending []module.Item
+	// 代表当前批次的超时定时器
+	timer *time.Timer
+	// 代表异步错误的通道
+	errorChan chan error
+	// 代表管道是否已关闭
+	closed bool
+	// 代表已处理的批次数
+	batchNumber uint64
+	// 代表保护以上状态的互斥锁
+	lock sync.Mutex
+	// 代表保证批次依次处理的互斥锁
+	processLock sync.Mutex
+}
+
+// 用于创建一个批量条目处理管道
+func NewBatch(mid module.MID, itemsProcessors []module.ProcessItems, args BatchArgs,
+	hooks Hooks, scoreCalculator module.CalculateScore) (module.Pipeline, error) {
+	moduleBase, err := stub.NewModuleInternal(mid, scoreCalculator)
+	if err != nil {
+		return nil, err
+	}
+	if itemsProcessors == nil {
+		return nil, genParameterError("空的批量条目处理列表")
+	}
+	if len(itemsProcessors) == 0 {
+		return nil, genParameterError("批量条目处理列表长度为空")
+	}
+	var innerProcessors []module.ProcessItems
+	for i, processor := range itemsProcessors {
+		if processor == nil {
+			err := genParameterError(fmt.Sprintf("空的批量条目处理函数[%d]", i))
+			return nil, err
+		}
+		innerProcessors = append(innerProcessors, processor)
+	}
+	return &myBatchPipeline{
+		ModuleInternal:  moduleBase,
+		itemsProcessors: innerProcessors,
+		args:            args.normalize(),
+		hooks:           hooks,
+		errorChan:       make(chan error, errorChanCap),
+	}, nil
+}
+
+// 用于把单个条目的处理函数转换为批量处理函数
+func Batched(processor module.ProcessItem) module.ProcessItems {
+	return func(items []module.Item) ([]module.Item, []error) {
+		results := make([]module.Item, len(items))
+		errs := make([]error, len(items))
+		for i, item := range items {
+			results[i], errs[i] = processor(item)
+		}
+		return results, errs
+	}
+}
+
+// 用于以单个条目的方式调用批量处理函数
+func unbatched(processor module.ProcessItems) module.ProcessItem {
+	return func(item module.Item) (module.Item, error) {
+		results, errs := processor([]module.Item{item})
+		var result module.Item
+		if len(results) > 0 {
+			result = results[0]
+		}
+		var err error
+		if len(errs) > 0 {
+			err = errs[0]
+		}
+		return result, err
+	}
+}
+
+// 用于获取以单个条目的方式调用各批量处理函数的列表
+func (pipeline *myBatchPipeline) ItemProcessors() []module.ProcessItem {
+	processors := make([]module.ProcessItem, len(pipeline.itemsProcessors))
+	for i, processor := range pipeline.itemsProcessors {
+		processors[i] = unbatched(processor)
+	}
+	return processors
+}
+
+// 用于把条目放入当前批次
+// 批次满时会在当前调用中完成处理，否则会立即返回
+// 结果值只包含条目未能放入批次的错误，处理时的错误会被异步报告
+func (pipeline *myBatchPipeline) Send(item module.Item) []error {
+	pipeline.ModuleInternal.IncrCalledCount()
+	if item == nil {
+		return []error{genParameterError("空条目")}
+	}
+	pipeline.lock.Lock()
+	if pipeline.closed {
+		pipeline.lock.Unlock()
+		return []error{genError("条目处理管道已关闭")}
+	}
+	pipeline.ModuleInternal.IncrAcceptedCount()
+	pipeline.ModuleInternal.IncrHandlingNumber()
+	pipeline.pending = append(pipeline.pending, item)
+	var batch []module.Item
+	if uint32(len(pipeline.pending)) >= pipeline.args.Size {
+		batch = pipeline.takeBatch()
+	} else if pipeline.timer == nil {
+		pipeline.timer = time.AfterFunc(pipeline.args.Latency, pipeline.expire)
+	}
+	pipeline.lock.Unlock()
+	if batch != nil {
+		pipeline.reportErrors(pipeline.process(batch))
+	}
+	return nil
+}
+
+// 用于在当前批次等待超时后处理它
+func (pipeline *myBatchPipeline) expire() {
+	pipeline.lock.Lock()
+	batch := pipeline.takeBatch()
+	pipeline.lock.Unlock()
+	if batch != nil {
+		pipeline.reportErrors(pipeline.process(batch))
+	}
+}
+
+// 用于取出当前批次并停止其定时器
+// 调用方需持有互斥锁
+func (pipeline *myBatchPipeline) takeBatch() []module.Item {
+	if pipeline.timer != nil {
+		pipeline.timer.Stop()
+		pipeline.timer = nil
+	}
+	if len(pipeline.pending) == 0 {
+		return nil
+	}
+	batch := pipeline.pending
+	pipeline.pending = nil
+	return batch
+}
+
+// 用于让一个批次依次经过各批量处理函数的处理，并返回处理时出现的错误
+// 在快速失败模式下，出错的条目不会再交给后续的处理函数
+func (pipeline *myBatchPipeline) process(batch []module.Item) []error {
+	if len(batch) == 0 {
+		return nil
+	}
+	pipeline.processLock.Lock()
+	defer pipeline.processLock.Unlock()
+	failFast := pipeline.FailFast()
+	current := make([]module.Item, len(batch))
+	copy(current, batch)
+	failed := make([]bool, len(batch))
+	var errs []error
+	for _, processor := range pipeline.itemsProcessors {
+		var indexes []int
+		var items []module.Item
+		for i, item := range current {
+			if failFast && failed[i] {
+				continue
+			}
+			indexes = append(indexes, i)
+			items = append(items, item)
+		}
+		if len(items) == 0 {
+			break
+		}
+		results, processErrs := processor(items)
+		for j, i := range indexes {
+			if j < len(processErrs) && processErrs[j] != nil {
+				errs = append(errs, &module.ItemError{Item: batch[i], Err: processErrs[j]})
+				failed[i] = true
+			}
+			if j < len(results) && results[j] != nil {
+				current[i] = results[j]
+			}
+		}
+	}
+	for i := range batch {
+		if !failed[i] {
+			pipeline.ModuleInternal.IncrCompletedCount()
+		}
+		pipeline.ModuleInternal.DecrHandlingNumber()
+	}
+	pipeline.lock.Lock()
+	pipeline.batchNumber++
+	pipeline.lock.Unlock()
+	return errs
+}
+
+// 用于异步报告错误
+func (pipeline *myBatchPipeline) reportErrors(errs []error) {
+	pipeline.lock.Lock()
+	defer pipeline.lock.Unlock()
+	if pipeline.closed {
+		for _, err := range errs {
+			logger.Errorf("条目处理管道已关闭，忽略错误: %s (MID: %s)", err, pipeline.ID())
+		}
+		return
+	}
+	pipeline.pushErrors(errs)
+}
+
+// 用于把错误放入错误通道，通道已满时相应的错误会被记录到日志中
+// 调用方需持有互斥锁
+func (pipeline *myBatchPipeline) pushErrors(errs []error) {
+	for _, err := range errs {
+		select {
+		case pipeline.errorChan <- err:
+		default:
+			logger.Errorf("错误通道已满，忽略错误: %s (MID: %s)", err, pipeline.ID())
+		}
+	}
+}
+
+func (pipeline *myBatchPipeline) ErrorChan() <-chan error {
+	pipeline.lock.Lock()
+	defer pipeline.lock.Unlock()
+	return pipeline.errorChan
+}
+
+// 用于打开管道，已关闭的管道会被重新启用
+func (pipeline *myBatchPipeline) Open() error {
+	pipeline.lock.Lock()
+	if pipeline.closed {
+		pipeline.errorChan = make(chan error, errorChanCap)
+		pipeline.closed = false
+	}
+	pipeline.lock.Unlock()
+	if pipeline.hooks.Open == nil {
+		return nil
+	}
+	return pipeline.hooks.Open()
+}
+
+// 用于立即处理当前批次
+// 条目的处理错误仍会被异步报告，结果值只包含钩子函数返回的错误
+func (pipeline *myBatchPipeline) Flush() error {
+	pipeline.lock.Lock()
+	batch := pipeline.takeBatch()
+	pipeline.lock.Unlock()
+	pipeline.reportErrors(pipeline.process(batch))
+	if pipeline.hooks.Flush == nil {
+		return nil
+	}
+	return pipeline.hooks.Flush()
+}
+
+// 用于处理剩余的条目并关闭管道
+// 剩余条目的处理错误被放入错误通道后，该通道会被关闭
+func (pipeline *myBatchPipeline) Close() error {
+	pipeline.lock.Lock()
+	if pipeline.closed {
+		pipeline.lock.Unlock()
+		return nil
+	}
+	pipeline.closed = true
+	batch := pipeline.takeBatch()
+	pipeline.lock.Unlock()
+	errs := pipeline.process(batch)
+	pipeline.lock.Lock()
+	pipeline.pushErrors(errs)
+	close(pipeline.errorChan)
+	pipeline.lock.Unlock()
+	if pipeline.hooks.Close == nil {
+		return nil
+	}
+	return pipeline.hooks.Close()
+}
+
+func (pipeline *myBatchPipeline) FailFast() bool {
+	pipeline.lock.Lock()
+	defer pipeline.lock.Unlock()
+	return pipeline.failFast
+}
+
+func (pipeline *myBatchPipeline) SetFailFast(failFast bool) {
+	pipeline.lock.Lock()
+	defer pipeline.lock.Unlock()
+	pipeline.failFast = failFast
+}
+
+// 代表批量条目处理管道额外信息的摘要类型
+type batchExtraSummaryStruct struct {
+	FailFast        bool   `json:"fail_fast"`
+	ProcessorNumber int    `json:"processor_number"`
+	BatchSize       uint32 `json:"batch_size"`
+	BatchLatency    string `json:"batch_latency"`
+	BatchNumber     uint64 `json:"batch_number"`
+}
+
+func (pipeline *myBatchPipeline) Summary() module.SummaryStruct {
+	summary := pipeline.ModuleInternal.Summary()
+	pipeline.lock.Lock()
+	defer pipeline.lock.Unlock()
+	summary.Extra = batchExtraSummaryStruct{
+		FailFast:        pipeline.failFast,
+		ProcessorNumber: len(pipeline.itemsProcessors),
+		BatchSize:       pipeline.args.Size,
+		BatchLatency:    pipeline.args.Latency.String(),
+		BatchNumber:     pipeline.batchNumber,
+	}
+	return summary
+}
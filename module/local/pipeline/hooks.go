@@ -0,0 +1,33 @@
+package pipeline
+
+// 代表条目处理管道的生命周期钩子
+// 各钩子都可以为nil，调度器会在启动、运行期间和停止时分别调用它们
+type Hooks struct {
+	// 在调度器启动时调用，用于打开文件等资源
+	Open func() error
+	// 在运行期间定期调用，以及在停止时先于Close调用，用于写出缓冲的数据
+	Flush func() error
+	// 在调度器停止时调用，用于完成最终输出并释放资源
+	Close func() error
+}
+
+func (pipeline *myPipeline) Open() error {
+	if pipeline.hooks.Open == nil {
+		return nil
+	}
+	return pipeline.hooks.Open()
+}
+
+func (pipeline *myPipeline) Flush() error {
+	if pipeline.hooks.Flush == nil {
+		return nil
+	}
+	return pipeline.hooks.Flush()
+}
+
+func (pipeline *myPipeline) Close() error {
+	if pipeline.hooks.Close == nil {
+		return nil
+	}
+	return pipeline.hooks.Close()
+}
@@ -18,9 +18,19 @@ type myPipeline struct {
 	itemProcessors []module.ProcessItem
 	// 代表处理是否需要快速失败
 	failFast bool
+	// 代表生命周期钩子
+	hooks Hooks
+	// 代表接收的条目的模式
+	schemaHolder
 }
 
 func New(mid module.MID, itemProcessors []module.ProcessItem,
+	scoreCalculator module.CalculateScore) (module.Pipeline, error) {
+	return NewWithHooks(mid, itemProcessors, Hooks{}, scoreCalculator)
+}
+
+// 用于创建一个带有生命周期钩子的条目处理管道
+func NewWithHooks(mid module.MID, itemProcessors []module.ProcessItem, hooks Hooks,
 	scoreCalculator module.CalculateScore) (module.Pipeline, error) {
 	moduleBase, err := stub.NewModuleInternal(mid, scoreCalculator)
 	if err != nil {
@@ -43,6 +53,7 @@ func New(mid module.MID, itemProcessors []module.ProcessItem,
 	return &myPipeline{
 		ModuleInternal: moduleBase,
 		itemProcessors: innerProcessors,
+		hooks:          hooks,
 	}, nil
 }
 
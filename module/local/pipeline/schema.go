@@ -0,0 +1,33 @@
+package pipeline
+
+import (
+	"sync"
+
+	"../../../module"
+)
+
+// 代表条目模式的持有者，供各条目处理管道嵌入
+type schemaHolder struct {
+	// 代表接收的条目的模式
+	schema *module.Schema
+	// 代表读写锁
+	rwLock sync.RWMutex
+}
+
+func (holder *schemaHolder) Schema() *module.Schema {
+	holder.rwLock.RLock()
+	defer holder.rwLock.RUnlock()
+	return holder.schema
+}
+
+func (holder *schemaHolder) SetSchema(schema *module.Schema) error {
+	if schema != nil {
+		if err := schema.Check(); err != nil {
+			return genParameterError(err.Error())
+		}
+	}
+	holder.rwLock.Lock()
+	defer holder.rwLock.Unlock()
+	holder.schema = schema
+	return nil
+}
@@ -0,0 +1,14 @@
+package module
+
+import "net/url"
+
+// 代表重定向范围检查函数的类型
+// 返回非nil的错误值时表示重定向的目标超出了爬取范围
+type RedirectScope func(target *url.URL) error
+
+// 可以按照调度器的爬取范围检查重定向的下载器的接口类型
+// 下载器可以选择性地实现该接口，调度器会在初始化时为其设置范围检查函数
+type RedirectScoper interface {
+	// 用于设置重定向范围检查函数
+	SetRedirectScope(scope RedirectScope)
+}
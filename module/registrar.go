@@ -2,7 +2,9 @@ package module
 
 import (
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"../errors"
 )
@@ -16,12 +18,31 @@ type Registrar interface {
 	// 用于获取一个指定类型的组件实例
 	// 该函数基于负载均衡策略返回实例
 	Get(moduleType Type) (Module, error)
+	// 用于从给定的组件ID范围内获取一个指定类型的组件实例
+	// 参数mids为空时等同于Get
+	GetFrom(moduleType Type, mids []MID) (Module, error)
 	// 用于获取指定类型的所有组件实例
 	GetAllByType(moduleType Type) (map[MID]Module, error)
 	// 用于获取所有组件实例
 	GetAll() map[MID]Module
 	// 清除所有的组件注册记录
 	Clear()
+	// 用于设置负载均衡器，参数为nil时使用基于组件评分的负载均衡器
+	SetBalancer(balancer Balancer)
+	// 用于获取当前使用的负载均衡器
+	Balancer() Balancer
+	// 用于报告一次组件调用的耗时与结果
+	// 调用结果同时会被用于被动的健康统计
+	Observe(mid MID, latency time.Duration, err error)
+	// 用于报告组件在调用之外（如异步处理时）出现的错误
+	// 该错误只会被用于被动的健康统计
+	ReportError(mid MID, err error)
+	// 用于设置组件的健康策略
+	SetHealthPolicy(policy HealthPolicy)
+	// 用于对所有实现了HealthChecker接口的组件进行一次健康检查
+	CheckHealth()
+	// 用于获取指定组件的健康状况摘要
+	Health(mid MID) HealthSummary
 }
 
 // 代表组件注册器的实现类型
@@ -30,12 +51,20 @@ type myRegistrar struct {
 	moduleTypeMap map[Type]map[MID]Module
 	// rwlock 代表组件注册专用读写锁
 	rwLock sync.RWMutex
+	// balancer 代表负载均衡器
+	balancer Balancer
+	// balancerLock 代表负载均衡器专用读写锁
+	balancerLock sync.RWMutex
+	// health 代表组件健康状况的跟踪器
+	health *healthTracker
 }
 
 // 用于创建一个组件注册器的实例
 func NewRegistrar() Registrar {
 	return &myRegistrar{
 		moduleTypeMap: map[Type]map[MID]Module{},
+		balancer:      NewScoreBalancer(),
+		health:        newHealthTracker(HealthPolicy{}),
 	}
 }
 
@@ -82,26 +111,58 @@ func (registrar *myRegistrar) Unregister(mid MID) (bool, error) {
 			deleted = true
 		}
 	}
+	if deleted {
+		registrar.health.remove(mid)
+	}
 	return deleted, nil
 }
 
 // 用于获取一个指定类型的组件的实例
 // 本函数会基于负载均衡策略返回实例
+// 候选组件会先按组件ID排序，以免选择结果受字典遍历顺序的影响
+// 不健康的组件不会被选中，除非该类型的所有组件都不健康
 func (registrar *myRegistrar) Get(moduleType Type) (Module, error) {
+	return registrar.GetFrom(moduleType, nil)
+}
+
+// 用于从给定的组件ID范围内获取一个指定类型的组件实例
+// 参数mids为空时等同于Get，其中未注册的组件ID会被忽略
+func (registrar *myRegistrar) GetFrom(moduleType Type, mids []MID) (Module, error) {
 	modules, err := registrar.GetAllByType(moduleType)
 	if err != nil {
 		return nil, err
 	}
-	minScore := uint64(0)
-	var selectedModule Module
-	for _, module := range modules {
-		SetScore(module)
-		score := module.Score()
-		if minScore == 0 || score < minScore {
-			selectedModule = module
-			minScore = score
+	if len(mids) > 0 {
+		subset := map[MID]Module{}
+		for _, mid := range mids {
+			if module, ok := modules[mid]; ok {
+				subset[mid] = module
+			}
+		}
+		if len(subset) == 0 {
+			return nil, ErrNotFoundModuleInstance
+		}
+		modules = subset
+	}
+	now := time.Now()
+	candidates := make([]Module, 0, len(modules))
+	for mid, module := range modules {
+		if registrar.health.healthy(mid, now) {
+			candidates = append(candidates, module)
 		}
 	}
+	if len(candidates) == 0 {
+		for _, module := range modules {
+			candidates = append(candidates, module)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].ID() < candidates[j].ID()
+	})
+	selectedModule := registrar.Balancer().Select(moduleType, candidates)
+	if selectedModule == nil {
+		return nil, ErrNotFoundModuleInstance
+	}
 	return selectedModule, nil
 }
 
@@ -142,4 +203,53 @@ func (registrar *myRegistrar) Clear() {
 	registrar.rwLock.Lock()
 	defer registrar.rwLock.Unlock()
 	registrar.moduleTypeMap = map[Type]map[MID]Module{}
+	registrar.health.clear()
+}
+
+func (registrar *myRegistrar) SetBalancer(balancer Balancer) {
+	if balancer == nil {
+		balancer = NewScoreBalancer()
+	}
+	registrar.balancerLock.Lock()
+	defer registrar.balancerLock.Unlock()
+	registrar.balancer = balancer
+}
+
+func (registrar *myRegistrar) Balancer() Balancer {
+	registrar.balancerLock.RLock()
+	defer registrar.balancerLock.RUnlock()
+	return registrar.balancer
+}
+
+// 只有负载均衡器实现了FeedbackBalancer接口时，调用反馈才会被负载均衡器使用
+func (registrar *myRegistrar) Observe(mid MID, latency time.Duration, err error) {
+	registrar.health.observe(mid, err)
+	if fb, ok := registrar.Balancer().(FeedbackBalancer); ok {
+		fb.Observe(mid, latency, err)
+	}
+}
+
+func (registrar *myRegistrar) ReportError(mid MID, err error) {
+	if err == nil {
+		return
+	}
+	registrar.health.observe(mid, err)
+}
+
+func (registrar *myRegistrar) SetHealthPolicy(policy HealthPolicy) {
+	registrar.health.setPolicy(policy)
+}
+
+func (registrar *myRegistrar) CheckHealth() {
+	for mid, module := range registrar.GetAll() {
+		checker, ok := module.(HealthChecker)
+		if !ok {
+			continue
+		}
+		registrar.health.recordCheck(mid, checker.CheckHealth())
+	}
+}
+
+func (registrar *myRegistrar) Health(mid MID) HealthSummary {
+	return registrar.health.summary(mid)
 }
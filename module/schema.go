@@ -0,0 +1,229 @@
+package module
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"../errors"
+)
+
+// 代表条目字段类型的类型
+type FieldType string
+
+// 当前支持的条目字段类型的常量
+const (
+	// 任意非nil的值
+	FIELD_TYPE_ANY FieldType = "any"
+	// 字符串
+	FIELD_TYPE_STRING FieldType = "string"
+	// 任意整数或浮点数
+	FIELD_TYPE_NUMBER FieldType = "number"
+	// 整数，值为整数的浮点数也被接受
+	FIELD_TYPE_INTEGER FieldType = "integer"
+	// 布尔值
+	FIELD_TYPE_BOOL FieldType = "bool"
+	// 实现了io.Reader接口的值
+	FIELD_TYPE_READER FieldType = "reader"
+	// 切片或数组
+	FIELD_TYPE_LIST FieldType = "list"
+	// 字典
+	FIELD_TYPE_MAP FieldType = "map"
+)
+
+// 代表字符串字段格式的类型
+type FieldFormat string
+
+// 当前支持的字符串字段格式的常量
+const (
+	// 绝对URL
+	FIELD_FORMAT_URL FieldFormat = "url"
+	// 电子邮件地址
+	FIELD_FORMAT_EMAIL FieldFormat = "email"
+	// 可以解析为数字的字符串
+	FIELD_FORMAT_NUMBER FieldFormat = "number"
+)
+
+// 代表条目字段的声明
+type Field struct {
+	// 字段名称
+	Name string `json:"name"`
+	// 字段类型，为空时等同于FIELD_TYPE_ANY
+	Type FieldType `json:"type,omitempty"`
+	// 是否为必需字段
+	Required bool `json:"required,omitempty"`
+	// 字段格式，仅适用于字符串值，为空时不检查
+	Format FieldFormat `json:"format,omitempty"`
+}
+
+// 代表条目模式的类型
+// 可选的字段缺失或值为nil时不会被检查
+type Schema struct {
+	// 模式的名称
+	Name string `json:"name"`
+	// 字段声明的列表
+	Fields []Field `json:"fields"`
+	// 为true时不允许出现未声明的字段
+	Strict bool `json:"strict,omitempty"`
+}
+
+// 代表条目字段不符合模式的错误类型
+type FieldViolation struct {
+	// 字段名称
+	Field string
+	// 不符合的原因
+	Reason string
+}
+
+func (violation FieldViolation) Error() string {
+	return fmt.Sprintf("条目字段 %q 不符合模式: %s", violation.Field, violation.Reason)
+}
+
+// 声明了条目模式的组件的接口类型
+// 分析器的模式约束其产出的条目，条目处理管道的模式约束其接收的条目
+type SchemaHolder interface {
+	// 用于获取条目模式，为nil时表示不做检查
+	Schema() *Schema
+	// 用于设置条目模式，参数为nil时表示不做检查
+	SetSchema(schema *Schema) error
+}
+
+// 用于自检模式的有效性
+func (schema *Schema) Check() error {
+	names := map[string]bool{}
+	for i, field := range schema.Fields {
+		if field.Name == "" {
+			return errors.NewIllegalParameterError(fmt.Sprintf("空的字段名称[%d]", i))
+		}
+		if names[field.Name] {
+			return errors.NewIllegalParameterError(fmt.Sprintf("重复的字段名称: %s", field.Name))
+		}
+		names[field.Name] = true
+		switch field.Type {
+		case "", FIELD_TYPE_ANY, FIELD_TYPE_STRING, FIELD_TYPE_NUMBER, FIELD_TYPE_INTEGER,
+			FIELD_TYPE_BOOL, FIELD_TYPE_READER, FIELD_TYPE_LIST, FIELD_TYPE_MAP:
+		default:
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("不支持的字段类型: %s (字段: %s)", field.Type, field.Name))
+		}
+		switch field.Format {
+		case "", FIELD_FORMAT_URL, FIELD_FORMAT_EMAIL, FIELD_FORMAT_NUMBER:
+		default:
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("不支持的字段格式: %s (字段: %s)", field.Format, field.Name))
+		}
+	}
+	return nil
+}
+
+// 用于检查条目是否符合模式
+// 结果值按字段声明的顺序排列，未声明的字段排在最后
+func (schema *Schema) Validate(item Item) []FieldViolation {
+	var violations []FieldViolation
+	declared := map[string]bool{}
+	for _, field := range schema.Fields {
+		declared[field.Name] = true
+		value, ok := item[field.Name]
+		if !ok || value == nil {
+			if field.Required {
+				violations = append(violations, FieldViolation{field.Name, "缺少必需的字段"})
+			}
+			continue
+		}
+		if reason := checkFieldType(field.Type, value); reason != "" {
+			violations = append(violations, FieldViolation{field.Name, reason})
+			continue
+		}
+		if reason := checkFieldFormat(field.Format, value); reason != "" {
+			violations = append(violations, FieldViolation{field.Name, reason})
+		}
+	}
+	if schema.Strict {
+		var unknown []string
+		for name := range item {
+			if !declared[name] {
+				unknown = append(unknown, name)
+			}
+		}
+		sort.Strings(unknown)
+		for _, name := range unknown {
+			violations = append(violations, FieldViolation{name, "未声明的字段"})
+		}
+	}
+	return violations
+}
+
+// 用于检查值的类型，不符合时返回原因
+func checkFieldType(fieldType FieldType, value interface{}) string {
+	var ok bool
+	kind := reflect.TypeOf(value).Kind()
+	switch fieldType {
+	case "", FIELD_TYPE_ANY:
+		ok = true
+	case FIELD_TYPE_STRING:
+		_, ok = value.(string)
+	case FIELD_TYPE_NUMBER:
+		ok = isInteger(kind) || kind == reflect.Float32 || kind == reflect.Float64
+	case FIELD_TYPE_INTEGER:
+		ok = isInteger(kind)
+		if kind == reflect.Float32 || kind == reflect.Float64 {
+			f := reflect.ValueOf(value).Float()
+			ok = f == math.Trunc(f) && !math.IsInf(f, 0)
+		}
+	case FIELD_TYPE_BOOL:
+		_, ok = value.(bool)
+	case FIELD_TYPE_READER:
+		_, ok = value.(io.Reader)
+	case FIELD_TYPE_LIST:
+		ok = kind == reflect.Slice || kind == reflect.Array
+	case FIELD_TYPE_MAP:
+		ok = kind == reflect.Map
+	}
+	if !ok {
+		return fmt.Sprintf("类型错误: 需要 %s，实际为 %T", fieldType, value)
+	}
+	return ""
+}
+
+// 用于判断给定的种类是否为整数
+func isInteger(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// 用于检查值的格式，不符合时返回原因
+func checkFieldFormat(format FieldFormat, value interface{}) string {
+	if format == "" {
+		return ""
+	}
+	s, ok := value.(string)
+	if !ok {
+		return fmt.Sprintf("格式 %s 只适用于字符串，实际为 %T", format, value)
+	}
+	switch format {
+	case FIELD_FORMAT_URL:
+		u, err := url.Parse(s)
+		if err != nil || !u.IsAbs() || u.Host == "" {
+			return fmt.Sprintf("不是有效的URL: %q", s)
+		}
+	case FIELD_FORMAT_EMAIL:
+		addr, err := mail.ParseAddress(s)
+		if err != nil || addr.Address != s {
+			return fmt.Sprintf("不是有效的电子邮件地址: %q", s)
+		}
+	case FIELD_FORMAT_NUMBER:
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return fmt.Sprintf("不是有效的数字: %q", s)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,9 @@
+package module
+
+// 可以处理非HTTP协议的请求的下载器的接口类型
+// 下载器可以选择性地实现该接口，调度器会据此决定接受哪些协议的请求
+// 未实现该接口的下载器只被认为支持http和https
+type SchemeSupporter interface {
+	// 用于判断下载器是否支持给定的协议，参数scheme为小写形式
+	SupportsScheme(scheme string) bool
+}
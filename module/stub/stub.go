@@ -94,6 +94,7 @@ func (m *myModule) Summary() module.SummaryStruct {
 		Accepted:  counts.AcceptedCount,
 		Completed: counts.CompletedCount,
 		Handling:  counts.HandlingNumber,
+		Health:    module.HealthSummary{Healthy: true},
 		Extra:     nil,
 	}
 }
@@ -1,6 +1,12 @@
 package scheduler
 
-import "../module"
+import (
+	"fmt"
+	"time"
+
+	"../module"
+	"../toolkit/deadletter"
+)
 
 // 参数容器的接口类型
 type Args interface {
@@ -66,6 +72,8 @@ type DataArgs struct {
 	ErrorBufferCap uint32 `json:"error_buffer_cap"`
 	// 错误缓冲器的最大数量
 	ErrorMaxBufferNumber uint32 `json:"error_max_buffer_number"`
+	// 死信存储，处理失败的条目和下载失败的请求会被放入其中，为nil时只记录错误
+	DeadLetterStore deadletter.Store `json:"-"`
 }
 
 func (args *DataArgs) Check() error {
@@ -98,9 +106,11 @@ func (args *DataArgs) Check() error {
 
 // 代表组件相关的参数容器的摘要类型
 type ModuleArgsSummary struct {
-	DownloaderListSize int `json:"downloader_list_size"`
-	AnalyzerListSize   int `json:"analyzer_list_size"`
-	PipelineListSize   int `json:"pipeline_list_size"`
+	DownloaderListSize int    `json:"downloader_list_size"`
+	AnalyzerListSize   int    `json:"analyzer_list_size"`
+	PipelineListSize   int    `json:"pipeline_list_size"`
+	Balancer           string `json:"balancer"`
+	ItemRouteNumber    int    `json:"item_route_number"`
 }
 
 // 组件相关的参数容器的类型
@@ -111,6 +121,23 @@ type ModuleArgs struct {
 	Analyzers []module.Analyzer
 	// 条目处理管道管道列表
 	Pipelines []module.Pipeline
+	// 选取组件实例时使用的负载均衡器
+	// 为nil时使用基于组件评分的负载均衡器
+	Balancer module.Balancer
+	// 组件ID与权重的映射，未列出的组件的权重为1
+	// 只有实现了module.WeightedBalancer接口的负载均衡器（如加权轮询）才支持权重
+	Weights map[module.MID]uint32
+	// 组件的健康策略，决定连续失败多少次后组件会被暂时移出选择范围
+	HealthPolicy module.HealthPolicy
+	// 主动健康检查的间隔时间，为0时不进行主动健康检查
+	HealthCheckInterval time.Duration
+	// 定期调用组件Flush方法的间隔时间，为0时只在调度器停止时调用
+	FlushInterval time.Duration
+	// 条目路由规则的列表，条目会被发送到第一个匹配的路由的目标管道
+	ItemRoutes []ItemRoute
+	// 未匹配任何路由的条目所使用的路由，其Match字段会被忽略
+	// 零值表示通过负载均衡器从所有条目处理管道中选出一个
+	DefaultItemRoute ItemRoute
 }
 
 // 用于当前参数容器的有效性
@@ -124,13 +151,69 @@ func (args *ModuleArgs) Check() error {
 	if len(args.Pipelines) == 0 {
 		return genError("空的条目处理管道列表")
 	}
+	pipelines := map[module.MID]bool{}
+	for _, p := range args.Pipelines {
+		if p != nil {
+			pipelines[p.ID()] = true
+		}
+	}
+	if err := args.checkWeights(); err != nil {
+		return err
+	}
+	for i := range args.ItemRoutes {
+		if err := args.ItemRoutes[i].check(pipelines, false); err != nil {
+			return err
+		}
+	}
+	return args.DefaultItemRoute.check(pipelines, true)
+}
+
+// 用于检查组件的权重
+func (args *ModuleArgs) checkWeights() error {
+	if len(args.Weights) == 0 {
+		return nil
+	}
+	if _, ok := args.Balancer.(module.WeightedBalancer); !ok {
+		balancerName := module.BALANCER_SCORE
+		if args.Balancer != nil {
+			balancerName = args.Balancer.Name()
+		}
+		return genError(fmt.Sprintf("负载均衡策略%s不支持组件权重", balancerName))
+	}
+	mids := map[module.MID]bool{}
+	for _, d := range args.Downloaders {
+		if d != nil {
+			mids[d.ID()] = true
+		}
+	}
+	for _, a := range args.Analyzers {
+		if a != nil {
+			mids[a.ID()] = true
+		}
+	}
+	for _, p := range args.Pipelines {
+		if p != nil {
+			mids[p.ID()] = true
+		}
+	}
+	for mid := range args.Weights {
+		if !mids[mid] {
+			return genError(fmt.Sprintf("未知组件的权重 (MID: %s)", mid))
+		}
+	}
 	return nil
 }
 
 func (args *ModuleArgs) Summary() ModuleArgsSummary {
+	balancerName := module.BALANCER_SCORE
+	if args.Balancer != nil {
+		balancerName = args.Balancer.Name()
+	}
 	return ModuleArgsSummary{
 		DownloaderListSize: len(args.Downloaders),
 		AnalyzerListSize:   len(args.Analyzers),
 		PipelineListSize:   len(args.Pipelines),
+		Balancer:           balancerName,
+		ItemRouteNumber:    len(args.ItemRoutes),
 	}
 }
@@ -0,0 +1,110 @@
+package scheduler
+
+import (
+	"fmt"
+
+	"../module"
+	"../toolkit/deadletter"
+)
+
+// 用于把错误列表转换为结构化的错误信息
+func errorInfos(errs []error, mid module.MID) []deadletter.ErrorInfo {
+	var infos []deadletter.ErrorInfo
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		if itemErr, ok := err.(*module.ItemError); ok {
+			err = itemErr.Err
+		}
+		crawlerError := toCrawlerError(err, mid)
+		infos = append(infos, deadletter.ErrorInfo{
+			Type:    string(crawlerError.Type()),
+			Module:  string(mid),
+			Message: err.Error(),
+		})
+	}
+	return infos
+}
+
+// 用于把处理失败的条目放入死信存储
+func (sched *myScheduler) deadLetterItem(item module.Item, errs []error, mid module.MID) {
+	if sched.deadLetterStore == nil || item == nil {
+		return
+	}
+	infos := errorInfos(errs, mid)
+	if len(infos) == 0 {
+		return
+	}
+	entry := deadletter.Entry{
+		Kind:   deadletter.KIND_ITEM,
+		Errors: infos,
+		Item:   item,
+	}
+	if err := sched.deadLetterStore.Add(entry); err != nil {
+		logger.Errorf("写入死信发生错误: %s (MID: %s)", err, mid)
+	}
+}
+
+// 用于把下载失败的请求放入死信存储
+func (sched *myScheduler) deadLetterRequest(req *module.Request, err error, mid module.MID) {
+	if sched.deadLetterStore == nil || req == nil || err == nil {
+		return
+	}
+	record, rerr := deadletter.NewRequestRecord(req.HTTPReq(), req.Depth())
+	if rerr != nil {
+		logger.Errorf("写入死信发生错误: %s (MID: %s)", rerr, mid)
+		return
+	}
+	entry := deadletter.Entry{
+		Kind:    deadletter.KIND_REQUEST,
+		Errors:  errorInfos([]error{err}, mid),
+		Request: record,
+	}
+	if err := sched.deadLetterStore.Add(entry); err != nil {
+		logger.Errorf("写入死信发生错误: %s (MID: %s)", err, mid)
+	}
+}
+
+// 用于把死信存储中的死信重新注入给定的调度器
+// 调度器需已启动，成功注入的死信会从存储中删除，结果值代表成功注入的数量
+// 被调度器忽略的请求（如URL重复或超出爬取范围）会被留在存储中
+func ReinjectDeadLetters(scheduler Scheduler, store deadletter.Store) (int, error) {
+	if scheduler == nil || store == nil {
+		return 0, genParameterError("空的调度器或死信存储")
+	}
+	if scheduler.Status() != SCHED_STATUS_STARTED {
+		return 0, genError("调度器未启动，不能重新注入死信")
+	}
+	entries, err := store.Entries()
+	if err != nil {
+		return 0, genErrorByError(err)
+	}
+	var injected []string
+	for _, entry := range entries {
+		var ok bool
+		switch entry.Kind {
+		case deadletter.KIND_ITEM:
+			ok = scheduler.SendItem(module.Item(entry.Item))
+		case deadletter.KIND_REQUEST:
+			if entry.Request == nil {
+				break
+			}
+			httpReq, err := entry.Request.HTTPRequest()
+			if err != nil {
+				logger.Warnf("忽略死信！ %s (ID: %s)", err, entry.ID)
+				break
+			}
+			ok = scheduler.SendReq(module.NewRequest(httpReq, entry.Request.Depth))
+		default:
+			logger.Warnf("忽略死信！ 不支持的死信种类 %q (ID: %s)", entry.Kind, entry.ID)
+		}
+		if ok {
+			injected = append(injected, entry.ID)
+		}
+	}
+	if err := store.Remove(injected...); err != nil {
+		return len(injected), genError(fmt.Sprintf("删除已注入的死信发生错误: %s", err))
+	}
+	return len(injected), nil
+}
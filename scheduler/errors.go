@@ -26,27 +26,7 @@ func sendError(err error, mid module.MID, errorBufferPool buffer.Pool) bool {
 	if err == nil || errorBufferPool == nil || errorBufferPool.Closed() {
 		return false
 	}
-	var crawlerError errors.CrawlerError
-	var ok bool
-	crawlerError, ok = err.(errors.CrawlerError)
-	if !ok {
-		var moduleType module.Type
-		var errorType errors.ErrorType
-		ok, moduleType = module.GetType(mid)
-		if !ok {
-			errorType = errors.ERROR_TYPE_SCHEDULER
-		} else {
-			switch moduleType {
-			case module.TYPE_DOWNLOADER:
-				errorType = errors.ERROR_TYPE_DOWNLOADER
-			case module.TYPE_ANALYZER:
-				errorType = errors.ERROR_TYPE_ANALYER
-			case module.TYPE_PIPELINE:
-				errorType = errors.ERROR_TYPE_PIPELINE
-			}
-		}
-		crawlerError = errors.NewCrawlerError(errorType, err.Error())
-	}
+	crawlerError := toCrawlerError(err, mid)
 	if errorBufferPool.Closed() {
 		return false
 	}
@@ -57,3 +37,48 @@ func sendError(err error, mid module.MID, errorBufferPool buffer.Pool) bool {
 	}(crawlerError)
 	return true
 }
+
+// 用于把给定的错误值转换为爬虫错误值
+// 错误类型会根据组件ID推断，无法推断时视为调度器错误
+func toCrawlerError(err error, mid module.MID) errors.CrawlerError {
+	if crawlerError, ok := err.(errors.CrawlerError); ok {
+		return crawlerError
+	}
+	var errorType errors.ErrorType
+	ok, moduleType := module.GetType(mid)
+	if !ok {
+		errorType = errors.ERROR_TYPE_SCHEDULER
+	} else {
+		switch moduleType {
+		case module.TYPE_DOWNLOADER:
+			errorType = errors.ERROR_TYPE_DOWNLOADER
+		case module.TYPE_ANALYZER:
+			errorType = errors.ERROR_TYPE_ANALYER
+		case module.TYPE_PIPELINE:
+			errorType = errors.ERROR_TYPE_PIPELINE
+		}
+	}
+	return errors.NewCrawlerError(errorType, err.Error())
+}
+
+// 用于获取错误列表中的第一个非nil的错误值
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 用于得出一次分析的调用结果
+// 分析器会为每个解析函数分别返回错误，只有在没有得到任何数据时，
+// 这些错误才被视为分析器本身的失败
+func analyzeError(dataList []module.Data, errs []error) error {
+	for _, data := range dataList {
+		if data != nil {
+			return nil
+		}
+	}
+	return firstError(errs)
+}
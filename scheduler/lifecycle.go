@@ -0,0 +1,171 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"../module"
+)
+
+// 调度器停止时等待组件处理完手头调用的最长时间
+var closeWaitTimeout = 5 * time.Second
+
+// 用于按组件ID的顺序获取所有已注册的组件
+func (sched *myScheduler) sortedModules() []module.Module {
+	moduleMap := sched.registrar.GetAll()
+	modules := make([]module.Module, 0, len(moduleMap))
+	for _, m := range moduleMap {
+		modules = append(modules, m)
+	}
+	sort.Slice(modules, func(i, j int) bool {
+		return modules[i].ID() < modules[j].ID()
+	})
+	return modules
+}
+
+// 用于打开所有实现了Opener接口的组件
+// 若某个组件打开失败，则会关闭已打开的组件并返回错误值
+func (sched *myScheduler) openModules() error {
+	var opened []module.Module
+	for _, m := range sched.sortedModules() {
+		opener, ok := m.(module.Opener)
+		if !ok {
+			continue
+		}
+		if err := opener.Open(); err != nil {
+			for _, o := range opened {
+				if closer, ok := o.(module.Closer); ok {
+					closer.Close()
+				}
+			}
+			return genError(fmt.Sprintf("打开组件失败: %s (MID: %s)", err, m.ID()))
+		}
+		opened = append(opened, m)
+	}
+	return nil
+}
+
+// 用于定期刷新所有实现了Flusher接口的组件
+// 刷新时出现的错误会被发送到错误缓冲池
+func (sched *myScheduler) flushPeriodically() {
+	if sched.flushInterval <= 0 {
+		return
+	}
+	go func(ctx context.Context, interval time.Duration) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			for _, m := range sched.sortedModules() {
+				flusher, ok := m.(module.Flusher)
+				if !ok {
+					continue
+				}
+				if err := flusher.Flush(); err != nil {
+					sendError(err, m.ID(), sched.errorBufferPool)
+				}
+			}
+		}
+	}(sched.ctx, sched.flushInterval)
+}
+
+// 用于在调度器停止时、缓冲池关闭前排空条目缓冲池并刷新所有组件
+// 会先等待分析器和条目处理管道处理完手头的调用，
+// 并等待条目缓冲池中剩余的条目被发送给条目处理管道（最多等待closeWaitTimeout）
+// 所有错误会被合并为一个错误值返回
+func (sched *myScheduler) drain() error {
+	modules := sched.sortedModules()
+	deadline := time.Now().Add(closeWaitTimeout)
+	busy := func() bool {
+		if sched.itemBufferPool.Total() > 0 {
+			return true
+		}
+		for _, m := range modules {
+			if _, ok := m.(module.Downloader); ok {
+				continue
+			}
+			if m.HandlingNumber() > 0 {
+				return true
+			}
+		}
+		return false
+	}
+	for busy() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	var errMsgs []string
+	if total := sched.itemBufferPool.Total(); total > 0 {
+		errMsgs = append(errMsgs, fmt.Sprintf("条目缓冲池中仍有%d个条目未被处理", total))
+	}
+	for _, m := range modules {
+		if flusher, ok := m.(module.Flusher); ok {
+			if err := flusher.Flush(); err != nil {
+				errMsgs = append(errMsgs, fmt.Sprintf("刷新组件失败: %s (MID: %s)", err, m.ID()))
+			}
+		}
+	}
+	if len(errMsgs) > 0 {
+		return genError(strings.Join(errMsgs, "; "))
+	}
+	return nil
+}
+
+// 用于在调度器停止时刷新并关闭所有组件
+// 会先等待组件处理完手头的调用（最多等待closeWaitTimeout）
+// 所有错误会被合并为一个错误值返回
+func (sched *myScheduler) closeModules() error {
+	modules := sched.sortedModules()
+	deadline := time.Now().Add(closeWaitTimeout)
+	for _, m := range modules {
+		for m.HandlingNumber() > 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	var errMsgs []string
+	for _, m := range modules {
+		if flusher, ok := m.(module.Flusher); ok {
+			if err := flusher.Flush(); err != nil {
+				errMsgs = append(errMsgs, fmt.Sprintf("刷新组件失败: %s (MID: %s)", err, m.ID()))
+			}
+		}
+		if closer, ok := m.(module.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errMsgs = append(errMsgs, fmt.Sprintf("关闭组件失败: %s (MID: %s)", err, m.ID()))
+			}
+		}
+	}
+	if len(errMsgs) > 0 {
+		return genError(strings.Join(errMsgs, "; "))
+	}
+	return nil
+}
+
+// 用于把组件异步报告的错误转发到错误缓冲池
+// 条目的处理错误还会使相应的条目被放入死信存储
+// 转发会在组件关闭错误通道后结束
+func (sched *myScheduler) forwardAsyncErrors() {
+	for _, m := range sched.sortedModules() {
+		reporter, ok := m.(module.AsyncErrorReporter)
+		if !ok {
+			continue
+		}
+		go func(mid module.MID, errorChan <-chan error) {
+			for err := range errorChan {
+				sched.registrar.ReportError(mid, err)
+				if itemErr, ok := err.(*module.ItemError); ok {
+					sched.deadLetterItem(itemErr.Item, []error{itemErr.Err}, mid)
+				}
+				if !sendError(err, mid, sched.errorBufferPool) {
+					logger.Errorf("错误缓冲池已关闭，忽略异步错误: %s (MID: %s)", err, mid)
+				}
+			}
+		}(m.ID(), reporter.ErrorChan())
+	}
+}
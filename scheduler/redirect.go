@@ -0,0 +1,49 @@
+package scheduler
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"../module"
+)
+
+// 用于检查重定向的目标是否在爬取范围之内
+// 检查规则与SendReq一致：协议需要被支持，http和https的URL必须有主机且其主域名需要在可接受的主域名列表中
+func (sched *myScheduler) redirectScope(target *url.URL) error {
+	scheme := strings.ToLower(target.Scheme)
+	if !sched.schemeSupported(scheme) {
+		return fmt.Errorf("不支持的协议 %q", scheme)
+	}
+	if target.Host == "" {
+		if isHTTPScheme(scheme) {
+			return fmt.Errorf("URL中没有主机")
+		}
+		return nil
+	}
+	pd, err := getPrimaryDomain(target.Host)
+	if err != nil {
+		return err
+	}
+	if sched.acceptedDomainMap.Get(pd) == nil {
+		return fmt.Errorf("主域名 %q 不在可接受的主域名列表中", pd)
+	}
+	return nil
+}
+
+// 用于为所有实现了RedirectScoper接口的下载器设置重定向范围检查函数
+func (sched *myScheduler) setRedirectScopes(downloaders []module.Downloader) {
+	for _, d := range downloaders {
+		if scoper, ok := d.(module.RedirectScoper); ok {
+			scoper.SetRedirectScope(sched.redirectScope)
+		}
+	}
+}
+
+// 用于把响应的重定向链中的URL标记为已访问
+// 这样重定向的最终URL就不会被再次下载
+func (sched *myScheduler) markRedirectChain(resp *module.Response) {
+	for _, u := range resp.RedirectChain() {
+		sched.urlMap.Put(u.String(), struct{}{})
+	}
+}
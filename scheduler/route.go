@@ -0,0 +1,182 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"time"
+
+	"../module"
+	"../toolkit/reader"
+)
+
+// 用于判断条目是否匹配路由的函数类型
+type ItemMatcher func(item module.Item) bool
+
+// 代表条目路由规则的类型
+type ItemRoute struct {
+	// 路由的名称，用于日志和错误信息
+	Name string
+	// 用于判断条目是否匹配该路由，默认路由会忽略该字段
+	Match ItemMatcher
+	// 目标条目处理管道的ID列表，为空时表示所有条目处理管道
+	Pipelines []module.MID
+	// 为true时条目会被发送到所有目标管道，否则通过负载均衡器选出一个
+	Broadcast bool
+}
+
+// 用于创建一个匹配包含所有给定键的条目的函数
+func MatchKeys(keys ...string) ItemMatcher {
+	return func(item module.Item) bool {
+		for _, key := range keys {
+			if _, ok := item[key]; !ok {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// 用于创建一个匹配给定键的值等于任一给定值的条目的函数
+// 常用于按条目中的类型字段进行路由
+func MatchValue(key string, values ...interface{}) ItemMatcher {
+	return func(item module.Item) bool {
+		value, ok := item[key]
+		if !ok {
+			return false
+		}
+		for _, v := range values {
+			if reflect.DeepEqual(value, v) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// 用于检查路由规则的有效性
+// 参数pipelines代表所有可用的条目处理管道的ID
+func (route *ItemRoute) check(pipelines map[module.MID]bool, isDefault bool) error {
+	name := route.Name
+	if isDefault {
+		name = "默认路由"
+	}
+	if !isDefault && route.Match == nil {
+		return genError(fmt.Sprintf("条目路由缺少匹配函数: %q", name))
+	}
+	for _, mid := range route.Pipelines {
+		if !pipelines[mid] {
+			return genError(fmt.Sprintf("条目路由 %q 的目标管道不存在: %s", name, mid))
+		}
+	}
+	return nil
+}
+
+// 用于获取给定条目所匹配的路由
+// 条目会使用第一个匹配的路由，未匹配任何路由时使用默认路由
+func (sched *myScheduler) routeItem(item module.Item) ItemRoute {
+	for _, route := range sched.itemRoutes {
+		if route.Match(item) {
+			return route
+		}
+	}
+	return sched.defaultItemRoute
+}
+
+// 用于获取广播时的目标管道
+// 路由未指定目标管道时，返回所有已注册的条目处理管道
+func (sched *myScheduler) broadcastTargets(route ItemRoute) ([]module.Module, error) {
+	modules, err := sched.registrar.GetAllByType(module.TYPE_PIPELINE)
+	if err != nil {
+		return nil, err
+	}
+	var targets []module.Module
+	if len(route.Pipelines) == 0 {
+		for _, m := range modules {
+			targets = append(targets, m)
+		}
+		sort.Slice(targets, func(i, j int) bool {
+			return targets[i].ID() < targets[j].ID()
+		})
+		return targets, nil
+	}
+	for _, mid := range route.Pipelines {
+		m, ok := modules[mid]
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("条目处理管道未注册: %s", mid))
+		}
+		targets = append(targets, m)
+	}
+	return targets, nil
+}
+
+// 用于把条目发送给给定的条目处理管道
+func (sched *myScheduler) sendToPipeline(m module.Module, item module.Item) {
+	pipeline, ok := m.(module.Pipeline)
+	if !ok {
+		errMsg := fmt.Sprintf("条目处理管道类型非法: %T (MID: %s)",
+			m, m.ID())
+		sendError(errors.New(errMsg), m.ID(), sched.errorBufferPool)
+		return
+	}
+	if !sched.validateItem(m, item) {
+		return
+	}
+	start := time.Now()
+	errs := pipeline.Send(item)
+	sched.registrar.Observe(m.ID(), time.Since(start), firstError(errs))
+	for _, err := range errs {
+		sendError(err, m.ID(), sched.errorBufferPool)
+	}
+	sched.deadLetterItem(item, errs, m.ID())
+}
+
+// 用于获取条目的浅拷贝，以免广播时各管道修改同一个条目
+func copyItem(item module.Item) module.Item {
+	copied := make(module.Item, len(item))
+	for key, value := range item {
+		copied[key] = value
+	}
+	return copied
+}
+
+// 广播时在内存中缓存的读取器数据的最大长度（字节），超出时会被转存到临时文件
+const broadcastMemoryThreshold int64 = 4 << 20
+
+// 用于为广播生成各目标管道使用的条目
+// 每个条目都是原条目的浅拷贝，但值为io.Reader的字段会先被缓冲，
+// 每个条目都会得到一个从头读取的独立读取器，原读取器若可关闭则会被关闭
+func broadcastItems(item module.Item, number int) ([]module.Item, error) {
+	items := make([]module.Item, number)
+	for i := range items {
+		items[i] = copyItem(item)
+	}
+	var opened []io.Closer
+	for key, value := range item {
+		original, ok := value.(io.Reader)
+		if !ok {
+			continue
+		}
+		multipleReader, err := reader.NewMultipleReaderWithOptions(original,
+			reader.Options{MemoryThreshold: broadcastMemoryThreshold})
+		if closer, ok := original.(io.Closer); ok {
+			closer.Close()
+		}
+		if err != nil {
+			for _, closer := range opened {
+				closer.Close()
+			}
+			return nil, fmt.Errorf("缓冲条目字段%q出现异常: %s", key, err)
+		}
+		for _, copied := range items {
+			readCloser := multipleReader.Reader()
+			opened = append(opened, readCloser)
+			copied[key] = readCloser
+		}
+		// 临时文件会在各条目的读取器都关闭后被删除
+		multipleReader.Close()
+	}
+	return items, nil
+}
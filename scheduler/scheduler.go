@@ -2,16 +2,20 @@ package scheduler
 
 import (
 	"context"
+	"crypto/sha1"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"../cmap"
 	"../log"
 	"../module"
 	"../toolkit/buffer"
+	"../toolkit/deadletter"
 )
 
 // logger 代表日志记录器。
@@ -26,9 +30,11 @@ type Scheduler interface {
 	Init(requestArgs RequestArgs, dataArgs DataArgs, moduleArgs ModuleArgs) (err error)
 	// Start用于启动调度器并执行爬取流程
 	// 参数firstHTTPReq代表首次请求，调度器会以此为起始点开始执行爬取流程
+	// 实现了Opener接口的组件会在此时被打开，任一组件打开失败都会导致启动失败
 	Start(firstHTTPReq *http.Request) (err error)
 	// Stop用于停止调度器的运行
 	// 所有处理模块执行的流程都会被中止
+	// 实现了生命周期接口的组件会被刷新并关闭，收尾时出现的错误会作为结果值返回
 	Stop() (err error)
 	// 用于获取调度器的状态
 	Status() Status
@@ -42,6 +48,8 @@ type Scheduler interface {
 	Summary() SchedSummary
 
 	SendReq(req *module.Request) bool
+	// 用于向调度器发送条目，条目会按路由规则被交给条目处理管道
+	SendItem(item module.Item) bool
 }
 
 // 调度器的实现类型
@@ -72,6 +80,18 @@ type myScheduler struct {
 	statusLock sync.RWMutex
 	// 摘要信息
 	summary SchedSummary
+	// 主动健康检查的间隔时间
+	healthCheckInterval time.Duration
+	// 定期刷新组件的间隔时间
+	flushInterval time.Duration
+	// 条目路由规则的列表
+	itemRoutes []ItemRoute
+	// 未匹配任何路由的条目所使用的路由
+	defaultItemRoute ItemRoute
+	// 死信存储
+	deadLetterStore deadletter.Store
+	// 条目模式违规的计数器
+	violations *violationCounter
 }
 
 // 创建调度器实例
@@ -121,6 +141,21 @@ func (sched *myScheduler) Init(requestArgs RequestArgs, dataArgs DataArgs, modul
 	} else {
 		sched.registrar.Clear()
 	}
+	sched.registrar.SetBalancer(moduleArgs.Balancer)
+	logger.Infof("-- 负载均衡策略: %s", sched.registrar.Balancer().Name())
+	if weighted, ok := moduleArgs.Balancer.(module.WeightedBalancer); ok {
+		for mid, weight := range moduleArgs.Weights {
+			weighted.SetWeight(mid, weight)
+		}
+	}
+	sched.registrar.SetHealthPolicy(moduleArgs.HealthPolicy)
+	sched.healthCheckInterval = moduleArgs.HealthCheckInterval
+	logger.Infof("-- 健康检查间隔: %s", sched.healthCheckInterval)
+	sched.flushInterval = moduleArgs.FlushInterval
+	logger.Infof("-- 组件刷新间隔: %s", sched.flushInterval)
+	sched.itemRoutes = moduleArgs.ItemRoutes
+	sched.defaultItemRoute = moduleArgs.DefaultItemRoute
+	logger.Infof("-- 条目路由数量: %d", len(sched.itemRoutes))
 	sched.maxDepth = requestArgs.MaxDepth
 	logger.Infof("-- 最大爬取深度: %d", sched.maxDepth)
 	sched.acceptedDomainMap, _ = cmap.NewConcurrentMap(1, nil)
@@ -132,6 +167,8 @@ func (sched *myScheduler) Init(requestArgs RequestArgs, dataArgs DataArgs, modul
 	sched.urlMap, _ = cmap.NewConcurrentMap(16, nil)
 	logger.Infof("-- URL字典: 长度: %d, 并发量: %d", sched.urlMap.Len(), sched.urlMap.Concurrency())
 	sched.initBufferPool(dataArgs)
+	sched.deadLetterStore = dataArgs.DeadLetterStore
+	sched.violations = newViolationCounter()
 	sched.resetContext()
 	sched.summary = newSchedSummary(requestArgs, dataArgs, moduleArgs, sched)
 
@@ -171,16 +208,37 @@ func (sched *myScheduler) Start(firstHTTPReq *http.Request) (err error) {
 		return
 	}
 
+	// 打开组件
+	logger.Info("打开组件...")
+	if err = sched.openModules(); err != nil {
+		return
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		// 启动失败时关闭已打开的组件，转发异步错误的goroutine会随之结束
+		logger.Info("启动失败，关闭组件...")
+		if closeErr := sched.closeModules(); closeErr != nil {
+			logger.Errorf("关闭组件时发生错误: %s", closeErr)
+		}
+	}()
+	sched.forwardAsyncErrors()
+
 	// 检查参数
 	logger.Info("检查首次请求HTTP参数...")
-	if firstHTTPReq != nil {
+	if firstHTTPReq != nil && firstHTTPReq.URL != nil && firstHTTPReq.URL.Host == "" &&
+		!isHTTPScheme(strings.ToLower(firstHTTPReq.URL.Scheme)) {
+		// 没有主机的首次请求（如file:///）不需要添加可接受的主域名
+		sched.SendReq(module.NewRequest(firstHTTPReq, 0))
+	} else if firstHTTPReq != nil {
 		logger.Info("HTTP主域名请求检查完毕")
 
 		// 获得首次请求的主域名， 并将其添加到可接受的主域名的字典
 		logger.Info("获得首次请求的主域名...")
-		logger.Infof("-- host: %s", firstHTTPReq.Host)
+		logger.Infof("-- host: %s", firstHTTPReq.URL.Host)
 		var primaryDomain string
-		primaryDomain, err = getPrimaryDomain(firstHTTPReq.Host)
+		primaryDomain, err = getPrimaryDomain(firstHTTPReq.URL.Host)
 		if err != nil {
 			return
 		}
@@ -198,6 +256,8 @@ func (sched *myScheduler) Start(firstHTTPReq *http.Request) (err error) {
 	sched.download()
 	sched.analyze()
 	sched.pick()
+	sched.checkHealth()
+	sched.flushPeriodically()
 	logger.Info("调度器已经启动.")
 	return nil
 }
@@ -207,13 +267,14 @@ func (sched *myScheduler) Stop() (err error) {
 	// 检查状态
 	logger.Info("检查停止调度器参数...")
 	var oldStatus Status
+	var stopped bool
 	oldStatus, err = sched.checkAndSetStatus(SCHED_STATUS_STOPPING)
 	defer func() {
 		sched.statusLock.Lock()
-		if err != nil {
-			sched.status = oldStatus
-		} else {
+		if stopped {
 			sched.status = SCHED_STATUS_STOPPED
+		} else {
+			sched.status = oldStatus
 		}
 		sched.statusLock.Unlock()
 	}()
@@ -221,12 +282,26 @@ func (sched *myScheduler) Stop() (err error) {
 		return
 	}
 	sched.cancelFunc()
+	// 组件的收尾错误不影响调度器的停止，但会作为结果值返回
+	logger.Info("排空条目缓冲池...")
+	drainErr := sched.drain()
+	if drainErr != nil {
+		logger.Errorf("排空条目缓冲池时发生错误: %s", drainErr)
+	}
 	sched.reqBufferPool.Close()
 	sched.respBufferPool.Close()
 	sched.itemBufferPool.Close()
 	sched.errorBufferPool.Close()
+	stopped = true
+	logger.Info("关闭组件...")
+	if err = sched.closeModules(); err != nil {
+		logger.Errorf("关闭组件时发生错误: %s", err)
+	}
+	if err == nil {
+		err = drainErr
+	}
 	logger.Info("调度器已停止")
-	return nil
+	return
 }
 
 func (sched *myScheduler) Status() Status {
@@ -315,6 +390,7 @@ func (sched *myScheduler) registerModules(moduleArgs ModuleArgs) error {
 		}
 	}
 	logger.Infof("所有下载器均已注册 (数量: %d)", len(moduleArgs.Downloaders))
+	sched.setRedirectScopes(moduleArgs.Downloaders)
 
 	for _, a := range moduleArgs.Analyzers {
 		if a == nil {
@@ -394,12 +470,18 @@ func (sched *myScheduler) downloadOne(req *module.Request) {
 		sched.SendReq(req)
 		return
 	}
+	start := time.Now()
 	resp, err := downloader.Download(req)
+	sched.registrar.Observe(m.ID(), time.Since(start), err)
 	if resp != nil {
+		sched.markRedirectChain(resp)
 		sendResp(resp, sched.respBufferPool)
 	}
 	if err != nil {
 		sendError(err, m.ID(), sched.errorBufferPool)
+		if resp == nil {
+			sched.deadLetterRequest(req, err, m.ID())
+		}
 	}
 }
 
@@ -449,7 +531,9 @@ func (sched *myScheduler) analyzeOne(resp *module.Response) {
 		sendResp(resp, sched.respBufferPool)
 		return
 	}
+	start := time.Now()
 	dataList, errs := analyzer.Analyze(resp)
+	sched.registrar.Observe(m.ID(), time.Since(start), analyzeError(dataList, errs))
 	if dataList != nil {
 		for _, data := range dataList {
 			if data == nil {
@@ -459,7 +543,9 @@ func (sched *myScheduler) analyzeOne(resp *module.Response) {
 			case *module.Request:
 				sched.SendReq(d)
 			case module.Item:
-				sendItem(d, sched.itemBufferPool)
+				if sched.validateItem(m, d) {
+					sendItem(d, sched.itemBufferPool)
+				}
 			default:
 				errMsg := fmt.Sprintf("不支持的数据类型 %T! (data: %#v)", d, d)
 				sendError(errors.New(errMsg), m.ID(), sched.errorBufferPool)
@@ -477,7 +563,8 @@ func (sched *myScheduler) analyzeOne(resp *module.Response) {
 func (sched *myScheduler) pick() {
 	go func() {
 		for {
-			if sched.canceled() {
+			// 调度器停止时仍会处理完条目缓冲池中剩余的条目
+			if sched.canceled() && sched.itemBufferPool.Total() == 0 {
 				break
 			}
 			datum, err := sched.itemBufferPool.Get()
@@ -496,31 +583,59 @@ func (sched *myScheduler) pick() {
 }
 
 // 处理给定的条目
+// 条目会按路由规则被发送到一个或多个条目处理管道
+// 调度器停止后仍会处理条目，以免已得到的条目丢失
 func (sched *myScheduler) pickOne(item module.Item) {
-	if sched.canceled() {
+	route := sched.routeItem(item)
+	if route.Broadcast {
+		targets, err := sched.broadcastTargets(route)
+		if err != nil {
+			errMsg := fmt.Sprintf("不能获取条目处理管道: %s (路由: %q)", err, route.Name)
+			sendError(errors.New(errMsg), "", sched.errorBufferPool)
+			sendItem(item, sched.itemBufferPool)
+			return
+		}
+		items, err := broadcastItems(item, len(targets))
+		if err != nil {
+			errMsg := fmt.Sprintf("不能广播条目: %s (路由: %q)", err, route.Name)
+			err = errors.New(errMsg)
+			sendError(err, "", sched.errorBufferPool)
+			sched.deadLetterItem(item, []error{err}, "")
+			return
+		}
+		for i, m := range targets {
+			sched.sendToPipeline(m, items[i])
+		}
 		return
 	}
-	m, err := sched.registrar.Get(module.TYPE_PIPELINE)
+	m, err := sched.registrar.GetFrom(module.TYPE_PIPELINE, route.Pipelines)
 	if err != nil || m == nil {
 		errMsg := fmt.Sprintf("不能获取条目处理管道: %s", err)
 		sendError(errors.New(errMsg), "", sched.errorBufferPool)
 		sendItem(item, sched.itemBufferPool)
 		return
 	}
-	pipeline, ok := m.(module.Pipeline)
-	if !ok {
-		errMsg := fmt.Sprintf("条目处理管道类型非法: %T (MID: %s)",
-			m, m.ID())
-		sendError(errors.New(errMsg), m.ID(), sched.errorBufferPool)
-		sendItem(item, sched.itemBufferPool)
+	sched.sendToPipeline(m, item)
+}
+
+// 定期对组件进行主动健康检查
+// 不健康的组件会被注册器暂时移出选择范围，直至恢复
+func (sched *myScheduler) checkHealth() {
+	if sched.healthCheckInterval <= 0 {
 		return
 	}
-	errs := pipeline.Send(item)
-	if errs != nil {
-		for _, err := range errs {
-			sendError(err, m.ID(), sched.errorBufferPool)
+	go func(ctx context.Context, interval time.Duration) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			sched.registrar.CheckHealth()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
 		}
-	}
+	}(sched.ctx, sched.healthCheckInterval)
 }
 
 // 向请求缓冲池发送请求
@@ -543,22 +658,28 @@ func (sched *myScheduler) SendReq(req *module.Request) bool {
 		return false
 	}
 	scheme := strings.ToLower(reqURL.Scheme)
-	if scheme != "http" && scheme != "https" {
-		logger.Warnf("忽略请求！ 这个URL请求协议为 %q, 不是 %q or %q. (URL: %s)\n",
-			scheme, "http", "https", reqURL)
+	if !sched.schemeSupported(scheme) {
+		logger.Warnf("忽略请求！ 没有下载器支持这个URL请求协议 %q (URL: %s)\n",
+			scheme, reqURL)
 		return false
 	}
-	if v := sched.urlMap.Get(reqURL.String()); v != nil {
+	reqKey := requestKey(httpReq)
+	if v := sched.urlMap.Get(reqKey); v != nil {
 		logger.Warnf("忽略请求！ URL是重复的 (URL: %s)\n", reqURL)
 		return false
 	}
-	pd, _ := getPrimaryDomain(httpReq.Host)
-	if sched.acceptedDomainMap.Get(pd) == nil {
+	// 只有不基于网络的请求（如file:///和data:）可以不做域名检查
+	if reqURL.Host == "" && isHTTPScheme(scheme) {
+		logger.Warnf("忽略请求！ URL中没有主机 (URL: %s)\n", reqURL)
+		return false
+	}
+	pd, _ := getPrimaryDomain(reqURL.Host)
+	if reqURL.Host != "" && sched.acceptedDomainMap.Get(pd) == nil {
 		if pd == "bing.net" {
 			panic(httpReq.URL)
 		}
 		logger.Warnf("忽略请求！ 这个 host %q 不在接收的字典里 (URL: %s)\n",
-			httpReq.Host, reqURL)
+			reqURL.Host, reqURL)
 		return false
 	}
 	if req.Depth() > sched.maxDepth {
@@ -571,10 +692,40 @@ func (sched *myScheduler) SendReq(req *module.Request) bool {
 			logger.Warnln("请求缓冲池已关闭。 忽略请求发送")
 		}
 	}(req)
-	sched.urlMap.Put(reqURL.String(), struct{}{})
+	sched.urlMap.Put(reqKey, struct{}{})
 	return true
 }
 
+func (sched *myScheduler) SendItem(item module.Item) bool {
+	if item == nil {
+		return false
+	}
+	if sched.canceled() {
+		return false
+	}
+	return sendItem(item, sched.itemBufferPool)
+}
+
+// 用于获取请求的去重键
+// 带有可重读请求体的请求（如表单POST）会把方法和请求体的摘要计入键中
+// 以免同一URL下参数不同的请求（如分页请求）被误判为重复
+func requestKey(httpReq *http.Request) string {
+	key := httpReq.URL.String()
+	if httpReq.GetBody == nil || httpReq.ContentLength == 0 {
+		return key
+	}
+	body, err := httpReq.GetBody()
+	if err != nil {
+		return key
+	}
+	defer body.Close()
+	hash := sha1.New()
+	if _, err := io.Copy(hash, body); err != nil {
+		return key
+	}
+	return fmt.Sprintf("%s %s#%x", httpReq.Method, key, hash.Sum(nil))
+}
+
 // 向响应缓冲池发送响应
 func sendResp(resp *module.Response, respBufferPool buffer.Pool) bool {
 	if resp == nil || respBufferPool == nil || respBufferPool.Closed() {
@@ -0,0 +1,92 @@
+package scheduler
+
+import (
+	"sort"
+	"sync"
+
+	"../module"
+)
+
+// 代表模式违规计数的键
+type violationKey struct {
+	// 组件ID
+	mid module.MID
+	// 字段名称
+	field string
+}
+
+// 代表模式违规的计数器
+type violationCounter struct {
+	// 代表键与违规次数的映射
+	counts map[violationKey]uint64
+	// 代表互斥锁
+	lock sync.Mutex
+}
+
+// 用于创建一个模式违规计数器
+func newViolationCounter() *violationCounter {
+	return &violationCounter{counts: map[violationKey]uint64{}}
+}
+
+// 用于记录给定组件的一组违规
+func (counter *violationCounter) add(mid module.MID, violations []module.FieldViolation) {
+	counter.lock.Lock()
+	defer counter.lock.Unlock()
+	for _, violation := range violations {
+		counter.counts[violationKey{mid, violation.Field}]++
+	}
+}
+
+// 用于获取按组件ID和字段名称排序的违规计数摘要
+func (counter *violationCounter) summary() []SchemaViolationStruct {
+	counter.lock.Lock()
+	defer counter.lock.Unlock()
+	summaries := make([]SchemaViolationStruct, 0, len(counter.counts))
+	for key, count := range counter.counts {
+		summaries = append(summaries, SchemaViolationStruct{
+			Module: string(key.mid),
+			Field:  key.field,
+			Count:  count,
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Module != summaries[j].Module {
+			return summaries[i].Module < summaries[j].Module
+		}
+		return summaries[i].Field < summaries[j].Field
+	})
+	return summaries
+}
+
+// 代表模式违规计数的摘要类型
+type SchemaViolationStruct struct {
+	Module string `json:"module"`
+	Field  string `json:"field"`
+	Count  uint64 `json:"count"`
+}
+
+// 用于按给定组件声明的模式检查条目
+// 组件未声明模式或条目符合模式时返回true
+// 否则会报告错误、把条目放入死信存储并返回false
+func (sched *myScheduler) validateItem(m module.Module, item module.Item) bool {
+	holder, ok := m.(module.SchemaHolder)
+	if !ok {
+		return true
+	}
+	schema := holder.Schema()
+	if schema == nil {
+		return true
+	}
+	violations := schema.Validate(item)
+	if len(violations) == 0 {
+		return true
+	}
+	sched.violations.add(m.ID(), violations)
+	errs := make([]error, len(violations))
+	for i, violation := range violations {
+		errs[i] = violation
+		sendError(violation, m.ID(), sched.errorBufferPool)
+	}
+	sched.deadLetterItem(item, errs, m.ID())
+	return false
+}
@@ -0,0 +1,27 @@
+package scheduler
+
+import "../module"
+
+// 用于判断调度器是否可以处理给定协议的请求
+// http和https总是被支持，其他协议需要至少有一个下载器支持
+func (sched *myScheduler) schemeSupported(scheme string) bool {
+	if isHTTPScheme(scheme) {
+		return true
+	}
+	downloaders, err := sched.registrar.GetAllByType(module.TYPE_DOWNLOADER)
+	if err != nil {
+		return false
+	}
+	for _, m := range downloaders {
+		if supporter, ok := m.(module.SchemeSupporter); ok && supporter.SupportsScheme(scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// 用于判断给定协议是否为http或https
+// 这类请求都基于网络，必须带有主机并经过主域名检查
+func isHTTPScheme(scheme string) bool {
+	return scheme == "http" || scheme == "https"
+}
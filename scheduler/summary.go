@@ -3,7 +3,9 @@ package scheduler
 import (
 	"../module"
 	"../toolkit/buffer"
+	"../toolkit/deadletter"
 	"encoding/json"
+	"reflect"
 	"sort"
 )
 
@@ -17,21 +19,24 @@ type SchedSummary interface {
 
 // 表示调度器摘要的结构
 type SummaryStruct struct {
-	RequestArgs     RequestArgs             `json:"request_args"`
-	DataArgs        DataArgs                `json:"data_args"`
-	ModuleArgs      ModuleArgsSummary       `json:"module_args"`
-	Status          string                  `json:"status"`
-	Downloaders     []module.SummaryStruct  `json:"downloaders"`
-	Analyzers       []module.SummaryStruct  `json:"analyzers"`
-	Pipelines       []module.SummaryStruct  `json:"pipelines"`
-	ReqBufferPool   BufferPoolSummaryStruct `json:"request_buffer_pool"`
-	RespBufferPool  BufferPoolSummaryStruct `json:"response_buffer_pool"`
-	ItemBufferPool  BufferPoolSummaryStruct `json:"item_buffer_pool"`
-	ErrorBufferPool BufferPoolSummaryStruct `json:"error_buffer_pool"`
-	NumURL          uint64                  `json:"url_number"`
+	RequestArgs      RequestArgs             `json:"request_args"`
+	DataArgs         DataArgs                `json:"data_args"`
+	ModuleArgs       ModuleArgsSummary       `json:"module_args"`
+	Status           string                  `json:"status"`
+	Downloaders      []module.SummaryStruct  `json:"downloaders"`
+	Analyzers        []module.SummaryStruct  `json:"analyzers"`
+	Pipelines        []module.SummaryStruct  `json:"pipelines"`
+	ReqBufferPool    BufferPoolSummaryStruct `json:"request_buffer_pool"`
+	RespBufferPool   BufferPoolSummaryStruct `json:"response_buffer_pool"`
+	ItemBufferPool   BufferPoolSummaryStruct `json:"item_buffer_pool"`
+	ErrorBufferPool  BufferPoolSummaryStruct `json:"error_buffer_pool"`
+	NumURL           uint64                  `json:"url_number"`
+	NumDeadLetter    int                     `json:"dead_letter_number"`
+	SchemaViolations []SchemaViolationStruct `json:"schema_violations,omitempty"`
 }
 
 // 用于判断当前的调度器摘要与另一份是否相同
+// 组件摘要中的额外信息可能包含切片或指针，因此按值深度比较
 func (one *SummaryStruct) Same(another SummaryStruct) bool {
 	if !another.RequestArgs.Same(&one.RequestArgs) {
 		return false
@@ -49,7 +54,7 @@ func (one *SummaryStruct) Same(another SummaryStruct) bool {
 		return false
 	}
 	for i, ds := range another.Downloaders {
-		if ds != one.Downloaders[i] {
+		if !reflect.DeepEqual(ds, one.Downloaders[i]) {
 			return false
 		}
 	}
@@ -57,7 +62,7 @@ func (one *SummaryStruct) Same(another SummaryStruct) bool {
 		return false
 	}
 	for i, as := range another.Analyzers {
-		if as != one.Analyzers[i] {
+		if !reflect.DeepEqual(as, one.Analyzers[i]) {
 			return false
 		}
 	}
@@ -65,7 +70,7 @@ func (one *SummaryStruct) Same(another SummaryStruct) bool {
 		return false
 	}
 	for i, ps := range another.Pipelines {
-		if ps != one.Pipelines[i] {
+		if !reflect.DeepEqual(ps, one.Pipelines[i]) {
 			return false
 		}
 	}
@@ -84,6 +89,17 @@ func (one *SummaryStruct) Same(another SummaryStruct) bool {
 	if another.NumURL != one.NumURL {
 		return false
 	}
+	if another.NumDeadLetter != one.NumDeadLetter {
+		return false
+	}
+	if len(another.SchemaViolations) != len(one.SchemaViolations) {
+		return false
+	}
+	for i, vs := range another.SchemaViolations {
+		if vs != one.SchemaViolations[i] {
+			return false
+		}
+	}
 	return true
 }
 
@@ -117,18 +133,20 @@ func newSchedSummary(requestArgs RequestArgs, dataArgs DataArgs, moduleArgs Modu
 func (ss *mySchedSummary) Struct() SummaryStruct {
 	registrar := ss.sched.registrar
 	return SummaryStruct{
-		RequestArgs:     ss.requestArgs,
-		DataArgs:        ss.dataArgs,
-		ModuleArgs:      ss.moduleArgs.Summary(),
-		Status:          GetStatusDescription(ss.sched.Status()),
-		Downloaders:     getModuleSummaries(registrar, module.TYPE_DOWNLOADER),
-		Analyzers:       getModuleSummaries(registrar, module.TYPE_ANALYZER),
-		Pipelines:       getModuleSummaries(registrar, module.TYPE_PIPELINE),
-		ReqBufferPool:   getBufferPoolSummary(ss.sched.reqBufferPool),
-		RespBufferPool:  getBufferPoolSummary(ss.sched.respBufferPool),
-		ItemBufferPool:  getBufferPoolSummary(ss.sched.itemBufferPool),
-		ErrorBufferPool: getBufferPoolSummary(ss.sched.errorBufferPool),
-		NumURL:          ss.sched.urlMap.Len(),
+		RequestArgs:      ss.requestArgs,
+		DataArgs:         ss.dataArgs,
+		ModuleArgs:       ss.moduleArgs.Summary(),
+		Status:           GetStatusDescription(ss.sched.Status()),
+		Downloaders:      getModuleSummaries(registrar, module.TYPE_DOWNLOADER),
+		Analyzers:        getModuleSummaries(registrar, module.TYPE_ANALYZER),
+		Pipelines:        getModuleSummaries(registrar, module.TYPE_PIPELINE),
+		ReqBufferPool:    getBufferPoolSummary(ss.sched.reqBufferPool),
+		RespBufferPool:   getBufferPoolSummary(ss.sched.respBufferPool),
+		ItemBufferPool:   getBufferPoolSummary(ss.sched.itemBufferPool),
+		ErrorBufferPool:  getBufferPoolSummary(ss.sched.errorBufferPool),
+		NumURL:           ss.sched.urlMap.Len(),
+		NumDeadLetter:    numDeadLetter(ss.sched.deadLetterStore),
+		SchemaViolations: ss.sched.violations.summary(),
 	}
 }
 
@@ -164,8 +182,10 @@ func getModuleSummaries(registrar module.Registrar, mType module.Type) []module.
 	moduleMap, _ := registrar.GetAllByType(mType)
 	summaries := []module.SummaryStruct{}
 	if len(moduleMap) > 0 {
-		for _, module := range moduleMap {
-			summaries = append(summaries, module.Summary())
+		for mid, module := range moduleMap {
+			summary := module.Summary()
+			summary.Health = registrar.Health(mid)
+			summaries = append(summaries, summary)
 		}
 	}
 	if len(summaries) > 1 {
@@ -175,3 +195,11 @@ func getModuleSummaries(registrar module.Registrar, mType module.Type) []module.
 	}
 	return summaries
 }
+
+// 用于获取死信的数量，未设置死信存储时为0
+func numDeadLetter(store deadletter.Store) int {
+	if store == nil {
+		return 0
+	}
+	return store.Len()
+}
@@ -0,0 +1,128 @@
+package charset
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	htmlcharset "golang.org/x/net/html/charset"
+	"golang.org/x/text/transform"
+)
+
+// 探测字符集时读取的内容的最大长度
+const sniffLength = 1024
+
+// UTF-8的BOM
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// 用于记录原始字符集的响应头
+// 内容被转码为UTF-8后，解析函数可以通过它获知原始字符集
+const HEADER_ORIGINAL_CHARSET = "X-Original-Charset"
+
+// 默认的后备字符集
+// 在响应头、<meta>标签与BOM都没有给出字符集且内容不是有效的UTF-8时使用
+const DEFAULT_FALLBACK = "gb18030"
+
+// 代表字符集探测结果的类型
+type Result struct {
+	// 字符集的规范名称，如utf-8、gbk
+	Name string
+	// 字符集是否来自BOM或响应头而非推测
+	Certain bool
+}
+
+// 推测内容类型时读取的内容的最大长度，与http.DetectContentType一致
+const sniffContentLength = 512
+
+// 用于判断给定的内容类型是否代表文本内容
+// 内容类型为空时不会被视为文本内容，此时应先通过Sniff推测内容类型
+func IsText(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	switch mediaType {
+	case "application/xhtml+xml", "application/xml",
+		"application/json", "application/javascript":
+		return true
+	}
+	return strings.HasSuffix(mediaType, "+xml") || strings.HasSuffix(mediaType, "+json")
+}
+
+// 用于根据内容的开头推测内容类型，适用于响应未给出内容类型的情况
+// 结果值中的读取器会从头读出全部内容，推测出的内容类型不含参数
+func Sniff(reader io.Reader) (io.Reader, string, error) {
+	buffered := bufio.NewReaderSize(reader, sniffContentLength)
+	head, err := buffered.Peek(sniffContentLength)
+	if err != nil && err != io.EOF {
+		return nil, "", fmt.Errorf("字符集：读取内容出现异常: %s", err)
+	}
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	return buffered, mediaType, nil
+}
+
+// 用于探测给定内容的字符集
+// 探测的顺序依次为BOM、内容类型中的charset参数、<meta>标签以及UTF-8有效性检查
+// 若以上都无法确定字符集，则使用参数fallback指定的字符集，它为空时使用windows-1252
+func Detect(content []byte, contentType string, fallback string) Result {
+	if len(content) > sniffLength {
+		content = content[:sniffLength]
+	}
+	_, name, certain := htmlcharset.DetermineEncoding(content, contentType)
+	// DetermineEncoding在无从判断时会返回windows-1252
+	if !certain && name == "windows-1252" && fallback != "" && !metaDeclared(content) {
+		if e, fallbackName := htmlcharset.Lookup(fallback); e != nil {
+			name = fallbackName
+		}
+	}
+	return Result{Name: name, Certain: certain}
+}
+
+// 用于粗略判断内容中是否有声明字符集的<meta>标签
+func metaDeclared(content []byte) bool {
+	return strings.Contains(strings.ToLower(string(content)), "charset=")
+}
+
+// 用于把给定的读取器包装为输出UTF-8内容的读取器
+// 字符集的探测规则同Detect，第二个结果值代表探测到的原始字符集
+// 原始字符集为UTF-8时不会进行转码，但开头的BOM会被去掉
+func NewUTF8Reader(r io.Reader, contentType string, fallback string) (io.Reader, Result, error) {
+	bufReader := bufio.NewReaderSize(r, sniffLength)
+	content, err := bufReader.Peek(sniffLength)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, Result{}, fmt.Errorf("字符集：读取内容出现异常: %s", err)
+	}
+	result := Detect(content, contentType, fallback)
+	if result.Name == "utf-8" {
+		if bytes.HasPrefix(content, utf8BOM) {
+			bufReader.Discard(len(utf8BOM))
+		}
+		return bufReader, result, nil
+	}
+	e, _ := htmlcharset.Lookup(result.Name)
+	if e == nil {
+		return nil, result, fmt.Errorf("字符集：不支持的字符集: %s", result.Name)
+	}
+	return transform.NewReader(bufReader, e.NewDecoder()), result, nil
+}
+
+// 用于生成把charset参数替换为utf-8后的内容类型
+// 内容类型无法解析时会原样返回
+func ToUTF8ContentType(contentType string) string {
+	if contentType == "" {
+		return contentType
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	params["charset"] = "utf-8"
+	return mime.FormatMediaType(mediaType, params)
+}
@@ -0,0 +1,300 @@
+package cookie
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// 代表一条保存下来的Cookie
+type Entry struct {
+	// Cookie的名称
+	Name string `json:"name"`
+	// Cookie的值
+	Value string `json:"value"`
+	// Cookie所属的域名或主机
+	Domain string `json:"domain"`
+	// Cookie的路径
+	Path string `json:"path"`
+	// 是否只发送给与Domain完全相同的主机
+	HostOnly bool `json:"host_only"`
+	// 是否只通过HTTPS发送
+	Secure bool `json:"secure"`
+	// 是否为HttpOnly
+	HttpOnly bool `json:"http_only"`
+	// 过期时间，为空时表示会话Cookie
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+// 用于判断Cookie在给定时刻是否已过期
+func (entry *Entry) expired(now time.Time) bool {
+	return !entry.Expires.IsZero() && !now.Before(entry.Expires)
+}
+
+// 用于判断Cookie是否应被发送给给定的主机和路径
+func (entry *Entry) match(host string, path string, https bool) bool {
+	if entry.Secure && !https {
+		return false
+	}
+	if entry.HostOnly {
+		if host != entry.Domain {
+			return false
+		}
+	} else if host != entry.Domain && !strings.HasSuffix(host, "."+entry.Domain) {
+		return false
+	}
+	if path == entry.Path {
+		return true
+	}
+	if !strings.HasPrefix(path, entry.Path) {
+		return false
+	}
+	return strings.HasSuffix(entry.Path, "/") || path[len(entry.Path)] == '/'
+}
+
+// 用于生成Cookie在所属域中的唯一标识
+func (entry *Entry) id() string {
+	return fmt.Sprintf("%s;%s;%s", entry.Domain, entry.Path, entry.Name)
+}
+
+// 可持久化的Cookie容器的接口类型
+// 该接口的实现类型必须是并发安全的
+type Jar interface {
+	http.CookieJar
+	// 用于获取给定域（可注册域名，如example.com）下的所有未过期的Cookie
+	Entries(domain string) []Entry
+	// 用于删除给定域下的所有Cookie
+	Clear(domain string)
+	// 用于把所有Cookie持久化，会话Cookie也会被保存
+	Save() error
+}
+
+// 代表基于JSON文件的Cookie容器的实现类型
+// Cookie按可注册域名分组存放
+type myFileJar struct {
+	// 代表持久化文件的路径，为空时不持久化
+	path string
+	// 代表可注册域名与该域下的Cookie的映射
+	domains map[string]map[string]Entry
+	// 代表自上次持久化以来是否有修改
+	dirty bool
+	// 代表保护内部共享资源的读写锁
+	rwLock sync.RWMutex
+}
+
+// 用于创建一个Cookie容器
+// 参数path不为空时，若文件已存在则会先载入其中的Cookie，Save会把Cookie写回该文件
+func NewFileJar(path string) (Jar, error) {
+	jar := &myFileJar{
+		path:    path,
+		domains: map[string]map[string]Entry{},
+	}
+	if path == "" {
+		return jar, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return jar, nil
+		}
+		return nil, fmt.Errorf("Cookie容器：读取Cookie文件出现异常: %s (path: %s)", err, path)
+	}
+	if len(data) == 0 {
+		return jar, nil
+	}
+	if err := json.Unmarshal(data, &jar.domains); err != nil {
+		return nil, fmt.Errorf("Cookie容器：解析Cookie文件出现异常: %s (path: %s)", err, path)
+	}
+	return jar, nil
+}
+
+// 用于获取主机所属的可注册域名
+func registrableDomain(host string) string {
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
+
+// 用于生成Cookie的默认路径
+func defaultPath(path string) string {
+	if path == "" || path[0] != '/' {
+		return "/"
+	}
+	i := strings.LastIndex(path, "/")
+	if i == 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+func (jar *myFileJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return
+	}
+	now := time.Now()
+	jar.rwLock.Lock()
+	defer jar.rwLock.Unlock()
+	for _, cookie := range cookies {
+		entry := Entry{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   host,
+			Path:     cookie.Path,
+			HostOnly: true,
+			Secure:   cookie.Secure,
+			HttpOnly: cookie.HttpOnly,
+		}
+		if domain := strings.TrimPrefix(strings.ToLower(cookie.Domain), "."); domain != "" && domain != host {
+			// 不接受为其他域或公共后缀设置的Cookie
+			if !strings.HasSuffix(host, "."+domain) || registrableDomain(domain) != registrableDomain(host) {
+				continue
+			}
+			entry.Domain = domain
+			entry.HostOnly = false
+		} else if domain != "" {
+			entry.HostOnly = false
+		}
+		if entry.Path == "" || entry.Path[0] != '/' {
+			entry.Path = defaultPath(u.Path)
+		}
+		switch {
+		case cookie.MaxAge < 0:
+			entry.Expires = now
+		case cookie.MaxAge > 0:
+			entry.Expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+		case !cookie.Expires.IsZero():
+			entry.Expires = cookie.Expires
+		}
+		key := registrableDomain(entry.Domain)
+		entries, ok := jar.domains[key]
+		if !ok {
+			entries = map[string]Entry{}
+			jar.domains[key] = entries
+		}
+		if entry.expired(now) {
+			if _, ok := entries[entry.id()]; ok {
+				delete(entries, entry.id())
+				jar.dirty = true
+			}
+			continue
+		}
+		entries[entry.id()] = entry
+		jar.dirty = true
+	}
+}
+
+func (jar *myFileJar) Cookies(u *url.URL) []*http.Cookie {
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return nil
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	https := u.Scheme == "https"
+	now := time.Now()
+	jar.rwLock.RLock()
+	defer jar.rwLock.RUnlock()
+	var matched []Entry
+	for _, entry := range jar.domains[registrableDomain(host)] {
+		if entry.expired(now) || !entry.match(host, path, https) {
+			continue
+		}
+		matched = append(matched, entry)
+	}
+	// 路径较长的Cookie排在前面
+	sort.Slice(matched, func(i, j int) bool {
+		if len(matched[i].Path) != len(matched[j].Path) {
+			return len(matched[i].Path) > len(matched[j].Path)
+		}
+		return matched[i].Name < matched[j].Name
+	})
+	cookies := make([]*http.Cookie, len(matched))
+	for i, entry := range matched {
+		cookies[i] = &http.Cookie{Name: entry.Name, Value: entry.Value}
+	}
+	return cookies
+}
+
+func (jar *myFileJar) Entries(domain string) []Entry {
+	now := time.Now()
+	jar.rwLock.RLock()
+	defer jar.rwLock.RUnlock()
+	var entries []Entry
+	for _, entry := range jar.domains[registrableDomain(strings.ToLower(domain))] {
+		if !entry.expired(now) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].id() < entries[j].id()
+	})
+	return entries
+}
+
+func (jar *myFileJar) Clear(domain string) {
+	jar.rwLock.Lock()
+	defer jar.rwLock.Unlock()
+	key := registrableDomain(strings.ToLower(domain))
+	if _, ok := jar.domains[key]; ok {
+		delete(jar.domains, key)
+		jar.dirty = true
+	}
+}
+
+func (jar *myFileJar) Save() error {
+	if jar.path == "" {
+		return nil
+	}
+	jar.rwLock.Lock()
+	defer jar.rwLock.Unlock()
+	if !jar.dirty {
+		return nil
+	}
+	now := time.Now()
+	for key, entries := range jar.domains {
+		for id, entry := range entries {
+			if entry.expired(now) {
+				delete(entries, id)
+			}
+		}
+		if len(entries) == 0 {
+			delete(jar.domains, key)
+		}
+	}
+	data, err := json.MarshalIndent(jar.domains, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Cookie容器：序列化Cookie出现异常: %s", err)
+	}
+	dir := filepath.Dir(jar.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("Cookie容器：创建目录出现异常: %s (path: %s)", err, dir)
+	}
+	tmpPath := jar.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("Cookie容器：写入Cookie文件出现异常: %s (path: %s)", err, tmpPath)
+	}
+	if err := os.Rename(tmpPath, jar.path); err != nil {
+		return fmt.Errorf("Cookie容器：替换Cookie文件出现异常: %s (path: %s)", err, jar.path)
+	}
+	jar.dirty = false
+	return nil
+}
@@ -0,0 +1,147 @@
+package deadletter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// 代表死信种类的类型
+type Kind string
+
+// 死信种类的常量
+const (
+	// 处理失败的条目
+	KIND_ITEM Kind = "item"
+	// 下载失败的请求
+	KIND_REQUEST Kind = "request"
+)
+
+// 代表一条死信
+type Entry struct {
+	// 死信的ID，在同一个存储中唯一
+	ID string `json:"id"`
+	// 死信的种类
+	Kind Kind `json:"kind"`
+	// 进入死信存储的时间
+	Time time.Time `json:"time"`
+	// 导致失败的错误
+	Errors []ErrorInfo `json:"errors"`
+	// 处理失败的条目，仅当种类为KIND_ITEM时有效
+	// 读取器等无法序列化的值不会被保存，
+	// 读出时整数会被还原为int64类型，其他数字为float64类型
+	Item map[string]interface{} `json:"item,omitempty"`
+	// 下载失败的请求，仅当种类为KIND_REQUEST时有效
+	Request *RequestRecord `json:"request,omitempty"`
+}
+
+// 代表结构化的错误信息
+type ErrorInfo struct {
+	// 错误的类型，如"pipeline error"
+	Type string `json:"type"`
+	// 出错的组件ID，未知时为空
+	Module string `json:"module,omitempty"`
+	// 错误的提示信息
+	Message string `json:"message"`
+}
+
+// 代表可以序列化的请求
+type RequestRecord struct {
+	// 请求方法
+	Method string `json:"method"`
+	// 请求的URL
+	URL string `json:"url"`
+	// 请求头
+	Header http.Header `json:"header,omitempty"`
+	// 请求体，无法重新获取请求体时为空
+	Body []byte `json:"body,omitempty"`
+	// 请求的深度
+	Depth uint32 `json:"depth"`
+}
+
+// 用于根据HTTP请求创建一个可以序列化的请求
+// 只有设置了GetBody的请求才会保存请求体
+func NewRequestRecord(httpReq *http.Request, depth uint32) (*RequestRecord, error) {
+	if httpReq == nil || httpReq.URL == nil {
+		return nil, fmt.Errorf("死信：无效的HTTP请求")
+	}
+	record := &RequestRecord{
+		Method: httpReq.Method,
+		URL:    httpReq.URL.String(),
+		Header: httpReq.Header,
+		Depth:  depth,
+	}
+	if httpReq.GetBody != nil {
+		body, err := httpReq.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("死信：获取请求体出现异常: %s", err)
+		}
+		defer body.Close()
+		record.Body, err = ioutil.ReadAll(body)
+		if err != nil {
+			return nil, fmt.Errorf("死信：读取请求体出现异常: %s", err)
+		}
+	}
+	return record, nil
+}
+
+// 用于重新创建HTTP请求
+func (record *RequestRecord) HTTPRequest() (*http.Request, error) {
+	method := record.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	httpReq, err := http.NewRequest(method, record.URL, bytes.NewReader(record.Body))
+	if err != nil {
+		return nil, fmt.Errorf("死信：创建HTTP请求出现异常: %s", err)
+	}
+	for key, values := range record.Header {
+		httpReq.Header[key] = append([]string(nil), values...)
+	}
+	return httpReq, nil
+}
+
+// 用于生成可以序列化的条目
+// 读取器（如图片条目中的响应体）和其他无法序列化的值会被去掉，
+// 重新注入后由条目处理管道根据其余字段（如URL）重新获取
+func serializableItem(item map[string]interface{}) map[string]interface{} {
+	if item == nil {
+		return nil
+	}
+	result := make(map[string]interface{}, len(item))
+	for key, value := range item {
+		if _, ok := value.(io.Reader); ok {
+			continue
+		}
+		if _, err := json.Marshal(value); err != nil {
+			continue
+		}
+		result[key] = value
+	}
+	return result
+}
+
+// 用于把以json.Number形式读出的数字还原为int64或float64类型
+func restoreNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, elem := range v {
+			v[key] = restoreNumbers(elem)
+		}
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = restoreNumbers(elem)
+		}
+	}
+	return value
+}
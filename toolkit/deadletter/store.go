@@ -0,0 +1,184 @@
+package deadletter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 死信存储的接口类型
+// 该接口的实现类型必须是并发安全的
+type Store interface {
+	// 用于追加一条死信，ID与时间为空时会被自动填充
+	// 条目中的读取器等无法序列化的值会被去掉
+	Add(entry Entry) error
+	// 用于按写入顺序获取所有死信
+	Entries() ([]Entry, error)
+	// 用于删除给定ID的死信
+	Remove(ids ...string) error
+	// 用于获取死信的数量
+	Len() int
+}
+
+// 代表基于JSON Lines文件的死信存储的实现类型
+// 每条死信占一行，追加时直接写入文件，删除时会重写整个文件
+type myFileStore struct {
+	// 代表死信文件的路径
+	path string
+	// 代表死信的数量
+	length int
+	// 代表生成ID用的序号
+	seq uint64
+	// 代表互斥锁
+	lock sync.Mutex
+}
+
+// 用于创建一个基于JSON Lines文件的死信存储
+// 若文件已存在，则会先检查其中的死信
+func NewFileStore(path string) (Store, error) {
+	if path == "" {
+		return nil, fmt.Errorf("死信：空的死信文件路径")
+	}
+	store := &myFileStore{path: path}
+	entries, err := store.load()
+	if err != nil {
+		return nil, err
+	}
+	store.length = len(entries)
+	return store, nil
+}
+
+// 用于读取文件中的所有死信
+// 调用方需持有互斥锁（创建时除外）
+func (store *myFileStore) load() ([]Entry, error) {
+	file, err := os.Open(store.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("死信：打开死信文件出现异常: %s (path: %s)", err, store.path)
+	}
+	defer file.Close()
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var entry Entry
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.UseNumber()
+		if err := decoder.Decode(&entry); err != nil {
+			return nil, fmt.Errorf("死信：解析死信出现异常: %s (path: %s, line: %d)",
+				err, store.path, lineNumber)
+		}
+		restoreNumbers(entry.Item)
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("死信：读取死信文件出现异常: %s (path: %s)", err, store.path)
+	}
+	return entries, nil
+}
+
+func (store *myFileStore) Add(entry Entry) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	if entry.ID == "" {
+		store.seq++
+		entry.ID = fmt.Sprintf("%d-%d", entry.Time.UnixNano(), store.seq)
+	}
+	entry.Item = serializableItem(entry.Item)
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("死信：序列化死信出现异常: %s", err)
+	}
+	dir := filepath.Dir(store.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("死信：创建目录出现异常: %s (path: %s)", err, dir)
+	}
+	file, err := os.OpenFile(store.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("死信：打开死信文件出现异常: %s (path: %s)", err, store.path)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("死信：写入死信出现异常: %s (path: %s)", err, store.path)
+	}
+	store.length++
+	return nil
+}
+
+func (store *myFileStore) Entries() ([]Entry, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return store.load()
+}
+
+// 先写入临时文件再重命名，以免中途出错损坏原有的死信文件
+func (store *myFileStore) Remove(ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	entries, err := store.load()
+	if err != nil {
+		return err
+	}
+	removed := map[string]bool{}
+	for _, id := range ids {
+		removed[id] = true
+	}
+	tmpPath := store.path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("死信：创建临时文件出现异常: %s (path: %s)", err, tmpPath)
+	}
+	writer := bufio.NewWriter(file)
+	length := 0
+	for _, entry := range entries {
+		if removed[entry.ID] {
+			continue
+		}
+		data, err := json.Marshal(entry)
+		if err == nil {
+			_, err = writer.Write(append(data, '\n'))
+		}
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("死信：写入临时文件出现异常: %s (path: %s)", err, tmpPath)
+		}
+		length++
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("死信：写入临时文件出现异常: %s (path: %s)", err, tmpPath)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("死信：关闭临时文件出现异常: %s (path: %s)", err, tmpPath)
+	}
+	if err := os.Rename(tmpPath, store.path); err != nil {
+		return fmt.Errorf("死信：替换死信文件出现异常: %s (path: %s)", err, store.path)
+	}
+	store.length = length
+	return nil
+}
+
+func (store *myFileStore) Len() int {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return store.length
+}
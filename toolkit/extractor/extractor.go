@@ -0,0 +1,314 @@
+package extractor
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"../../module"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+)
+
+// 代表基于CSS选择器的抽取器
+// 它按规则从HTML页面中抽取条目和需要跟进的请求
+type Extractor struct {
+	// 代表编译后的抽取规则
+	rules []*compiledRule
+}
+
+// 代表编译后的抽取规则
+type compiledRule struct {
+	Rule
+	urlPattern *regexp.Regexp
+	root       cascadia.Selector
+	fields     []compiledField
+	follow     []compiledLink
+}
+
+// 代表编译后的字段抽取规则
+type compiledField struct {
+	FieldRule
+	selector cascadia.Selector
+	regex    *regexp.Regexp
+}
+
+// 代表编译后的链接抽取规则
+type compiledLink struct {
+	LinkRule
+	selector cascadia.Selector
+	pattern  *regexp.Regexp
+}
+
+// 用于根据给定的规则创建抽取器
+// 规则中的选择器和正则表达式会被预先编译，有误时返回错误
+func New(ruleSet RuleSet) (*Extractor, error) {
+	if len(ruleSet.Rules) == 0 {
+		return nil, fmt.Errorf("抽取器：空的规则列表")
+	}
+	extractor := &Extractor{}
+	for i, rule := range ruleSet.Rules {
+		compiled, err := compileRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("抽取器：规则[%d] %q 无效: %s", i, rule.Name, err)
+		}
+		extractor.rules = append(extractor.rules, compiled)
+	}
+	return extractor, nil
+}
+
+// 用于编译单条抽取规则
+func compileRule(rule Rule) (*compiledRule, error) {
+	if len(rule.Fields) == 0 && len(rule.Follow) == 0 {
+		return nil, fmt.Errorf("字段和链接规则均为空")
+	}
+	compiled := &compiledRule{Rule: rule}
+	var err error
+	if rule.URLPattern != "" {
+		if compiled.urlPattern, err = regexp.Compile(rule.URLPattern); err != nil {
+			return nil, fmt.Errorf("URL正则表达式有误: %s", err)
+		}
+	}
+	if rule.Root != "" {
+		if compiled.root, err = cascadia.Compile(rule.Root); err != nil {
+			return nil, fmt.Errorf("根元素选择器有误: %s", err)
+		}
+	}
+	names := map[string]bool{}
+	for _, field := range rule.Fields {
+		if field.Name == "" {
+			return nil, fmt.Errorf("空的字段名称")
+		}
+		if names[field.Name] {
+			return nil, fmt.Errorf("重复的字段名称: %s", field.Name)
+		}
+		names[field.Name] = true
+		switch field.Whitespace {
+		case "", "collapse", "remove":
+		default:
+			return nil, fmt.Errorf("字段 %q 的空白处理方式无效: %q", field.Name, field.Whitespace)
+		}
+		cf := compiledField{FieldRule: field}
+		if field.Selector != "" {
+			if cf.selector, err = cascadia.Compile(field.Selector); err != nil {
+				return nil, fmt.Errorf("字段 %q 的选择器有误: %s", field.Name, err)
+			}
+		}
+		if field.Regex != "" {
+			if cf.regex, err = regexp.Compile(field.Regex); err != nil {
+				return nil, fmt.Errorf("字段 %q 的正则表达式有误: %s", field.Name, err)
+			}
+		}
+		compiled.fields = append(compiled.fields, cf)
+	}
+	for i, link := range rule.Follow {
+		cl := compiledLink{LinkRule: link}
+		if cl.Attr == "" {
+			cl.Attr = "href"
+		}
+		if cl.selector, err = cascadia.Compile(link.Selector); err != nil {
+			return nil, fmt.Errorf("链接规则[%d]的选择器有误: %s", i, err)
+		}
+		if link.Pattern != "" {
+			if cl.pattern, err = regexp.Compile(link.Pattern); err != nil {
+				return nil, fmt.Errorf("链接规则[%d]的正则表达式有误: %s", i, err)
+			}
+		}
+		compiled.follow = append(compiled.follow, cl)
+	}
+	return compiled, nil
+}
+
+// 用于获取按规则解析响应的函数
+// 调用方应保证交给它的是HTML响应，例如通过分析器的路由规则
+func (extractor *Extractor) ParseResponse() module.ParseResponse {
+	return func(httpResp *http.Response, respDepth uint32) ([]module.Data, []error) {
+		if httpResp == nil {
+			return nil, []error{fmt.Errorf("空的HTTP响应")}
+		}
+		if httpResp.Request == nil || httpResp.Request.URL == nil {
+			return nil, []error{fmt.Errorf("空的HTTP请求")}
+		}
+		if httpResp.Body == nil {
+			return nil, []error{fmt.Errorf("空的HTTP响应体 (requestURL: %s)", httpResp.Request.URL)}
+		}
+		reqURL := httpResp.Request.URL
+		var matched []*compiledRule
+		for _, rule := range extractor.rules {
+			if rule.urlPattern == nil || rule.urlPattern.MatchString(reqURL.String()) {
+				matched = append(matched, rule)
+			}
+		}
+		if len(matched) == 0 {
+			return nil, nil
+		}
+		doc, err := goquery.NewDocumentFromReader(httpResp.Body)
+		if err != nil {
+			return nil, []error{err}
+		}
+		var dataList []module.Data
+		var errs []error
+		for _, rule := range matched {
+			items, itemErrs := rule.extractItems(doc, reqURL)
+			for _, item := range items {
+				dataList = append(dataList, item)
+			}
+			errs = append(errs, itemErrs...)
+			reqs, reqErrs := rule.extractRequests(doc, reqURL, respDepth)
+			for _, req := range reqs {
+				dataList = append(dataList, req)
+			}
+			errs = append(errs, reqErrs...)
+		}
+		return dataList, errs
+	}
+}
+
+// 用于按规则从页面中抽取条目
+// 缺少必需字段或没有任何字段的条目会被丢弃
+func (rule *compiledRule) extractItems(doc *goquery.Document, reqURL *url.URL) ([]module.Item, []error) {
+	if len(rule.fields) == 0 {
+		return nil, nil
+	}
+	roots := doc.Selection
+	if rule.root != nil {
+		roots = doc.FindMatcher(rule.root)
+	}
+	var items []module.Item
+	var errs []error
+	roots.Each(func(i int, root *goquery.Selection) {
+		item := module.Item{}
+		for _, field := range rule.fields {
+			value, ok := field.extract(root, reqURL)
+			if !ok {
+				if field.Required {
+					errs = append(errs, fmt.Errorf("规则 %q 缺少必需的字段 %q (requestURL: %s)",
+						rule.Name, field.Name, reqURL))
+					return
+				}
+				continue
+			}
+			item[field.Name] = value
+		}
+		if len(item) > 0 {
+			items = append(items, item)
+		}
+	})
+	return items, errs
+}
+
+// 用于从给定的根元素中抽取字段值
+// 第二个结果值为false时表示没有有效的值
+func (field *compiledField) extract(root *goquery.Selection, reqURL *url.URL) (interface{}, bool) {
+	selection := root
+	if field.selector != nil {
+		selection = root.FindMatcher(field.selector)
+	}
+	if field.Index > 0 {
+		selection = selection.Eq(field.Index)
+	}
+	var values []string
+	selection.EachWithBreak(func(i int, s *goquery.Selection) bool {
+		value, ok := field.value(s, reqURL)
+		if ok {
+			values = append(values, value)
+		}
+		return field.List || !ok
+	})
+	if len(values) == 0 {
+		return nil, false
+	}
+	if !field.List {
+		return values[0], true
+	}
+	if field.Join != "" {
+		return strings.Join(values, field.Join), true
+	}
+	return values, true
+}
+
+// 用于从单个元素中取值并进行后处理
+func (field *compiledField) value(s *goquery.Selection, reqURL *url.URL) (string, bool) {
+	var value string
+	switch field.Attr {
+	case "", "text":
+		value = s.Text()
+	case "html":
+		html, err := s.Html()
+		if err != nil {
+			return "", false
+		}
+		value = html
+	default:
+		attr, ok := s.Attr(field.Attr)
+		if !ok {
+			return "", false
+		}
+		value = attr
+	}
+	switch field.Whitespace {
+	case "collapse":
+		value = strings.Join(strings.Fields(value), " ")
+	case "remove":
+		value = strings.Join(strings.Fields(value), "")
+	default:
+		value = strings.TrimSpace(value)
+	}
+	if field.regex != nil {
+		match := field.regex.FindStringSubmatch(value)
+		if match == nil {
+			return "", false
+		}
+		if len(match) > 1 {
+			value = strings.TrimSpace(match[1])
+		} else {
+			value = match[0]
+		}
+	}
+	if field.Absolute {
+		u, err := url.Parse(value)
+		if err != nil {
+			return "", false
+		}
+		value = reqURL.ResolveReference(u).String()
+	}
+	if value == "" {
+		return "", false
+	}
+	return value, true
+}
+
+// 用于按规则从页面中抽取需要跟进的请求
+func (rule *compiledRule) extractRequests(doc *goquery.Document, reqURL *url.URL,
+	respDepth uint32) ([]*module.Request, []error) {
+	var reqs []*module.Request
+	var errs []error
+	for _, link := range rule.follow {
+		doc.FindMatcher(link.selector).Each(func(i int, s *goquery.Selection) {
+			href, ok := s.Attr(link.Attr)
+			href = strings.TrimSpace(href)
+			if !ok || href == "" || href == "#" || href == "/" ||
+				strings.HasPrefix(strings.ToLower(href), "javascript") {
+				return
+			}
+			u, err := url.Parse(href)
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			u = reqURL.ResolveReference(u)
+			if link.pattern != nil && !link.pattern.MatchString(u.String()) {
+				return
+			}
+			httpReq, err := http.NewRequest("GET", u.String(), nil)
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			reqs = append(reqs, module.NewRequest(httpReq, respDepth))
+		})
+	}
+	return reqs, errs
+}
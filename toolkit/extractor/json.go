@@ -0,0 +1,481 @@
+package extractor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"../../module"
+	"gopkg.in/yaml.v2"
+)
+
+// 当前支持的分页方式的常量
+const (
+	// 按页码分页，下一页的页码为当前页码加1
+	PAGINATION_PAGE = "page"
+	// 按游标分页，下一页的游标取自当前响应
+	PAGINATION_CURSOR = "cursor"
+)
+
+// 代表JSON抽取规则文件的内容
+type JSONRuleSet struct {
+	// 抽取规则的列表，与请求URL匹配的规则都会被使用
+	Rules []JSONRule `json:"rules" yaml:"rules"`
+}
+
+// 代表针对某类JSON响应的抽取规则
+type JSONRule struct {
+	// 规则的名称，用于错误信息
+	Name string `json:"name" yaml:"name"`
+	// 匹配的请求URL的正则表达式，为空时匹配所有请求
+	URLPattern string `json:"url_pattern,omitempty" yaml:"url_pattern,omitempty"`
+	// 条目列表的路径，如"$.page.list"，列表中的每个元素生成一个条目
+	// 为空时整个响应只生成一个条目
+	Items string `json:"items,omitempty" yaml:"items,omitempty"`
+	// 条目字段的抽取规则，路径相对于条目列表中的元素
+	Fields []JSONFieldRule `json:"fields,omitempty" yaml:"fields,omitempty"`
+	// 根据条目列表中的元素生成跟进请求的规则
+	Follow []JSONLinkRule `json:"follow,omitempty" yaml:"follow,omitempty"`
+	// 分页规则，为nil时不生成下一页的请求
+	Pagination *PaginationRule `json:"pagination,omitempty" yaml:"pagination,omitempty"`
+}
+
+// 代表JSON条目字段的抽取规则
+type JSONFieldRule struct {
+	// 字段名称
+	Name string `json:"name" yaml:"name"`
+	// 字段值的路径，如"$.id"或"shop.name"
+	Path string `json:"path" yaml:"path"`
+	// 为true时缺少该字段的条目会被丢弃并报告错误
+	Required bool `json:"required,omitempty" yaml:"required,omitempty"`
+}
+
+// 代表根据JSON元素生成跟进请求的规则
+type JSONLinkRule struct {
+	// URL模板，其中的"{路径}"会被替换为元素中该路径的值
+	// 例如"http://example.com/item/{create_id}-{id}"
+	Template string `json:"template" yaml:"template"`
+}
+
+// 代表分页规则
+type PaginationRule struct {
+	// 分页方式，取值为PAGINATION_PAGE或PAGINATION_CURSOR
+	Type string `json:"type" yaml:"type"`
+	// 页码或游标在请求中的参数名称
+	// GET请求会修改查询参数，表单POST请求会修改表单字段
+	Param string `json:"param" yaml:"param"`
+	// 按页码分页时总页数的路径，为空时在条目列表为空时停止
+	TotalPagesPath string `json:"total_pages_path,omitempty" yaml:"total_pages_path,omitempty"`
+	// 按游标分页时下一页游标的路径，游标为空或不存在时停止
+	CursorPath string `json:"cursor_path,omitempty" yaml:"cursor_path,omitempty"`
+	// 按页码分页时的最大页码，为0时不限制
+	MaxPages int `json:"max_pages,omitempty" yaml:"max_pages,omitempty"`
+}
+
+// 代表JSON响应的抽取器
+// 它按规则从JSON响应中抽取条目、跟进请求和下一页的请求
+type JSONExtractor struct {
+	// 代表编译后的抽取规则
+	rules []*compiledJSONRule
+}
+
+// 代表编译后的JSON抽取规则
+type compiledJSONRule struct {
+	JSONRule
+	urlPattern     *regexp.Regexp
+	items          *jsonPath
+	fields         []compiledJSONField
+	follow         []*urlTemplate
+	totalPagesPath *jsonPath
+	cursorPath     *jsonPath
+}
+
+// 代表编译后的JSON字段抽取规则
+type compiledJSONField struct {
+	JSONFieldRule
+	path *jsonPath
+}
+
+// 代表编译后的URL模板
+type urlTemplate struct {
+	// 代表模板中的固定文本，比占位符多一个
+	texts []string
+	// 代表占位符对应的路径
+	paths []*jsonPath
+}
+
+// 用于从文件中载入JSON抽取规则并创建抽取器
+// 扩展名为.yaml或.yml的文件按YAML解析，其他文件按JSON解析
+func LoadJSON(path string) (*JSONExtractor, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("抽取器：读取规则文件出现异常: %s (path: %s)", err, path)
+	}
+	var ruleSet JSONRuleSet
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &ruleSet)
+	default:
+		err = json.Unmarshal(data, &ruleSet)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("抽取器：解析规则文件出现异常: %s (path: %s)", err, path)
+	}
+	return NewJSON(ruleSet)
+}
+
+// 用于根据给定的规则创建JSON抽取器
+func NewJSON(ruleSet JSONRuleSet) (*JSONExtractor, error) {
+	if len(ruleSet.Rules) == 0 {
+		return nil, fmt.Errorf("抽取器：空的规则列表")
+	}
+	extractor := &JSONExtractor{}
+	for i, rule := range ruleSet.Rules {
+		compiled, err := compileJSONRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("抽取器：规则[%d] %q 无效: %s", i, rule.Name, err)
+		}
+		extractor.rules = append(extractor.rules, compiled)
+	}
+	return extractor, nil
+}
+
+// 用于编译单条JSON抽取规则
+func compileJSONRule(rule JSONRule) (*compiledJSONRule, error) {
+	if len(rule.Fields) == 0 && len(rule.Follow) == 0 && rule.Pagination == nil {
+		return nil, fmt.Errorf("字段、链接和分页规则均为空")
+	}
+	compiled := &compiledJSONRule{JSONRule: rule}
+	var err error
+	if rule.URLPattern != "" {
+		if compiled.urlPattern, err = regexp.Compile(rule.URLPattern); err != nil {
+			return nil, fmt.Errorf("URL正则表达式有误: %s", err)
+		}
+	}
+	if compiled.items, err = compilePath(rule.Items); err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, field := range rule.Fields {
+		if field.Name == "" {
+			return nil, fmt.Errorf("空的字段名称")
+		}
+		if names[field.Name] {
+			return nil, fmt.Errorf("重复的字段名称: %s", field.Name)
+		}
+		names[field.Name] = true
+		cf := compiledJSONField{JSONFieldRule: field}
+		if cf.path, err = compilePath(field.Path); err != nil {
+			return nil, err
+		}
+		compiled.fields = append(compiled.fields, cf)
+	}
+	for _, link := range rule.Follow {
+		template, err := compileURLTemplate(link.Template)
+		if err != nil {
+			return nil, err
+		}
+		compiled.follow = append(compiled.follow, template)
+	}
+	if pagination := rule.Pagination; pagination != nil {
+		if pagination.Param == "" {
+			return nil, fmt.Errorf("分页参数名称为空")
+		}
+		switch pagination.Type {
+		case PAGINATION_PAGE:
+			if pagination.TotalPagesPath != "" {
+				if compiled.totalPagesPath, err = compilePath(pagination.TotalPagesPath); err != nil {
+					return nil, err
+				}
+			}
+		case PAGINATION_CURSOR:
+			if pagination.CursorPath == "" {
+				return nil, fmt.Errorf("按游标分页时游标路径不能为空")
+			}
+			if compiled.cursorPath, err = compilePath(pagination.CursorPath); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("不支持的分页方式: %q", pagination.Type)
+		}
+	}
+	return compiled, nil
+}
+
+// 用于编译URL模板
+func compileURLTemplate(raw string) (*urlTemplate, error) {
+	if raw == "" {
+		return nil, fmt.Errorf("空的URL模板")
+	}
+	template := &urlTemplate{}
+	rest := raw
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			template.texts = append(template.texts, rest)
+			return template, nil
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("URL模板 %q 中缺少 }", raw)
+		}
+		path, err := compilePath(rest[start+1 : start+end])
+		if err != nil {
+			return nil, err
+		}
+		template.texts = append(template.texts, rest[:start])
+		template.paths = append(template.paths, path)
+		rest = rest[start+end+1:]
+	}
+}
+
+// 用于根据给定的JSON元素填充模板
+func (template *urlTemplate) expand(value interface{}) (string, error) {
+	var buffer bytes.Buffer
+	for i, path := range template.paths {
+		buffer.WriteString(template.texts[i])
+		v, ok := path.eval(value)
+		if !ok {
+			return "", fmt.Errorf("URL模板的路径 %q 不存在", path.raw)
+		}
+		s, ok := stringifyJSONValue(v)
+		if !ok {
+			return "", fmt.Errorf("URL模板的路径 %q 的值类型不支持: %T", path.raw, v)
+		}
+		buffer.WriteString(url.PathEscape(s))
+	}
+	buffer.WriteString(template.texts[len(template.texts)-1])
+	return buffer.String(), nil
+}
+
+// 用于获取按规则解析JSON响应的函数
+// 响应不是合法的JSON或结构与规则不符时会返回错误，而不会引发运行时恐慌
+func (extractor *JSONExtractor) ParseResponse() module.ParseResponse {
+	return func(httpResp *http.Response, respDepth uint32) ([]module.Data, []error) {
+		if httpResp == nil {
+			return nil, []error{fmt.Errorf("空的HTTP响应")}
+		}
+		if httpResp.Request == nil || httpResp.Request.URL == nil {
+			return nil, []error{fmt.Errorf("空的HTTP请求")}
+		}
+		if httpResp.Body == nil {
+			return nil, []error{fmt.Errorf("空的HTTP响应体 (requestURL: %s)", httpResp.Request.URL)}
+		}
+		reqURL := httpResp.Request.URL
+		var matched []*compiledJSONRule
+		for _, rule := range extractor.rules {
+			if rule.urlPattern == nil || rule.urlPattern.MatchString(reqURL.String()) {
+				matched = append(matched, rule)
+			}
+		}
+		if len(matched) == 0 {
+			return nil, nil
+		}
+		decoder := json.NewDecoder(httpResp.Body)
+		decoder.UseNumber()
+		var doc interface{}
+		if err := decoder.Decode(&doc); err != nil {
+			return nil, []error{fmt.Errorf("解析JSON响应出现异常: %s (requestURL: %s)", err, reqURL)}
+		}
+		var dataList []module.Data
+		var errs []error
+		for _, rule := range matched {
+			ruleData, ruleErrs := rule.extract(doc, httpResp.Request, respDepth)
+			dataList = append(dataList, ruleData...)
+			errs = append(errs, ruleErrs...)
+		}
+		return dataList, errs
+	}
+}
+
+// 用于按规则从JSON文档中抽取条目与请求
+func (rule *compiledJSONRule) extract(doc interface{}, httpReq *http.Request,
+	respDepth uint32) ([]module.Data, []error) {
+	var elements []interface{}
+	value, ok := rule.items.eval(doc)
+	if !ok {
+		return nil, []error{fmt.Errorf("规则 %q 的条目列表路径 %q 不存在 (requestURL: %s)",
+			rule.Name, rule.Items, httpReq.URL)}
+	}
+	if rule.Items == "" {
+		elements = []interface{}{value}
+	} else if elements, ok = value.([]interface{}); !ok {
+		return nil, []error{fmt.Errorf("规则 %q 的条目列表路径 %q 的值不是列表: %T (requestURL: %s)",
+			rule.Name, rule.Items, value, httpReq.URL)}
+	}
+	var dataList []module.Data
+	var errs []error
+	for i, element := range elements {
+		if len(rule.fields) > 0 {
+			item, err := rule.extractItem(element)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s (元素: %d, requestURL: %s)", err, i, httpReq.URL))
+			} else {
+				dataList = append(dataList, item)
+			}
+		}
+		for _, template := range rule.follow {
+			link, err := template.expand(element)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("规则 %q 生成请求失败: %s (元素: %d, requestURL: %s)",
+					rule.Name, err, i, httpReq.URL))
+				continue
+			}
+			u, err := url.Parse(link)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			req, err := http.NewRequest("GET", httpReq.URL.ResolveReference(u).String(), nil)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			dataList = append(dataList, module.NewRequest(req, respDepth))
+		}
+	}
+	if rule.Pagination != nil {
+		next, err := rule.nextPage(doc, httpReq, len(elements))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("规则 %q 生成下一页请求失败: %s (requestURL: %s)",
+				rule.Name, err, httpReq.URL))
+		} else if next != nil {
+			dataList = append(dataList, module.NewRequest(next, respDepth))
+		}
+	}
+	return dataList, errs
+}
+
+// 用于从单个JSON元素中抽取条目
+func (rule *compiledJSONRule) extractItem(element interface{}) (module.Item, error) {
+	item := module.Item{}
+	for _, field := range rule.fields {
+		value, ok := field.path.eval(element)
+		if !ok || value == nil {
+			if field.Required {
+				return nil, fmt.Errorf("规则 %q 缺少必需的字段 %q", rule.Name, field.Name)
+			}
+			continue
+		}
+		item[field.Name] = normalizeJSONValue(value)
+	}
+	return item, nil
+}
+
+// 用于生成下一页的请求，没有下一页时返回nil
+func (rule *compiledJSONRule) nextPage(doc interface{}, httpReq *http.Request,
+	elementNumber int) (*http.Request, error) {
+	pagination := rule.Pagination
+	params, err := requestParams(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	var next string
+	switch pagination.Type {
+	case PAGINATION_PAGE:
+		if elementNumber == 0 {
+			return nil, nil
+		}
+		current := 1
+		if v := params.Get(pagination.Param); v != "" {
+			if current, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("当前页码无效: %q", v)
+			}
+		}
+		if pagination.MaxPages > 0 && current >= pagination.MaxPages {
+			return nil, nil
+		}
+		if rule.totalPagesPath != nil {
+			value, ok := rule.totalPagesPath.eval(doc)
+			if !ok {
+				return nil, fmt.Errorf("总页数的路径 %q 不存在", pagination.TotalPagesPath)
+			}
+			s, _ := stringifyJSONValue(value)
+			total, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, fmt.Errorf("总页数无效: %v", value)
+			}
+			if current >= total {
+				return nil, nil
+			}
+		}
+		next = strconv.Itoa(current + 1)
+	case PAGINATION_CURSOR:
+		value, ok := rule.cursorPath.eval(doc)
+		if !ok || value == nil {
+			return nil, nil
+		}
+		if next, ok = stringifyJSONValue(value); !ok {
+			return nil, fmt.Errorf("游标的值类型不支持: %T", value)
+		}
+		if next == "" {
+			return nil, nil
+		}
+	}
+	params.Set(pagination.Param, next)
+	return withParams(httpReq, params)
+}
+
+// 用于判断请求是否以表单的形式提交参数
+func isFormRequest(httpReq *http.Request) bool {
+	if httpReq.Method != http.MethodPost && httpReq.Method != http.MethodPut {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(httpReq.Header.Get("Content-Type"))
+	return mediaType == "application/x-www-form-urlencoded"
+}
+
+// 用于获取请求的参数，表单请求取表单字段，其他请求取查询参数
+func requestParams(httpReq *http.Request) (url.Values, error) {
+	if !isFormRequest(httpReq) {
+		return httpReq.URL.Query(), nil
+	}
+	if httpReq.GetBody == nil {
+		return nil, fmt.Errorf("无法重新读取表单请求的请求体")
+	}
+	body, err := httpReq.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	return url.ParseQuery(string(data))
+}
+
+// 用于创建一个与给定请求的方法和URL相同但参数不同的请求
+// 只有由参数编码方式决定的Content-Type会被设置，原请求的其他请求头（如认证、Cookie等）
+// 不会被复制，它们应由下载器在发送时按目标重新设置
+func withParams(httpReq *http.Request, params url.Values) (*http.Request, error) {
+	u := *httpReq.URL
+	var body []byte
+	if isFormRequest(httpReq) {
+		body = []byte(params.Encode())
+	} else {
+		u.RawQuery = params.Encode()
+	}
+	var next *http.Request
+	var err error
+	if body != nil {
+		next, err = http.NewRequest(httpReq.Method, u.String(), bytes.NewReader(body))
+	} else {
+		next, err = http.NewRequest(httpReq.Method, u.String(), nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		next.Header.Set("Content-Type", httpReq.Header.Get("Content-Type"))
+	}
+	return next, nil
+}
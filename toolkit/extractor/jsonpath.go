@@ -0,0 +1,139 @@
+package extractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 代表JSON路径中的一段
+type pathSegment struct {
+	// 字典的键，为空时表示按下标取值
+	key string
+	// 列表的下标，仅当key为空时有效
+	index int
+}
+
+// 代表编译后的JSON路径
+// 支持"$.a.b[0].c"或"a.b[0].c"形式，"$"或空串代表根
+type jsonPath struct {
+	// 原始的路径
+	raw string
+	// 路径的各段
+	segments []pathSegment
+}
+
+// 用于编译JSON路径
+func compilePath(raw string) (*jsonPath, error) {
+	path := &jsonPath{raw: raw}
+	rest := strings.TrimSpace(raw)
+	rest = strings.TrimPrefix(rest, "$")
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("JSON路径 %q 中有空的键", raw)
+			}
+			path.segments = append(path.segments, pathSegment{key: rest[:end]})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("JSON路径 %q 中缺少 ]", raw)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				path.segments = append(path.segments, pathSegment{key: inner[1 : len(inner)-1]})
+			} else {
+				index, err := strconv.Atoi(inner)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("JSON路径 %q 中的下标无效: %q", raw, inner)
+				}
+				path.segments = append(path.segments, pathSegment{index: index})
+			}
+			rest = rest[end+1:]
+		default:
+			if len(path.segments) > 0 {
+				return nil, fmt.Errorf("JSON路径 %q 的格式无效", raw)
+			}
+			rest = "." + rest
+		}
+	}
+	return path, nil
+}
+
+// 用于按路径取值
+// 第二个结果值为false时表示路径不存在或途经的值类型不符
+func (path *jsonPath) eval(value interface{}) (interface{}, bool) {
+	current := value
+	for _, segment := range path.segments {
+		if segment.key != "" {
+			object, ok := current.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if current, ok = object[segment.key]; !ok {
+				return nil, false
+			}
+			continue
+		}
+		list, ok := current.([]interface{})
+		if !ok || segment.index >= len(list) {
+			return nil, false
+		}
+		current = list[segment.index]
+	}
+	return current, true
+}
+
+// 用于把JSON值转换为条目中使用的值
+// 整数会被转换为int64，其他数字会被转换为float64
+func normalizeJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			result[key] = normalizeJSONValue(elem)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, elem := range v {
+			result[i] = normalizeJSONValue(elem)
+		}
+		return result
+	}
+	return value
+}
+
+// 用于把JSON值转换为字符串，用于填充URL模板
+// 字典和列表不能被转换
+func stringifyJSONValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	}
+	return "", false
+}
@@ -0,0 +1,88 @@
+package extractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// 代表抽取规则文件的内容
+type RuleSet struct {
+	// 抽取规则的列表，与页面URL匹配的规则都会被使用
+	Rules []Rule `json:"rules" yaml:"rules"`
+}
+
+// 代表针对某类页面的抽取规则
+type Rule struct {
+	// 规则的名称，用于错误信息
+	Name string `json:"name" yaml:"name"`
+	// 匹配的页面URL的正则表达式，为空时匹配所有页面
+	URLPattern string `json:"url_pattern,omitempty" yaml:"url_pattern,omitempty"`
+	// 条目的根元素选择器，每个匹配的元素生成一个条目
+	// 为空时整个页面只生成一个条目
+	Root string `json:"root,omitempty" yaml:"root,omitempty"`
+	// 条目字段的抽取规则
+	Fields []FieldRule `json:"fields" yaml:"fields"`
+	// 需要跟进的链接的抽取规则，每个链接会生成一个请求
+	Follow []LinkRule `json:"follow,omitempty" yaml:"follow,omitempty"`
+}
+
+// 代表条目字段的抽取规则
+type FieldRule struct {
+	// 字段名称
+	Name string `json:"name" yaml:"name"`
+	// 相对于根元素的CSS选择器，为空时使用根元素本身
+	Selector string `json:"selector,omitempty" yaml:"selector,omitempty"`
+	// 取值的属性名称，为空或为"text"时取文本，为"html"时取内部HTML
+	Attr string `json:"attr,omitempty" yaml:"attr,omitempty"`
+	// 文本中空白字符的处理方式："collapse"代表合并为单个空格，"remove"代表全部删除
+	// 为空时只去掉首尾的空白字符
+	Whitespace string `json:"whitespace,omitempty" yaml:"whitespace,omitempty"`
+	// 用于后处理的正则表达式，不匹配的值会被丢弃
+	// 含有分组时取第一个分组，否则取整个匹配
+	Regex string `json:"regex,omitempty" yaml:"regex,omitempty"`
+	// 为true时把值视为URL并解析为绝对URL
+	Absolute bool `json:"absolute,omitempty" yaml:"absolute,omitempty"`
+	// 大于0时只使用第Index个（从0开始计数）匹配的元素，否则使用所有匹配的元素
+	Index int `json:"index,omitempty" yaml:"index,omitempty"`
+	// 为true时取所有元素的值组成列表，否则取第一个有效的值
+	List bool `json:"list,omitempty" yaml:"list,omitempty"`
+	// 列表值的连接符，不为空时列表会被连接为一个字符串
+	Join string `json:"join,omitempty" yaml:"join,omitempty"`
+	// 为true时缺少该字段的条目会被丢弃并报告错误
+	Required bool `json:"required,omitempty" yaml:"required,omitempty"`
+}
+
+// 代表需要跟进的链接的抽取规则
+type LinkRule struct {
+	// 链接元素的CSS选择器
+	Selector string `json:"selector" yaml:"selector"`
+	// 链接所在的属性名称，为空时使用"href"
+	Attr string `json:"attr,omitempty" yaml:"attr,omitempty"`
+	// 链接需要匹配的正则表达式，为空时接受所有链接
+	Pattern string `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+}
+
+// 用于从文件中载入抽取规则并创建抽取器
+// 扩展名为.yaml或.yml的文件按YAML解析，其他文件按JSON解析
+func Load(path string) (*Extractor, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("抽取器：读取规则文件出现异常: %s (path: %s)", err, path)
+	}
+	var ruleSet RuleSet
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &ruleSet)
+	default:
+		err = json.Unmarshal(data, &ruleSet)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("抽取器：解析规则文件出现异常: %s (path: %s)", err, path)
+	}
+	return New(ruleSet)
+}
@@ -0,0 +1,265 @@
+package media
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 未完成的文件的元数据文件的后缀
+const META_SUFFIX = ".meta"
+
+// 代表未完成的文件的元数据，用于判断能否从断点继续下载
+type partMeta struct {
+	// 下载的URL
+	URL string `json:"url"`
+	// 服务端返回的ETag
+	ETag string `json:"etag,omitempty"`
+	// 服务端返回的Last-Modified
+	LastModified string `json:"last_modified,omitempty"`
+	// 服务端声明的总大小，未知时为0
+	Total int64 `json:"total,omitempty"`
+}
+
+// 用于判断元数据中是否有可用于If-Range的校验信息
+func (meta partMeta) validatable() bool {
+	return meta.ETag != "" || meta.LastModified != ""
+}
+
+// 用于读取元数据，文件不存在或无法解析时返回空的元数据
+func loadMeta(path string) partMeta {
+	var meta partMeta
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return meta
+	}
+	json.Unmarshal(data, &meta)
+	return meta
+}
+
+// 用于保存元数据
+func saveMeta(path string, meta partMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("媒体下载：序列化元数据出现异常: %s", err)
+	}
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("媒体下载：写入元数据出现异常: %s (path: %s)", err, path)
+	}
+	return nil
+}
+
+// 代表可续传的媒体文件下载器
+type Fetcher struct {
+	// HTTP客户端
+	client *http.Client
+	// 最大重试次数
+	maxRetries int
+	// 重试前的等待时间
+	retryDelay time.Duration
+}
+
+// 用于创建一个媒体文件下载器
+// 参数client为nil时使用http.DefaultClient
+func NewFetcher(client *http.Client, maxRetries int, retryDelay time.Duration) *Fetcher {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if maxRetries < 0 {
+		maxRetries = 0
+	}
+	return &Fetcher{
+		client:     client,
+		maxRetries: maxRetries,
+		retryDelay: retryDelay,
+	}
+}
+
+// 代表可以通过重试解决的错误
+type retryableError struct {
+	err error
+}
+
+func (err *retryableError) Error() string {
+	return err.err.Error()
+}
+
+// 用于把给定URL的内容下载到目标文件
+// 目标文件旁有由Fetch留下的未完成的文件时，会用Range请求从断点继续下载，
+// 服务端内容已变化（If-Range不满足）或无法校验服务端内容是否变化时会从头下载
+// 网络错误、传输中断和5xx状态码会触发重试，每次重试都从已写入的位置继续
+// 重试耗尽时未完成的文件会被保留，服务端给出了ETag或Last-Modified时下次调用会从断点继续下载
+func (fetcher *Fetcher) Fetch(rawURL string, dest string, expect Expect) (*Result, error) {
+	if err := expect.Check(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+		return nil, fmt.Errorf("媒体下载：创建目录出现异常: %s (path: %s)", err, filepath.Dir(dest))
+	}
+	part := dest + PART_SUFFIX
+	metaPath := part + META_SUFFIX
+	meta := loadMeta(metaPath)
+	// 元数据缺失、属于其他URL或没有ETag和Last-Modified时，
+	// 无法用If-Range确认服务端内容未变化，未完成的文件只能丢弃并从头下载
+	// 同一次调用内的重试不受此限制
+	if meta.URL != rawURL || !meta.validatable() {
+		os.Remove(part)
+		meta = partMeta{}
+	}
+	meta.URL = rawURL
+	resumed := false
+	attempts := 0
+	for {
+		attempts++
+		offset, complete, err := fetcher.attempt(part, metaPath, &meta)
+		if offset > 0 {
+			resumed = true
+		}
+		if err == nil && complete {
+			break
+		}
+		if _, ok := err.(*retryableError); err != nil && (!ok || attempts > fetcher.maxRetries) {
+			return nil, fmt.Errorf("媒体下载：下载失败 (尝试 %d 次): %s (URL: %s)", attempts, err, rawURL)
+		}
+		time.Sleep(fetcher.retryDelay)
+	}
+	result, err := finalize(part, dest, expect, meta.Total)
+	os.Remove(metaPath)
+	if err != nil {
+		return nil, err
+	}
+	result.Resumed = resumed
+	result.Attempts = attempts
+	return result, nil
+}
+
+// 用于发送一次请求并把响应体追加到未完成的文件
+// 结果值依次为本次请求的起始位置和文件是否已完整
+func (fetcher *Fetcher) attempt(part string, metaPath string, meta *partMeta) (int64, bool, error) {
+	var offset int64
+	if fileInfo, err := os.Stat(part); err == nil {
+		offset = fileInfo.Size()
+	}
+	if meta.Total > 0 && offset == meta.Total {
+		return offset, true, nil
+	}
+	httpReq, err := http.NewRequest(http.MethodGet, meta.URL, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	if offset > 0 {
+		httpReq.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if meta.ETag != "" {
+			httpReq.Header.Set("If-Range", meta.ETag)
+		} else if meta.LastModified != "" {
+			httpReq.Header.Set("If-Range", meta.LastModified)
+		}
+	}
+	httpResp, err := fetcher.client.Do(httpReq)
+	if err != nil {
+		return offset, false, &retryableError{err}
+	}
+	defer httpResp.Body.Close()
+	flag := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	switch httpResp.StatusCode {
+	case http.StatusPartialContent:
+		start, total, ok := parseContentRange(httpResp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			os.Remove(part)
+			return 0, false, &retryableError{fmt.Errorf("无效的Content-Range: %q",
+				httpResp.Header.Get("Content-Range"))}
+		}
+		if total > 0 {
+			meta.Total = total
+		}
+	case http.StatusOK:
+		offset = 0
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		meta.Total = 0
+		if httpResp.ContentLength > 0 {
+			meta.Total = httpResp.ContentLength
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// 已有的数据可能就是完整的文件，交由之后的校验判断
+		_, total, ok := parseContentRange(httpResp.Header.Get("Content-Range"))
+		if ok && total == offset {
+			meta.Total = total
+			return offset, true, nil
+		}
+		os.Remove(part)
+		return 0, false, &retryableError{fmt.Errorf("断点位置无效 (offset: %d)", offset)}
+	default:
+		err := fmt.Errorf("状态码 %d", httpResp.StatusCode)
+		if httpResp.StatusCode >= http.StatusInternalServerError {
+			return offset, false, &retryableError{err}
+		}
+		return offset, false, err
+	}
+	meta.ETag = httpResp.Header.Get("ETag")
+	meta.LastModified = httpResp.Header.Get("Last-Modified")
+	if err := saveMeta(metaPath, *meta); err != nil {
+		return offset, false, err
+	}
+	file, err := os.OpenFile(part, flag, 0600)
+	if err != nil {
+		return offset, false, fmt.Errorf("打开文件出现异常: %s (path: %s)", err, part)
+	}
+	_, err = io.Copy(file, httpResp.Body)
+	if syncErr := file.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return offset, false, &retryableError{err}
+	}
+	if meta.Total > 0 {
+		if fileInfo, err := os.Stat(part); err == nil && fileInfo.Size() < meta.Total {
+			return offset, false, &retryableError{fmt.Errorf("传输中断 (已接收 %d / %d 字节)",
+				fileInfo.Size(), meta.Total)}
+		}
+	}
+	return offset, true, nil
+}
+
+// 用于解析Content-Range响应头，结果值依次为起始位置和总大小（未知时为0）
+func parseContentRange(value string) (int64, int64, bool) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "bytes ") {
+		return 0, 0, false
+	}
+	value = strings.TrimPrefix(value, "bytes ")
+	i := strings.Index(value, "/")
+	if i < 0 {
+		return 0, 0, false
+	}
+	rangePart, totalPart := value[:i], value[i+1:]
+	var total int64
+	if totalPart != "*" {
+		n, err := strconv.ParseInt(totalPart, 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+		total = n
+	}
+	if rangePart == "*" {
+		return 0, total, true
+	}
+	j := strings.Index(rangePart, "-")
+	if j < 0 {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(rangePart[:j], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, total, true
+}
@@ -0,0 +1,200 @@
+package media
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 未完成的文件的后缀
+// 下载中的数据总是先写入与目标文件同目录的“目标文件名+PART_SUFFIX”，完成并校验后再原子地替换目标文件
+const PART_SUFFIX = ".part"
+
+// 代表对下载结果的预期
+type Expect struct {
+	// 预期的文件大小，为0时不检查
+	Size int64
+	// 预期的校验和，格式为“算法:十六进制摘要”，如sha256:9f86d0...
+	// 支持的算法有md5、sha1、sha256和sha512，为空时不检查
+	Checksum string
+}
+
+// 用于自检预期的有效性
+func (expect Expect) Check() error {
+	if expect.Size < 0 {
+		return fmt.Errorf("媒体下载：无效的预期大小: %d", expect.Size)
+	}
+	if expect.Checksum == "" {
+		return nil
+	}
+	_, _, err := parseChecksum(expect.Checksum)
+	return err
+}
+
+// 代表校验失败的错误类型
+type ChecksumError struct {
+	// 文件的路径
+	Path string
+	// 预期的校验和
+	Expected string
+	// 实际的校验和
+	Actual string
+}
+
+func (err *ChecksumError) Error() string {
+	return fmt.Sprintf("媒体下载：校验和不符: 预期 %s, 实际 %s (path: %s)",
+		err.Expected, err.Actual, err.Path)
+}
+
+// 代表下载或保存的结果
+type Result struct {
+	// 文件的最终路径
+	Path string
+	// 文件的大小
+	Size int64
+	// 文件的SHA-256摘要（十六进制）
+	SHA256 string
+	// 是否从未完成的文件处继续下载
+	Resumed bool
+	// 发送请求的次数，保存读取器时为0
+	Attempts int
+}
+
+// 用于解析校验和，结果值依次为哈希函数和小写的十六进制摘要
+func parseChecksum(checksum string) (func() hash.Hash, string, error) {
+	i := strings.Index(checksum, ":")
+	if i < 0 {
+		return nil, "", fmt.Errorf("媒体下载：无效的校验和: %q", checksum)
+	}
+	algo, digest := strings.ToLower(checksum[:i]), strings.ToLower(checksum[i+1:])
+	var newHash func() hash.Hash
+	switch algo {
+	case "md5":
+		newHash = md5.New
+	case "sha1":
+		newHash = sha1.New
+	case "sha256":
+		newHash = sha256.New
+	case "sha512":
+		newHash = sha512.New
+	default:
+		return nil, "", fmt.Errorf("媒体下载：不支持的校验算法: %q", algo)
+	}
+	if _, err := hex.DecodeString(digest); err != nil || len(digest) != newHash().Size()*2 {
+		return nil, "", fmt.Errorf("媒体下载：无效的校验和: %q", checksum)
+	}
+	return newHash, digest, nil
+}
+
+// 用于把读取器中的数据流式地保存到目标文件
+// 数据会先写入未完成的文件，大小与校验和均符合预期后才会替换目标文件
+// 读取出错时未完成的文件会被删除，因为没有可用于续传校验的ETag等信息
+func Save(reader io.Reader, dest string, expect Expect) (*Result, error) {
+	if reader == nil {
+		return nil, fmt.Errorf("媒体下载：空的读取器")
+	}
+	if err := expect.Check(); err != nil {
+		return nil, err
+	}
+	part := dest + PART_SUFFIX
+	if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+		return nil, fmt.Errorf("媒体下载：创建目录出现异常: %s (path: %s)", err, filepath.Dir(dest))
+	}
+	// 之前的Fetch留下的元数据不再对应未完成的文件的内容
+	os.Remove(part + META_SUFFIX)
+	file, err := os.Create(part)
+	if err != nil {
+		return nil, fmt.Errorf("媒体下载：创建文件出现异常: %s (path: %s)", err, part)
+	}
+	_, err = io.Copy(file, reader)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(part)
+		return nil, fmt.Errorf("媒体下载：写入文件出现异常: %s (path: %s)", err, part)
+	}
+	return finalize(part, dest, expect, 0)
+}
+
+// 用于校验未完成的文件并把它原子地移动到目标路径
+// 参数total为服务端声明的总大小，为0时不检查
+// 校验失败时未完成的文件会被删除，因为它已无法通过续传修复
+func finalize(part string, dest string, expect Expect, total int64) (*Result, error) {
+	fileInfo, err := os.Stat(part)
+	if err != nil {
+		return nil, fmt.Errorf("媒体下载：读取文件信息出现异常: %s (path: %s)", err, part)
+	}
+	size := fileInfo.Size()
+	for _, want := range []int64{expect.Size, total} {
+		if want > 0 && size != want {
+			os.Remove(part)
+			return nil, fmt.Errorf("媒体下载：文件大小不符: 预期 %d 字节, 实际 %d 字节 (path: %s)",
+				want, size, dest)
+		}
+	}
+	sum, err := hashFile(part, expect.Checksum)
+	if err != nil {
+		return nil, err
+	}
+	if sum.expected != "" && sum.actual != sum.expected {
+		os.Remove(part)
+		return nil, &ChecksumError{Path: dest, Expected: expect.Checksum,
+			Actual: expect.Checksum[:strings.Index(expect.Checksum, ":")+1] + sum.actual}
+	}
+	if err := os.Rename(part, dest); err != nil {
+		return nil, fmt.Errorf("媒体下载：替换文件出现异常: %s (path: %s)", err, dest)
+	}
+	return &Result{Path: dest, Size: size, SHA256: sum.sha256}, nil
+}
+
+// 代表文件摘要的计算结果
+type fileSum struct {
+	// SHA-256摘要
+	sha256 string
+	// 按预期的算法计算的摘要，没有预期的校验和时为空
+	actual string
+	// 预期的摘要
+	expected string
+}
+
+// 用于计算文件的SHA-256摘要以及预期算法的摘要
+func hashFile(path string, checksum string) (fileSum, error) {
+	var sum fileSum
+	sha := sha256.New()
+	writers := []io.Writer{sha}
+	var h hash.Hash
+	if checksum != "" {
+		newHash, expected, err := parseChecksum(checksum)
+		if err != nil {
+			return sum, err
+		}
+		h = newHash()
+		sum.expected = expected
+		writers = append(writers, h)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return sum, fmt.Errorf("媒体下载：打开文件出现异常: %s (path: %s)", err, path)
+	}
+	defer file.Close()
+	if _, err := io.Copy(io.MultiWriter(writers...), file); err != nil {
+		return sum, fmt.Errorf("媒体下载：读取文件出现异常: %s (path: %s)", err, path)
+	}
+	sum.sha256 = hex.EncodeToString(sha.Sum(nil))
+	if h != nil {
+		sum.actual = hex.EncodeToString(h.Sum(nil))
+	}
+	return sum, nil
+}
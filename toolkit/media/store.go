@@ -0,0 +1,226 @@
+package media
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"../storage"
+)
+
+// 内容寻址存储中的索引对象的键
+const INDEX_KEY = "index.json"
+
+// 代表索引中某个URL的记录
+type Entry struct {
+	// 内容的SHA-256摘要（十六进制）
+	Hash string `json:"hash"`
+	// 文件的扩展名（不含点）
+	Ext string `json:"ext,omitempty"`
+	// 文件的大小
+	Size int64 `json:"size"`
+}
+
+// 代表存入内容寻址存储的结果
+type Stored struct {
+	// 内容的SHA-256摘要（十六进制）
+	Hash string
+	// 文件在存储后端中的键
+	Key string
+	// 文件的大小
+	Size int64
+	// 相同的内容是否已经存在，为true时本次没有写入新文件
+	Duplicate bool
+}
+
+// 内容寻址存储的接口类型
+// 文件以内容的SHA-256摘要命名，并按摘要的前两级（各两个十六进制字符）分目录存放在存储后端中，
+// 因此相同的内容只会保存一份，不同内容的同名文件也不会互相覆盖
+// 该接口的实现类型必须是并发安全的
+type Store interface {
+	// 用于把读取器中的数据存入存储，并把URL记入索引
+	// 读取出错时暂存文件会被删除，之后可以通过Fetch重新下载
+	Put(rawURL string, reader io.Reader, ext string, expect Expect) (*Stored, error)
+	// 用于下载给定URL的内容并存入存储
+	// 下载中断时暂存文件会被保留，服务端内容可以校验时再次调用会从断点继续下载
+	Fetch(fetcher *Fetcher, rawURL string, ext string, expect Expect) (*Stored, error)
+	// 用于获取给定URL的索引记录
+	// 若记录不存在，则第二个结果值为false
+	Lookup(rawURL string) (Entry, bool)
+	// 用于获取给定摘要和扩展名的文件在存储后端中的键
+	KeyOf(hash string, ext string) string
+	// 用于获取索引记录的数量
+	Len() int
+	// 用于把索引持久化
+	Save() error
+}
+
+// 代表内容寻址存储的实现类型
+type myStore struct {
+	// 代表存储后端
+	backend storage.Storage
+	// 代表本地的暂存目录
+	stagingDir string
+	// 代表URL与索引记录的映射
+	entries map[string]Entry
+	// 代表自上次持久化以来是否有修改
+	dirty bool
+	// 代表保护内部共享资源的读写锁
+	rwLock sync.RWMutex
+}
+
+// 用于创建一个基于给定存储后端的内容寻址存储
+// 下载中的文件会先放在本地的暂存目录stagingDir中，校验通过后才会写入存储后端
+// 若存储后端中已有索引，则会先载入其中的记录
+func NewStore(backend storage.Storage, stagingDir string) (Store, error) {
+	if backend == nil {
+		return nil, fmt.Errorf("媒体存储：空的存储后端")
+	}
+	if stagingDir == "" {
+		return nil, fmt.Errorf("媒体存储：空的暂存目录")
+	}
+	store := &myStore{
+		backend:    backend,
+		stagingDir: stagingDir,
+		entries:    map[string]Entry{},
+	}
+	if err := os.MkdirAll(stagingDir, 0700); err != nil {
+		return nil, fmt.Errorf("媒体存储：创建目录出现异常: %s (path: %s)", err, stagingDir)
+	}
+	reader, err := backend.Get(INDEX_KEY)
+	if err == storage.ErrNotFound {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("媒体存储：读取索引出现异常: %s", err)
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("媒体存储：读取索引出现异常: %s", err)
+	}
+	if err := json.Unmarshal(data, &store.entries); err != nil {
+		return nil, fmt.Errorf("媒体存储：解析索引出现异常: %s", err)
+	}
+	return store, nil
+}
+
+// 用于获取给定URL的暂存文件路径
+// 同一URL的暂存文件路径总是相同的，以便从断点继续下载
+func (store *myStore) stagingPath(rawURL string) string {
+	sum := sha1.Sum([]byte(rawURL))
+	return filepath.Join(store.stagingDir, hex.EncodeToString(sum[:]))
+}
+
+func (store *myStore) Put(rawURL string, reader io.Reader, ext string, expect Expect) (*Stored, error) {
+	result, err := Save(reader, store.stagingPath(rawURL), expect)
+	if err != nil {
+		return nil, err
+	}
+	return store.commit(rawURL, result, ext)
+}
+
+func (store *myStore) Fetch(fetcher *Fetcher, rawURL string, ext string, expect Expect) (*Stored, error) {
+	result, err := fetcher.Fetch(rawURL, store.stagingPath(rawURL), expect)
+	if err != nil {
+		return nil, err
+	}
+	return store.commit(rawURL, result, ext)
+}
+
+// 用于把已校验的暂存文件写入存储后端，并把URL记入索引
+// 暂存文件总会被删除，相同的内容已存在时不会重复写入
+func (store *myStore) commit(rawURL string, result *Result, ext string) (*Stored, error) {
+	defer os.Remove(result.Path)
+	ext = cleanExt(ext)
+	key := store.KeyOf(result.SHA256, ext)
+	stored := &Stored{Hash: result.SHA256, Key: key, Size: result.Size}
+	exists, err := store.backend.Exists(key)
+	if err != nil {
+		return nil, fmt.Errorf("媒体存储：查询文件出现异常: %s", err)
+	}
+	if exists {
+		stored.Duplicate = true
+	} else {
+		file, err := os.Open(result.Path)
+		if err != nil {
+			return nil, fmt.Errorf("媒体存储：打开文件出现异常: %s (path: %s)", err, result.Path)
+		}
+		err = store.backend.Put(key, file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("媒体存储：写入文件出现异常: %s", err)
+		}
+	}
+	store.rwLock.Lock()
+	defer store.rwLock.Unlock()
+	store.entries[rawURL] = Entry{Hash: result.SHA256, Ext: ext, Size: result.Size}
+	store.dirty = true
+	return stored, nil
+}
+
+func (store *myStore) Lookup(rawURL string) (Entry, bool) {
+	store.rwLock.RLock()
+	defer store.rwLock.RUnlock()
+	entry, ok := store.entries[rawURL]
+	return entry, ok
+}
+
+func (store *myStore) KeyOf(hash string, ext string) string {
+	name := hash
+	if ext = cleanExt(ext); ext != "" {
+		name += "." + ext
+	}
+	if len(hash) < 4 {
+		return name
+	}
+	return hash[:2] + "/" + hash[2:4] + "/" + name
+}
+
+func (store *myStore) Len() int {
+	store.rwLock.RLock()
+	defer store.rwLock.RUnlock()
+	return len(store.entries)
+}
+
+// 存储后端保证写入是原子的，中途出错不会损坏原有的索引
+func (store *myStore) Save() error {
+	store.rwLock.Lock()
+	defer store.rwLock.Unlock()
+	if !store.dirty {
+		return nil
+	}
+	data, err := json.MarshalIndent(store.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("媒体存储：序列化索引出现异常: %s", err)
+	}
+	if err := store.backend.Put(INDEX_KEY, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("媒体存储：写入索引出现异常: %s", err)
+	}
+	store.dirty = false
+	return nil
+}
+
+// 用于清理扩展名，只保留小写的字母和数字
+// 形如svg+xml的扩展名会被截取为svg
+func cleanExt(ext string) string {
+	ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+	if i := strings.IndexAny(ext, "+;"); i >= 0 {
+		ext = ext[:i]
+	}
+	var b strings.Builder
+	for _, r := range ext {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,326 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 代表代理轮换方式的类型
+type Mode string
+
+// 当前支持的代理轮换方式的常量
+const (
+	// 每个请求依次使用下一个可用的代理
+	MODE_PER_REQUEST Mode = "per_request"
+	// 同一主机的请求固定使用同一个代理，直到该代理被隔离
+	MODE_PER_HOST Mode = "per_host"
+)
+
+// 默认的连续失败次数阈值
+const DEFAULT_FAILURE_THRESHOLD uint32 = 3
+
+// 默认的隔离时长
+const DEFAULT_QUARANTINE = time.Minute
+
+// 代表代理健康策略的类型
+type Policy struct {
+	// 连续失败多少次后隔离代理，为0时使用默认值
+	FailureThreshold uint32
+	// 代理被隔离的时长，为0时使用默认值
+	Quarantine time.Duration
+}
+
+// 用于获取填充了默认值的健康策略
+func (policy Policy) normalize() Policy {
+	if policy.FailureThreshold == 0 {
+		policy.FailureThreshold = DEFAULT_FAILURE_THRESHOLD
+	}
+	if policy.Quarantine <= 0 {
+		policy.Quarantine = DEFAULT_QUARANTINE
+	}
+	return policy
+}
+
+// 代表单个代理的统计信息的类型
+type Stats struct {
+	// 代理的URL
+	URL string `json:"url"`
+	// 是否可用
+	Healthy bool `json:"healthy"`
+	// 经该代理发出的请求的数量
+	Requests uint64 `json:"requests"`
+	// 失败的请求的数量
+	Failures uint64 `json:"failures"`
+	// 连续失败的次数
+	ConsecutiveFailures uint64 `json:"consecutive_failures"`
+	// 最近一次的错误信息
+	LastError string `json:"last_error,omitempty"`
+	// 隔离的截止时间，未被隔离时为空
+	QuarantinedUntil string `json:"quarantined_until,omitempty"`
+}
+
+// 代表代理池的摘要类型
+type Summary struct {
+	// 代理的总数
+	Total int `json:"total"`
+	// 可用代理的数量
+	Healthy int `json:"healthy"`
+	// 轮换方式
+	Mode Mode `json:"mode"`
+	// 各代理的统计信息
+	Proxies []Stats `json:"proxies"`
+}
+
+// 代理池的接口类型
+// 该接口的实现类型必须是并发安全的
+type Pool interface {
+	// 用于为给定主机的请求选择一个可用的代理
+	Pick(host string) (*url.URL, error)
+	// 用于记录经给定代理发出的请求的结果
+	Observe(proxyURL *url.URL, err error)
+	// 用于记录对给定代理的主动检查的结果
+	// 检查失败的代理会被立即隔离，检查成功会解除隔离
+	RecordCheck(proxyURL *url.URL, err error)
+	// 用于获取所有代理
+	Proxies() []*url.URL
+	// 用于获取代理池的摘要
+	Summary() *Summary
+}
+
+// 代表单个代理的状态
+type proxyState struct {
+	// 代理的URL
+	url *url.URL
+	// 请求的数量
+	requests uint64
+	// 失败的数量
+	failures uint64
+	// 连续失败的次数
+	consecutiveFailures uint64
+	// 最近一次的错误
+	lastErr error
+	// 隔离的截止时间
+	quarantinedUntil time.Time
+}
+
+// 用于判断代理在给定时刻是否可用
+func (state *proxyState) healthy(now time.Time) bool {
+	return !now.Before(state.quarantinedUntil)
+}
+
+// 代表代理池的实现类型
+type myPool struct {
+	// 代理的轮换方式
+	mode Mode
+	// 健康策略
+	policy Policy
+	// 代理状态的列表，顺序与创建时给定的代理列表一致
+	states []*proxyState
+	// 代理URL与代理状态的映射
+	stateMap map[string]*proxyState
+	// 下一次轮询的位置
+	next int
+	// 主机与代理URL的映射，仅用于MODE_PER_HOST
+	sticky map[string]string
+	// 互斥锁
+	lock sync.Mutex
+}
+
+// 用于创建一个代理池
+// 参数proxies中的每一项都是代理的URL，支持的协议有http、https和socks5
+// 参数mode为空时使用MODE_PER_REQUEST
+func NewPool(proxies []string, mode Mode, policy Policy) (Pool, error) {
+	if len(proxies) == 0 {
+		return nil, fmt.Errorf("代理池：空的代理列表")
+	}
+	switch mode {
+	case "":
+		mode = MODE_PER_REQUEST
+	case MODE_PER_REQUEST, MODE_PER_HOST:
+	default:
+		return nil, fmt.Errorf("代理池：不支持的轮换方式: %s", mode)
+	}
+	pool := &myPool{
+		mode:     mode,
+		policy:   policy.normalize(),
+		stateMap: map[string]*proxyState{},
+		sticky:   map[string]string{},
+	}
+	for _, proxy := range proxies {
+		proxyURL, err := parseProxyURL(proxy)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := pool.stateMap[proxyURL.String()]; ok {
+			continue
+		}
+		state := &proxyState{url: proxyURL}
+		pool.states = append(pool.states, state)
+		pool.stateMap[proxyURL.String()] = state
+	}
+	return pool, nil
+}
+
+// 用于解析代理的URL
+func parseProxyURL(proxy string) (*url.URL, error) {
+	proxyURL, err := url.Parse(strings.TrimSpace(proxy))
+	if err != nil {
+		return nil, fmt.Errorf("代理池：无效的代理URL: %q (%s)", proxy, err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("代理池：不支持的代理协议: %q", proxy)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("代理池：代理URL缺少主机: %q", proxy)
+	}
+	return proxyURL, nil
+}
+
+// 用于从文件中加载代理列表
+// 文件中每行一个代理URL，空行与以#开头的行会被忽略
+func LoadList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("代理池：打开代理列表文件失败: %s", err)
+	}
+	defer file.Close()
+	var proxies []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		proxies = append(proxies, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("代理池：读取代理列表文件失败: %s", err)
+	}
+	return proxies, nil
+}
+
+func (pool *myPool) Pick(host string) (*url.URL, error) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	now := time.Now()
+	if pool.mode == MODE_PER_HOST {
+		if key, ok := pool.sticky[host]; ok {
+			if state := pool.stateMap[key]; state.healthy(now) {
+				return state.url, nil
+			}
+			delete(pool.sticky, host)
+		}
+	}
+	length := len(pool.states)
+	for i := 0; i < length; i++ {
+		state := pool.states[(pool.next+i)%length]
+		if !state.healthy(now) {
+			continue
+		}
+		pool.next = (pool.next + i + 1) % length
+		if pool.mode == MODE_PER_HOST {
+			pool.sticky[host] = state.url.String()
+		}
+		return state.url, nil
+	}
+	return nil, fmt.Errorf("代理池：没有可用的代理 (总数: %d)", length)
+}
+
+func (pool *myPool) Observe(proxyURL *url.URL, err error) {
+	if proxyURL == nil {
+		return
+	}
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	state, ok := pool.stateMap[proxyURL.String()]
+	if !ok {
+		return
+	}
+	state.requests++
+	if err == nil {
+		state.consecutiveFailures = 0
+		return
+	}
+	state.failures++
+	state.consecutiveFailures++
+	state.lastErr = err
+	if state.consecutiveFailures >= uint64(pool.policy.FailureThreshold) {
+		state.quarantinedUntil = time.Now().Add(pool.policy.Quarantine)
+	}
+}
+
+func (pool *myPool) RecordCheck(proxyURL *url.URL, err error) {
+	if proxyURL == nil {
+		return
+	}
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	state, ok := pool.stateMap[proxyURL.String()]
+	if !ok {
+		return
+	}
+	if err == nil {
+		state.consecutiveFailures = 0
+		state.quarantinedUntil = time.Time{}
+		return
+	}
+	state.lastErr = err
+	state.quarantinedUntil = time.Now().Add(pool.policy.Quarantine)
+}
+
+func (pool *myPool) Proxies() []*url.URL {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	proxies := make([]*url.URL, len(pool.states))
+	for i, state := range pool.states {
+		proxies[i] = state.url
+	}
+	return proxies
+}
+
+func (pool *myPool) Summary() *Summary {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	now := time.Now()
+	summary := &Summary{
+		Total:   len(pool.states),
+		Mode:    pool.mode,
+		Proxies: make([]Stats, len(pool.states)),
+	}
+	for i, state := range pool.states {
+		stats := Stats{
+			URL:                 redact(state.url),
+			Healthy:             state.healthy(now),
+			Requests:            state.requests,
+			Failures:            state.failures,
+			ConsecutiveFailures: state.consecutiveFailures,
+		}
+		if stats.Healthy {
+			summary.Healthy++
+		} else {
+			stats.QuarantinedUntil = state.quarantinedUntil.Format(time.RFC3339)
+		}
+		if state.lastErr != nil {
+			stats.LastError = state.lastErr.Error()
+		}
+		summary.Proxies[i] = stats
+	}
+	return summary
+}
+
+// 用于生成隐去了密码的代理URL字符串
+func redact(proxyURL *url.URL) string {
+	if proxyURL.User == nil {
+		return proxyURL.String()
+	}
+	redacted := *proxyURL
+	redacted.User = url.User(proxyURL.User.Username())
+	return redacted.String()
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
+	"sync"
 )
 
 // 多重读取器的接口
@@ -12,6 +14,45 @@ type MultipleReader interface {
 	// Reader用于获取一个可关闭读取器的实例
 	// 后者会持有该多重读取器的数据
 	Reader() io.ReadCloser
+	// Size用于获取数据的总长度（字节）
+	Size() int64
+	// Spilled用于判断数据是否被转存到了临时文件
+	Spilled() bool
+	// Close用于释放多重读取器持有的资源，如临时文件
+	// 已获取的读取器在此之后仍然可用，临时文件会在它们全部关闭后才被删除
+	Close() error
+}
+
+// 代表多重读取器的可选参数的容器类型
+type Options struct {
+	// MaxSize 代表数据的最大长度（字节），为0时不限制
+	MaxSize int64
+	// MemoryThreshold 代表在内存中缓存的数据的最大长度（字节）
+	// 超出该长度的数据会被转存到临时文件，为0时不转存
+	MemoryThreshold int64
+	// TempDir 代表临时文件所在的目录，为空时使用系统默认的临时目录
+	TempDir string
+}
+
+// 用于自检参数的有效性
+func (opts Options) Check() error {
+	if opts.MaxSize < 0 {
+		return fmt.Errorf("多重读取器：无效的最大长度: %d", opts.MaxSize)
+	}
+	if opts.MemoryThreshold < 0 {
+		return fmt.Errorf("多重读取器：无效的内存缓存长度: %d", opts.MemoryThreshold)
+	}
+	return nil
+}
+
+// 代表数据长度超出上限的错误类型
+type TooLargeError struct {
+	// 数据长度的上限（字节）
+	Limit int64
+}
+
+func (err *TooLargeError) Error() string {
+	return fmt.Sprintf("多重读取器：数据长度超出上限 (上限: %d 字节)", err.Limit)
 }
 
 //多重读取器的实现类型
@@ -20,20 +61,180 @@ type myMultipleReader struct {
 }
 
 // 用于新建并返回一个多重读取器的实例
+// 数据会被全部读入内存且长度不受限制
 func NewMultipleReader(reader io.Reader) (MultipleReader, error) {
+	return NewMultipleReaderWithOptions(reader, Options{})
+}
+
+// 用于按给定的参数新建并返回一个多重读取器的实例
+// 数据长度超出opts.MaxSize时会返回*TooLargeError类型的错误值
+// 数据长度超出opts.MemoryThreshold时，数据会被转存到临时文件
+func NewMultipleReaderWithOptions(reader io.Reader, opts Options) (MultipleReader, error) {
+	if err := opts.Check(); err != nil {
+		return nil, err
+	}
+	if reader == nil {
+		return &myMultipleReader{data: []byte{}}, nil
+	}
+	// 多读一个字节以判断数据是否超出了限制
+	memLimit := opts.MemoryThreshold
+	if memLimit == 0 || (opts.MaxSize > 0 && opts.MaxSize < memLimit) {
+		memLimit = opts.MaxSize
+	}
 	var data []byte
 	var err error
-	if reader != nil {
-		data, err = ioutil.ReadAll(reader)
-		if err != nil {
-			return nil, fmt.Errorf("多重读取器：创建多重读取器出现异常: %s", err)
-		}
+	if memLimit > 0 {
+		data, err = ioutil.ReadAll(io.LimitReader(reader, memLimit+1))
 	} else {
-		data = []byte{}
+		data, err = ioutil.ReadAll(reader)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("多重读取器：创建多重读取器出现异常: %s", err)
+	}
+	if memLimit == 0 || int64(len(data)) <= memLimit {
+		return &myMultipleReader{data: data}, nil
 	}
-	return &myMultipleReader{data: data}, nil
+	if opts.MaxSize > 0 && int64(len(data)) > opts.MaxSize {
+		return nil, &TooLargeError{Limit: opts.MaxSize}
+	}
+	return spill(data, reader, opts)
 }
 
 func (rr *myMultipleReader) Reader() io.ReadCloser {
 	return ioutil.NopCloser(bytes.NewReader(rr.data))
 }
+
+func (rr *myMultipleReader) Size() int64 {
+	return int64(len(rr.data))
+}
+
+func (rr *myMultipleReader) Spilled() bool {
+	return false
+}
+
+func (rr *myMultipleReader) Close() error {
+	return nil
+}
+
+// 代表把数据转存到临时文件的多重读取器的实现类型
+type fileMultipleReader struct {
+	// 临时文件的路径
+	path string
+	// 数据的总长度
+	size int64
+	// 尚未关闭的读取器的数量
+	refs int
+	// 多重读取器是否已被关闭
+	closed bool
+	// 保护引用计数的互斥锁
+	lock sync.Mutex
+}
+
+// 代表从临时文件读取数据的读取器
+// 关闭时会减少多重读取器的引用计数
+type fileReader struct {
+	*os.File
+	// 所属的多重读取器
+	parent *fileMultipleReader
+	// 用于保证只释放一次引用
+	once sync.Once
+}
+
+func (r *fileReader) Close() error {
+	err := r.File.Close()
+	r.once.Do(func() {
+		if releaseErr := r.parent.release(false); err == nil {
+			err = releaseErr
+		}
+	})
+	return err
+}
+
+// 用于把已读取的数据和剩余的数据写入临时文件，并返回相应的多重读取器
+func spill(head []byte, rest io.Reader, opts Options) (MultipleReader, error) {
+	file, err := ioutil.TempFile(opts.TempDir, "multiple-reader-")
+	if err != nil {
+		return nil, fmt.Errorf("多重读取器：创建临时文件出现异常: %s", err)
+	}
+	path := file.Name()
+	fail := func(err error) (MultipleReader, error) {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	if _, err := file.Write(head); err != nil {
+		return fail(fmt.Errorf("多重读取器：写入临时文件出现异常: %s", err))
+	}
+	if opts.MaxSize > 0 {
+		rest = io.LimitReader(rest, opts.MaxSize-int64(len(head))+1)
+	}
+	n, err := io.Copy(file, rest)
+	if err != nil {
+		return fail(fmt.Errorf("多重读取器：写入临时文件出现异常: %s", err))
+	}
+	size := int64(len(head)) + n
+	if opts.MaxSize > 0 && size > opts.MaxSize {
+		return fail(&TooLargeError{Limit: opts.MaxSize})
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("多重读取器：关闭临时文件出现异常: %s", err)
+	}
+	return &fileMultipleReader{path: path, size: size}, nil
+}
+
+func (rr *fileMultipleReader) Reader() io.ReadCloser {
+	rr.lock.Lock()
+	defer rr.lock.Unlock()
+	file, err := os.Open(rr.path)
+	if err != nil {
+		return ioutil.NopCloser(&errReader{
+			err: fmt.Errorf("多重读取器：打开临时文件出现异常: %s", err),
+		})
+	}
+	rr.refs++
+	return &fileReader{File: file, parent: rr}
+}
+
+func (rr *fileMultipleReader) Size() int64 {
+	return rr.size
+}
+
+func (rr *fileMultipleReader) Spilled() bool {
+	return true
+}
+
+func (rr *fileMultipleReader) Close() error {
+	return rr.release(true)
+}
+
+// 用于释放一个引用，参数self为true时表示多重读取器本身被关闭
+// 多重读取器已关闭且没有未关闭的读取器时，临时文件会被删除
+func (rr *fileMultipleReader) release(self bool) error {
+	rr.lock.Lock()
+	defer rr.lock.Unlock()
+	if self {
+		if rr.closed {
+			return nil
+		}
+		rr.closed = true
+	} else {
+		rr.refs--
+	}
+	if !rr.closed || rr.refs > 0 {
+		return nil
+	}
+	if err := os.Remove(rr.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("多重读取器：删除临时文件出现异常: %s", err)
+	}
+	return nil
+}
+
+// 代表总是返回给定错误的读取器
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
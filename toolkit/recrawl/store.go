@@ -0,0 +1,125 @@
+package recrawl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 代表某个URL上一次抓取结果的记录
+type Entry struct {
+	// 响应头中的ETag
+	ETag string `json:"etag,omitempty"`
+	// 响应头中的Last-Modified
+	LastModified string `json:"last_modified,omitempty"`
+	// 响应体的内容哈希（SHA-256 十六进制形式）
+	ContentHash string `json:"content_hash,omitempty"`
+	// 最近一次抓取的时间
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// 增量爬取状态存储的接口类型
+// 该接口的实现类型必须是并发安全的
+type Store interface {
+	// 用于获取给定URL的抓取记录
+	// 若记录不存在，则第二个结果值为false
+	Get(url string) (Entry, bool)
+	// 用于保存给定URL的抓取记录
+	Put(url string, entry Entry) error
+	// 用于获取记录的数量
+	Len() int
+	// 用于把所有记录持久化
+	Save() error
+}
+
+// 代表基于JSON文件的状态存储的实现类型
+type myFileStore struct {
+	// 代表持久化文件的路径
+	path string
+	// 代表URL与抓取记录的映射
+	entries map[string]Entry
+	// 代表自上次持久化以来是否有修改
+	dirty bool
+	// 代表保护内部共享资源的读写锁
+	rwLock sync.RWMutex
+}
+
+// 用于创建一个基于JSON文件的状态存储
+// 若文件已存在，则会先载入其中的记录
+func NewFileStore(path string) (Store, error) {
+	if path == "" {
+		return nil, fmt.Errorf("增量爬取：空的状态文件路径")
+	}
+	store := &myFileStore{
+		path:    path,
+		entries: map[string]Entry{},
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return nil, fmt.Errorf("增量爬取：读取状态文件出现异常: %s (path: %s)", err, path)
+	}
+	if len(data) == 0 {
+		return store, nil
+	}
+	if err := json.Unmarshal(data, &store.entries); err != nil {
+		return nil, fmt.Errorf("增量爬取：解析状态文件出现异常: %s (path: %s)", err, path)
+	}
+	return store, nil
+}
+
+func (store *myFileStore) Get(url string) (Entry, bool) {
+	store.rwLock.RLock()
+	defer store.rwLock.RUnlock()
+	entry, ok := store.entries[url]
+	return entry, ok
+}
+
+func (store *myFileStore) Put(url string, entry Entry) error {
+	if url == "" {
+		return fmt.Errorf("增量爬取：空的URL")
+	}
+	store.rwLock.Lock()
+	defer store.rwLock.Unlock()
+	store.entries[url] = entry
+	store.dirty = true
+	return nil
+}
+
+func (store *myFileStore) Len() int {
+	store.rwLock.RLock()
+	defer store.rwLock.RUnlock()
+	return len(store.entries)
+}
+
+// 先写入临时文件再重命名，以免中途出错损坏原有的状态文件
+func (store *myFileStore) Save() error {
+	store.rwLock.Lock()
+	defer store.rwLock.Unlock()
+	if !store.dirty {
+		return nil
+	}
+	data, err := json.MarshalIndent(store.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("增量爬取：序列化状态出现异常: %s", err)
+	}
+	dir := filepath.Dir(store.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("增量爬取：创建目录出现异常: %s (path: %s)", err, dir)
+	}
+	tmpPath := store.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("增量爬取：写入状态文件出现异常: %s (path: %s)", err, tmpPath)
+	}
+	if err := os.Rename(tmpPath, store.path); err != nil {
+		return fmt.Errorf("增量爬取：替换状态文件出现异常: %s (path: %s)", err, store.path)
+	}
+	store.dirty = false
+	return nil
+}
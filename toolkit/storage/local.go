@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 代表基于本地文件系统的存储的实现类型
+type localStorage struct {
+	// 根目录
+	root string
+}
+
+// 用于创建一个基于本地文件系统的存储
+// 对象以文件的形式存放在根目录下，写入时先写临时文件再重命名
+// 名称以“.”开头的文件和目录不会被列出
+func NewLocal(root string) (Storage, error) {
+	if root == "" {
+		return nil, fmt.Errorf("存储：空的根目录")
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("存储：无效的根目录: %s (path: %s)", err, root)
+	}
+	if err := os.MkdirAll(absRoot, 0700); err != nil {
+		return nil, fmt.Errorf("存储：创建目录出现异常: %s (path: %s)", err, absRoot)
+	}
+	return &localStorage{root: absRoot}, nil
+}
+
+// 用于获取对象对应的文件路径
+func (ls *localStorage) path(key string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(ls.root, filepath.FromSlash(key)), nil
+}
+
+func (ls *localStorage) Put(key string, reader io.Reader) error {
+	path, err := ls.path(key)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("存储：创建目录出现异常: %s (path: %s)", err, dir)
+	}
+	file, err := ioutil.TempFile(dir, ".put-")
+	if err != nil {
+		return fmt.Errorf("存储：创建临时文件出现异常: %s (path: %s)", err, dir)
+	}
+	tmpPath := file.Name()
+	_, err = io.Copy(file, reader)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("存储：写入文件出现异常: %s (path: %s)", err, path)
+	}
+	return nil
+}
+
+func (ls *localStorage) Get(key string) (io.ReadCloser, error) {
+	path, err := ls.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("存储：打开文件出现异常: %s (path: %s)", err, path)
+	}
+	return file, nil
+}
+
+func (ls *localStorage) Exists(key string) (bool, error) {
+	path, err := ls.path(key)
+	if err != nil {
+		return false, err
+	}
+	fileInfo, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("存储：读取文件信息出现异常: %s (path: %s)", err, path)
+	}
+	return !fileInfo.IsDir(), nil
+}
+
+func (ls *localStorage) List(prefix string) ([]string, error) {
+	keys := []string{}
+	err := filepath.Walk(ls.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == ls.root {
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(ls.root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("存储：遍历目录出现异常: %s (path: %s)", err, ls.root)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 代表基于内存的存储的实现类型
+type memoryStorage struct {
+	// 键与对象内容的映射
+	objects map[string][]byte
+	// 保护对象映射的读写锁
+	rwLock sync.RWMutex
+}
+
+// 用于创建一个基于内存的存储
+func NewMemory() Storage {
+	return &memoryStorage{objects: map[string][]byte{}}
+}
+
+func (ms *memoryStorage) Put(key string, reader io.Reader) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("存储：读取数据出现异常: %s (key: %s)", err, key)
+	}
+	ms.rwLock.Lock()
+	defer ms.rwLock.Unlock()
+	ms.objects[key] = data
+	return nil
+}
+
+func (ms *memoryStorage) Get(key string) (io.ReadCloser, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	ms.rwLock.RLock()
+	defer ms.rwLock.RUnlock()
+	data, ok := ms.objects[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (ms *memoryStorage) Exists(key string) (bool, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return false, err
+	}
+	ms.rwLock.RLock()
+	defer ms.rwLock.RUnlock()
+	_, ok := ms.objects[key]
+	return ok, nil
+}
+
+func (ms *memoryStorage) List(prefix string) ([]string, error) {
+	ms.rwLock.RLock()
+	defer ms.rwLock.RUnlock()
+	keys := []string{}
+	for key := range ms.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
@@ -0,0 +1,383 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 空请求体的SHA-256摘要（十六进制）
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// 代表S3兼容的对象存储的配置
+// 密钥中的${VAR}会被替换为环境变量的值，
+// 访问密钥为空时会依次使用环境变量AWS_ACCESS_KEY_ID、AWS_SECRET_ACCESS_KEY和AWS_SESSION_TOKEN
+type S3Config struct {
+	// 服务地址，如https://s3.amazonaws.com或http://127.0.0.1:9000
+	Endpoint string `json:"endpoint"`
+	// 区域，为空时使用us-east-1
+	Region string `json:"region"`
+	// 存储桶的名称
+	Bucket string `json:"bucket"`
+	// 访问密钥ID
+	AccessKey string `json:"access_key"`
+	// 访问密钥
+	SecretKey string `json:"secret_key"`
+	// 临时凭证的会话令牌，可以为空
+	SessionToken string `json:"session_token"`
+	// 是否使用路径风格的URL（http://endpoint/bucket/key）
+	// 为false时使用虚拟主机风格的URL（http://bucket.endpoint/key），大多数自建的兼容服务需要设置为true
+	PathStyle bool `json:"path_style"`
+}
+
+// 代表S3兼容的对象存储的实现类型
+type s3Storage struct {
+	// 服务地址
+	endpoint *url.URL
+	// 区域
+	region string
+	// 存储桶的名称
+	bucket string
+	// 访问密钥ID
+	accessKey string
+	// 访问密钥
+	secretKey string
+	// 会话令牌
+	sessionToken string
+	// 是否使用路径风格的URL
+	pathStyle bool
+	// HTTP客户端
+	client *http.Client
+	// 用于获取当前时间，仅为便于替换
+	now func() time.Time
+}
+
+// 用于创建一个S3兼容的对象存储
+// 请求使用AWS签名版本4（SigV4）签名
+func NewS3(config S3Config) (Storage, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		return nil, fmt.Errorf("存储：无效的S3服务地址: %q", config.Endpoint)
+	}
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("存储：空的S3存储桶名称")
+	}
+	storage := &s3Storage{
+		endpoint:     endpoint,
+		region:       config.Region,
+		bucket:       config.Bucket,
+		accessKey:    os.ExpandEnv(config.AccessKey),
+		secretKey:    os.ExpandEnv(config.SecretKey),
+		sessionToken: os.ExpandEnv(config.SessionToken),
+		pathStyle:    config.PathStyle,
+		client:       &http.Client{Timeout: 5 * time.Minute},
+		now:          time.Now,
+	}
+	if storage.region == "" {
+		storage.region = "us-east-1"
+	}
+	if storage.accessKey == "" {
+		storage.accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		storage.secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		storage.sessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if storage.accessKey == "" || storage.secretKey == "" {
+		return nil, fmt.Errorf("存储：缺少S3访问密钥")
+	}
+	return storage, nil
+}
+
+// 用于生成对象的URL，参数key为空时生成存储桶的URL
+func (s3 *s3Storage) objectURL(key string) *url.URL {
+	u := *s3.endpoint
+	basePath := strings.TrimSuffix(u.Path, "/")
+	if s3.pathStyle {
+		basePath += "/" + s3.bucket
+	} else {
+		u.Host = s3.bucket + "." + u.Host
+	}
+	u.Path = basePath + "/" + key
+	u.RawPath = uriEncode(basePath, false) + "/" + uriEncode(key, false)
+	u.RawQuery = ""
+	return &u
+}
+
+// 用于发送签名后的请求
+// 参数body不为nil时必须给出其长度和SHA-256摘要（十六进制）
+func (s3 *s3Storage) do(method string, u *url.URL, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+	httpReq, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.URL = u
+	if body != nil {
+		httpReq.ContentLength = size
+	}
+	if payloadHash == "" {
+		payloadHash = emptyPayloadHash
+	}
+	s3.sign(httpReq, payloadHash, s3.now())
+	return s3.client.Do(httpReq)
+}
+
+// 用于按AWS签名版本4为请求签名
+func (s3 *s3Storage) sign(httpReq *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	httpReq.Header.Set("X-Amz-Date", amzDate)
+	httpReq.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s3.sessionToken != "" {
+		httpReq.Header.Set("X-Amz-Security-Token", s3.sessionToken)
+	}
+	// 被签名的请求头
+	headers := map[string]string{"host": httpReq.URL.Host}
+	for key, values := range httpReq.Header {
+		lower := strings.ToLower(key)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" ||
+			lower == "content-md5" || lower == "range" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonicalURI := httpReq.URL.EscapedPath()
+	if canonicalURI == "" {
+		canonicalURI = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		httpReq.Method,
+		canonicalURI,
+		canonicalQuery(httpReq.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + s3.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+	key := hmacSHA256([]byte("AWS4"+s3.secretKey), date)
+	key = hmacSHA256(key, s3.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	httpReq.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3.accessKey, scope, signedHeaders, signature))
+}
+
+// 用于计算HMAC-SHA256
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// 用于生成规范化的查询字符串
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// 用于按SigV4的规则编码URI，除未保留字符外的所有字节都会被编码
+// 参数encodeSlash为false时“/”不会被编码
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9'),
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// 用于准备请求体，结果值依次为请求体、长度和SHA-256摘要（十六进制）
+// 可定位的读取器（如文件）会被读取两遍而不会被整体载入内存
+func prepareBody(reader io.Reader) (io.Reader, int64, string, error) {
+	if seeker, ok := reader.(io.ReadSeeker); ok {
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err == nil {
+			h := sha256.New()
+			size, err := io.Copy(h, seeker)
+			if err != nil {
+				return nil, 0, "", err
+			}
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return nil, 0, "", err
+			}
+			return ioutil.NopCloser(seeker), size, hex.EncodeToString(h.Sum(nil)), nil
+		}
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	sum := sha256.Sum256(data)
+	return bytes.NewReader(data), int64(len(data)), hex.EncodeToString(sum[:]), nil
+}
+
+// 代表S3返回的错误
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// 用于根据非成功的响应生成错误值
+func responseError(op string, key string, httpResp *http.Response) error {
+	data, _ := ioutil.ReadAll(io.LimitReader(httpResp.Body, 4096))
+	var s3Err s3Error
+	if xml.Unmarshal(data, &s3Err) == nil && s3Err.Code != "" {
+		return fmt.Errorf("存储：S3%s失败: 状态码 %d, %s: %s (key: %s)",
+			op, httpResp.StatusCode, s3Err.Code, s3Err.Message, key)
+	}
+	return fmt.Errorf("存储：S3%s失败: 状态码 %d (key: %s)", op, httpResp.StatusCode, key)
+}
+
+func (s3 *s3Storage) Put(key string, reader io.Reader) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	body, size, payloadHash, err := prepareBody(reader)
+	if err != nil {
+		return fmt.Errorf("存储：读取数据出现异常: %s (key: %s)", err, key)
+	}
+	httpResp, err := s3.do(http.MethodPut, s3.objectURL(key), body, size, payloadHash)
+	if err != nil {
+		return fmt.Errorf("存储：S3写入出现异常: %s (key: %s)", err, key)
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return responseError("写入", key, httpResp)
+	}
+	return nil
+}
+
+func (s3 *s3Storage) Get(key string) (io.ReadCloser, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	httpResp, err := s3.do(http.MethodGet, s3.objectURL(key), nil, 0, "")
+	if err != nil {
+		return nil, fmt.Errorf("存储：S3读取出现异常: %s (key: %s)", err, key)
+	}
+	switch httpResp.StatusCode {
+	case http.StatusOK:
+		return httpResp.Body, nil
+	case http.StatusNotFound:
+		httpResp.Body.Close()
+		return nil, ErrNotFound
+	default:
+		defer httpResp.Body.Close()
+		return nil, responseError("读取", key, httpResp)
+	}
+}
+
+func (s3 *s3Storage) Exists(key string) (bool, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return false, err
+	}
+	httpResp, err := s3.do(http.MethodHead, s3.objectURL(key), nil, 0, "")
+	if err != nil {
+		return false, fmt.Errorf("存储：S3查询出现异常: %s (key: %s)", err, key)
+	}
+	httpResp.Body.Close()
+	switch httpResp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("存储：S3查询失败: 状态码 %d (key: %s)", httpResp.StatusCode, key)
+	}
+}
+
+// 代表ListObjectsV2的响应
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s3 *s3Storage) List(prefix string) ([]string, error) {
+	keys := []string{}
+	token := ""
+	for {
+		u := s3.objectURL("")
+		query := url.Values{}
+		query.Set("list-type", "2")
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		u.RawQuery = canonicalQuery(query)
+		httpResp, err := s3.do(http.MethodGet, u, nil, 0, "")
+		if err != nil {
+			return nil, fmt.Errorf("存储：S3列举出现异常: %s (prefix: %s)", err, prefix)
+		}
+		if httpResp.StatusCode != http.StatusOK {
+			err := responseError("列举", prefix, httpResp)
+			httpResp.Body.Close()
+			return nil, err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(httpResp.Body).Decode(&result)
+		httpResp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("存储：解析S3列举结果出现异常: %s (prefix: %s)", err, prefix)
+		}
+		for _, content := range result.Contents {
+			keys = append(keys, content.Key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
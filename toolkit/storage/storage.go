@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// 当前支持的存储类型的常量
+const (
+	// 本地文件系统
+	TYPE_LOCAL = "local"
+	// 内存，进程退出后数据即丢失，适用于测试
+	TYPE_MEMORY = "memory"
+	// S3兼容的对象存储
+	TYPE_S3 = "s3"
+)
+
+// 代表对象不存在的错误
+var ErrNotFound = errors.New("存储：对象不存在")
+
+// 存储后端的接口类型
+// 对象以键标识，键是以“/”分隔的相对路径，不能以“/”开头，也不能包含“..”
+// 该接口的实现类型必须是并发安全的
+type Storage interface {
+	// 用于写入对象，已存在的对象会被覆盖
+	// 对象要么被完整写入，要么保持原样
+	Put(key string, reader io.Reader) error
+	// 用于读取对象，对象不存在时返回ErrNotFound
+	// 调用方负责关闭返回的读取器
+	Get(key string) (io.ReadCloser, error)
+	// 用于判断对象是否存在
+	Exists(key string) (bool, error)
+	// 用于按字典序列出以给定前缀开头的所有对象的键
+	List(prefix string) ([]string, error)
+}
+
+// 用于检查并规范化对象的键
+func cleanKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("存储：无效的键: %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("存储：无效的键: %q", key)
+		}
+	}
+	cleaned := path.Clean(key)
+	if cleaned == "." {
+		return "", fmt.Errorf("存储：无效的键: %q", key)
+	}
+	return cleaned, nil
+}
+
+// 代表给所有键加上前缀的存储的实现类型
+type prefixStorage struct {
+	// 底层的存储
+	storage Storage
+	// 键的前缀，以“/”结尾
+	prefix string
+}
+
+// 用于生成一个把所有键都放在给定目录下的存储
+// 参数dir为空时直接返回原存储
+func Sub(storage Storage, dir string) Storage {
+	dir = strings.Trim(dir, "/")
+	if dir == "" {
+		return storage
+	}
+	return &prefixStorage{storage: storage, prefix: dir + "/"}
+}
+
+// 用于检查键并加上前缀
+// 键需要在加上前缀之前检查，否则形如“/a”的无效键会被规范化为有效的键
+func (ps *prefixStorage) key(key string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return ps.prefix + key, nil
+}
+
+func (ps *prefixStorage) Put(key string, reader io.Reader) error {
+	key, err := ps.key(key)
+	if err != nil {
+		return err
+	}
+	return ps.storage.Put(key, reader)
+}
+
+func (ps *prefixStorage) Get(key string) (io.ReadCloser, error) {
+	key, err := ps.key(key)
+	if err != nil {
+		return nil, err
+	}
+	return ps.storage.Get(key)
+}
+
+func (ps *prefixStorage) Exists(key string) (bool, error) {
+	key, err := ps.key(key)
+	if err != nil {
+		return false, err
+	}
+	return ps.storage.Exists(key)
+}
+
+func (ps *prefixStorage) List(prefix string) ([]string, error) {
+	keys, err := ps.storage.List(ps.prefix + prefix)
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, ps.prefix)
+	}
+	return keys, nil
+}
+
+// 代表存储配置的类型
+type Config struct {
+	// 存储类型，可选值为local、memory和s3，为空时使用local
+	Type string `json:"type"`
+	// 本地文件系统的根目录，用于local
+	Root string `json:"root"`
+	// S3兼容的对象存储的配置，用于s3
+	S3 S3Config `json:"s3"`
+}
+
+// 用于从JSON文件中加载存储配置
+func LoadConfig(path string) (Config, error) {
+	var config Config
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("存储：读取配置文件出现异常: %s (path: %s)", err, path)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("存储：解析配置文件出现异常: %s (path: %s)", err, path)
+	}
+	return config, nil
+}
+
+// 用于根据配置创建存储
+func New(config Config) (Storage, error) {
+	switch config.Type {
+	case "", TYPE_LOCAL:
+		return NewLocal(config.Root)
+	case TYPE_MEMORY:
+		return NewMemory(), nil
+	case TYPE_S3:
+		return NewS3(config.S3)
+	default:
+		return nil, fmt.Errorf("存储：不支持的存储类型: %q", config.Type)
+	}
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 用于检查存储后端的基本行为，所有实现都应通过该检查
+func testStorage(t *testing.T, storage Storage) {
+	objects := map[string]string{
+		"a.txt":         "a",
+		"dir/b.txt":     "b",
+		"dir/sub/c.txt": "c",
+		"other/d e.txt": "d",
+	}
+	for key, content := range objects {
+		if err := storage.Put(key, strings.NewReader(content)); err != nil {
+			t.Fatalf("An error occurs when putting %q: %s", key, err)
+		}
+	}
+	// 已存在的对象会被覆盖
+	if err := storage.Put("a.txt", strings.NewReader("aa")); err != nil {
+		t.Fatalf("An error occurs when overwriting %q: %s", "a.txt", err)
+	}
+	objects["a.txt"] = "aa"
+	for key, expected := range objects {
+		reader, err := storage.Get(key)
+		if err != nil {
+			t.Fatalf("An error occurs when getting %q: %s", key, err)
+		}
+		data, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("An error occurs when reading %q: %s", key, err)
+		}
+		if string(data) != expected {
+			t.Fatalf("Inconsistent content of %q: expected: %q, actual: %q", key, expected, data)
+		}
+		exists, err := storage.Exists(key)
+		if err != nil {
+			t.Fatalf("An error occurs when checking %q: %s", key, err)
+		}
+		if !exists {
+			t.Fatalf("Inconsistent existence of %q: expected: true, actual: false", key)
+		}
+	}
+	if _, err := storage.Get("missing.txt"); err != ErrNotFound {
+		t.Fatalf("Inconsistent error for a missing object: expected: %v, actual: %v", ErrNotFound, err)
+	}
+	exists, err := storage.Exists("missing.txt")
+	if err != nil {
+		t.Fatalf("An error occurs when checking a missing object: %s", err)
+	}
+	if exists {
+		t.Fatalf("Inconsistent existence of a missing object: expected: false, actual: true")
+	}
+	for _, key := range []string{"", "/abs", "../up", "a/../../up", "a\\b"} {
+		if err := storage.Put(key, strings.NewReader("x")); err == nil {
+			t.Fatalf("No error when putting an invalid key %q!", key)
+		}
+	}
+	lists := map[string][]string{
+		"":     {"a.txt", "dir/b.txt", "dir/sub/c.txt", "other/d e.txt"},
+		"dir/": {"dir/b.txt", "dir/sub/c.txt"},
+		"none": {},
+	}
+	for prefix, expected := range lists {
+		keys, err := storage.List(prefix)
+		if err != nil {
+			t.Fatalf("An error occurs when listing %q: %s", prefix, err)
+		}
+		if !reflect.DeepEqual(keys, expected) {
+			t.Fatalf("Inconsistent keys with prefix %q: expected: %v, actual: %v", prefix, expected, keys)
+		}
+	}
+}
+
+func TestLocal(t *testing.T) {
+	storage, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatalf("An error occurs when creating a local storage: %s", err)
+	}
+	testStorage(t, storage)
+}
+
+func TestMemory(t *testing.T) {
+	testStorage(t, NewMemory())
+}
+
+func TestSub(t *testing.T) {
+	base := NewMemory()
+	testStorage(t, Sub(base, "prefix"))
+	keys, err := base.List("")
+	if err != nil {
+		t.Fatalf("An error occurs when listing the base storage: %s", err)
+	}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "prefix/") {
+			t.Fatalf("Inconsistent key in the base storage: expected prefix: %q, actual: %q", "prefix/", key)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package warc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// WARC读取器的接口类型
+type Reader interface {
+	// 用于读取下一条记录
+	// 读完所有记录后会返回io.EOF
+	Next() (*Record, error)
+}
+
+// 代表WARC读取器的实现类型
+type myReader struct {
+	// 代表带缓冲的底层读取器
+	reader *bufio.Reader
+}
+
+// 用于创建一个WARC读取器
+func NewReader(reader io.Reader) Reader {
+	return &myReader{reader: bufio.NewReader(reader)}
+}
+
+func (r *myReader) Next() (*Record, error) {
+	// 跳过记录之间的空行
+	var line string
+	for {
+		l, err := r.reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && strings.TrimSpace(l) == "" {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("WARC：读取版本行出现异常: %s", err)
+		}
+		line = strings.TrimRight(l, "\r\n")
+		if line != "" {
+			break
+		}
+	}
+	if !strings.HasPrefix(line, "WARC/") {
+		return nil, fmt.Errorf("WARC：非法的版本行: %q", line)
+	}
+	var header Header
+	for {
+		l, err := r.reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("WARC：读取记录头部出现异常: %s", err)
+		}
+		l = strings.TrimRight(l, "\r\n")
+		if l == "" {
+			break
+		}
+		index := strings.Index(l, ":")
+		if index <= 0 {
+			return nil, fmt.Errorf("WARC：非法的头部字段: %q", l)
+		}
+		header = append(header, Field{
+			Name:  strings.TrimSpace(l[:index]),
+			Value: strings.TrimSpace(l[index+1:]),
+		})
+	}
+	length, err := strconv.ParseInt(header.Get(HEADER_CONTENT_LENGTH), 10, 64)
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("WARC：非法的内容长度: %q", header.Get(HEADER_CONTENT_LENGTH))
+	}
+	block := make([]byte, length)
+	if _, err := io.ReadFull(r.reader, block); err != nil {
+		return nil, fmt.Errorf("WARC：读取记录块出现异常: %s", err)
+	}
+	return &Record{Header: header, Block: block}, nil
+}
+
+// 用于依次读取给定WARC文件中的所有记录
+// 参数handle返回非nil的错误值时会中止读取并返回该错误值
+func ReadFile(path string, handle func(record *Record) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("WARC：打开文件出现异常: %s (path: %s)", err, path)
+	}
+	defer file.Close()
+	reader := NewReader(file)
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s (path: %s)", err, path)
+		}
+		if err := handle(record); err != nil {
+			return err
+		}
+	}
+}
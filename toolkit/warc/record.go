@@ -0,0 +1,262 @@
+package warc
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 代表WARC版本行
+const warcVersion = "WARC/1.1"
+
+// 代表WARC记录的类型
+type RecordType string
+
+// 当前支持的WARC记录类型的常量
+const (
+	RECORD_TYPE_WARCINFO RecordType = "warcinfo"
+	RECORD_TYPE_REQUEST  RecordType = "request"
+	RECORD_TYPE_RESPONSE RecordType = "response"
+)
+
+// 代表WARC记录中常用的头部名称
+const (
+	HEADER_TYPE           = "WARC-Type"
+	HEADER_RECORD_ID      = "WARC-Record-ID"
+	HEADER_DATE           = "WARC-Date"
+	HEADER_TARGET_URI     = "WARC-Target-URI"
+	HEADER_CONCURRENT_TO  = "WARC-Concurrent-To"
+	HEADER_FILENAME       = "WARC-Filename"
+	HEADER_BLOCK_DIGEST   = "WARC-Block-Digest"
+	HEADER_PAYLOAD_DIGEST = "WARC-Payload-Digest"
+	HEADER_CONTENT_TYPE   = "Content-Type"
+	HEADER_CONTENT_LENGTH = "Content-Length"
+)
+
+// 代表WARC记录头部的一个字段
+type Field struct {
+	Name  string
+	Value string
+}
+
+// 代表WARC记录的头部
+// 与http.Header不同，它会保留字段名称的原样大小写和书写顺序
+type Header []Field
+
+// 用于获取给定名称的字段值，名称不区分大小写
+func (header Header) Get(name string) string {
+	for _, field := range header {
+		if strings.EqualFold(field.Name, name) {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// 用于设置给定名称的字段值，已存在的同名字段会被替换
+func (header *Header) Set(name string, value string) {
+	for i, field := range *header {
+		if strings.EqualFold(field.Name, name) {
+			(*header)[i].Value = value
+			return
+		}
+	}
+	*header = append(*header, Field{Name: name, Value: value})
+}
+
+// 代表可以多次从头读取的内容
+// toolkit/reader中的多重读取器实现了该接口
+type Body interface {
+	// 用于获取一个从头读取内容的读取器
+	Reader() io.ReadCloser
+	// 用于获取内容的长度（字节）
+	Size() int64
+}
+
+// 代表一条WARC记录
+type Record struct {
+	// 记录头部
+	Header Header
+	// 记录块的内容
+	Block []byte
+	// 记录块中跟在Block之后的内容，可以为nil
+	// 写入时会以流的方式从中读取，读取器读出的记录总把整个记录块放在Block中
+	Payload Body
+}
+
+// 用于获取记录的类型
+func (record *Record) Type() RecordType {
+	return RecordType(record.Header.Get(HEADER_TYPE))
+}
+
+// 用于获取记录的目标URI
+func (record *Record) TargetURI() string {
+	return record.Header.Get(HEADER_TARGET_URI)
+}
+
+// 用于获取记录块的长度
+func (record *Record) blockSize() int64 {
+	size := int64(len(record.Block))
+	if record.Payload != nil {
+		size += record.Payload.Size()
+	}
+	return size
+}
+
+// 用于把记录按WARC格式写入给定的写入器
+// Content-Length总是根据记录块的实际长度生成
+func (record *Record) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	buf.WriteString(warcVersion + "\r\n")
+	for _, field := range record.Header {
+		if strings.EqualFold(field.Name, HEADER_CONTENT_LENGTH) {
+			continue
+		}
+		fmt.Fprintf(&buf, "%s: %s\r\n", field.Name, field.Value)
+	}
+	fmt.Fprintf(&buf, "%s: %d\r\n\r\n", HEADER_CONTENT_LENGTH, record.blockSize())
+	buf.Write(record.Block)
+	n, err := w.Write(buf.Bytes())
+	total := int64(n)
+	if err != nil {
+		return total, err
+	}
+	if record.Payload != nil {
+		reader := record.Payload.Reader()
+		copied, err := io.Copy(w, reader)
+		reader.Close()
+		total += copied
+		if err != nil {
+			return total, err
+		}
+		if copied != record.Payload.Size() {
+			return total, fmt.Errorf("WARC：记录块的长度不符 (预期: %d, 实际: %d)",
+				record.Payload.Size(), copied)
+		}
+	}
+	n, err = io.WriteString(w, "\r\n\r\n")
+	return total + int64(n), err
+}
+
+// 用于生成新的记录ID
+func newRecordID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// 随机数源不可用时退化为基于时间的ID
+		return fmt.Sprintf("<urn:uuid:%032x>", time.Now().UnixNano())
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// 用于计算WARC规范中常用的SHA-1摘要（Base32编码）
+func digest(data []byte) string {
+	sum := sha1.Sum(data)
+	return encodeDigest(sum[:])
+}
+
+// 用于按WARC规范编码摘要
+func encodeDigest(sum []byte) string {
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum)
+}
+
+// 用于格式化WARC-Date
+func formatDate(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// 用于生成warcinfo记录
+func newWarcinfoRecord(filename string, software string) *Record {
+	var fields bytes.Buffer
+	fields.WriteString("software: " + software + "\r\n")
+	fields.WriteString("format: WARC File Format 1.1\r\n")
+	fields.WriteString("conformsTo: http://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/\r\n")
+	var header Header
+	header.Set(HEADER_TYPE, string(RECORD_TYPE_WARCINFO))
+	header.Set(HEADER_RECORD_ID, newRecordID())
+	header.Set(HEADER_DATE, formatDate(time.Now()))
+	header.Set(HEADER_FILENAME, filename)
+	header.Set(HEADER_CONTENT_TYPE, "application/warc-fields")
+	return &Record{Header: header, Block: fields.Bytes()}
+}
+
+// 用于根据HTTP请求生成request记录
+// 参数body代表请求体，可以为nil
+func NewRequestRecord(httpReq *http.Request, body []byte, date time.Time) *Record {
+	var block bytes.Buffer
+	fmt.Fprintf(&block, "%s %s HTTP/1.1\r\n", requestMethod(httpReq), httpReq.URL.RequestURI())
+	host := httpReq.Host
+	if host == "" {
+		host = httpReq.URL.Host
+	}
+	fmt.Fprintf(&block, "Host: %s\r\n", host)
+	httpReq.Header.Write(&block)
+	block.WriteString("\r\n")
+	block.Write(body)
+	var header Header
+	header.Set(HEADER_TYPE, string(RECORD_TYPE_REQUEST))
+	header.Set(HEADER_RECORD_ID, newRecordID())
+	header.Set(HEADER_DATE, formatDate(date))
+	header.Set(HEADER_TARGET_URI, httpReq.URL.String())
+	header.Set(HEADER_CONTENT_TYPE, "application/http;msgtype=request")
+	header.Set(HEADER_BLOCK_DIGEST, digest(block.Bytes()))
+	return &Record{Header: header, Block: block.Bytes()}
+}
+
+// 用于根据HTTP响应生成response记录
+// 参数body代表响应体，可以为nil，响应体只在计算摘要和写入时被读取
+func NewResponseRecord(httpResp *http.Response, body Body, date time.Time) (*Record, error) {
+	var block bytes.Buffer
+	major, minor := httpResp.ProtoMajor, httpResp.ProtoMinor
+	if major == 0 {
+		major, minor = 1, 1
+	}
+	statusText := http.StatusText(httpResp.StatusCode)
+	fmt.Fprintf(&block, "HTTP/%d.%d %d %s\r\n", major, minor, httpResp.StatusCode, statusText)
+	httpResp.Header.Write(&block)
+	block.WriteString("\r\n")
+	blockHash := sha1.New()
+	payloadHash := sha1.New()
+	blockHash.Write(block.Bytes())
+	if body != nil {
+		if err := hashBody(body, io.MultiWriter(blockHash, payloadHash)); err != nil {
+			return nil, err
+		}
+	}
+	var header Header
+	header.Set(HEADER_TYPE, string(RECORD_TYPE_RESPONSE))
+	header.Set(HEADER_RECORD_ID, newRecordID())
+	header.Set(HEADER_DATE, formatDate(date))
+	if httpResp.Request != nil && httpResp.Request.URL != nil {
+		header.Set(HEADER_TARGET_URI, httpResp.Request.URL.String())
+	}
+	header.Set(HEADER_CONTENT_TYPE, "application/http;msgtype=response")
+	header.Set(HEADER_BLOCK_DIGEST, encodeDigest(blockHash.Sum(nil)))
+	header.Set(HEADER_PAYLOAD_DIGEST, encodeDigest(payloadHash.Sum(nil)))
+	return &Record{Header: header, Block: block.Bytes(), Payload: body}, nil
+}
+
+// 用于把内容写入摘要计算器
+func hashBody(body Body, w io.Writer) error {
+	reader := body.Reader()
+	defer reader.Close()
+	if _, err := io.Copy(w, reader); err != nil {
+		return fmt.Errorf("WARC：读取响应体出现异常: %s", err)
+	}
+	return nil
+}
+
+// 用于获取请求方法，空方法视为GET
+func requestMethod(httpReq *http.Request) string {
+	if httpReq.Method == "" {
+		return http.MethodGet
+	}
+	return httpReq.Method
+}
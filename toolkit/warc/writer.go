@@ -0,0 +1,162 @@
+package warc
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 默认的单个WARC文件的最大字节数
+const DEFAULT_MAX_FILE_SIZE int64 = 1 << 30
+
+// 写入warcinfo记录时使用的软件名称
+const softwareName = "WebCrawler"
+
+// WARC写入器的接口类型
+// 该接口的实现类型必须是并发安全的
+type Writer interface {
+	// 用于写入一对请求-响应记录
+	// 参数reqBody代表已完整读出的请求体，respBody代表响应体，可以为nil
+	WriteExchange(httpReq *http.Request, reqBody []byte,
+		httpResp *http.Response, respBody Body) error
+	// 用于获取已写入的记录数量（不含warcinfo记录）
+	RecordCount() uint64
+	// 用于关闭当前正在写入的文件
+	Close() error
+}
+
+// 代表按大小轮转的WARC写入器的实现类型
+type myWriter struct {
+	// 代表WARC文件所在的目录
+	dir string
+	// 代表WARC文件名的前缀
+	prefix string
+	// 代表单个文件的最大字节数
+	maxFileSize int64
+	// 代表当前正在写入的文件
+	file *os.File
+	// 代表当前文件已写入的字节数
+	fileSize int64
+	// 代表已创建的文件的序号
+	serial uint32
+	// 代表已写入的记录数量
+	recordCount uint64
+	// 代表保护内部共享资源的互斥锁
+	lock sync.Mutex
+}
+
+// 用于创建一个WARC写入器
+// 参数maxFileSize为0时使用默认值
+// 写入的文件名形如 prefix-20060102150405-00001.warc
+func NewWriter(dir string, prefix string, maxFileSize int64) (Writer, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("WARC：空的目录路径")
+	}
+	if prefix == "" {
+		prefix = "crawl"
+	}
+	if maxFileSize <= 0 {
+		maxFileSize = DEFAULT_MAX_FILE_SIZE
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("WARC：创建目录出现异常: %s (path: %s)", err, dir)
+	}
+	return &myWriter{
+		dir:         dir,
+		prefix:      prefix,
+		maxFileSize: maxFileSize,
+	}, nil
+}
+
+func (writer *myWriter) WriteExchange(httpReq *http.Request, reqBody []byte,
+	httpResp *http.Response, respBody Body) error {
+	if httpReq == nil || httpReq.URL == nil || httpResp == nil {
+		return fmt.Errorf("WARC：无效的请求或响应")
+	}
+	now := time.Now()
+	reqRecord := NewRequestRecord(httpReq, reqBody, now)
+	respRecord, err := NewResponseRecord(httpResp, respBody, now)
+	if err != nil {
+		return err
+	}
+	respID := respRecord.Header.Get(HEADER_RECORD_ID)
+	reqRecord.Header.Set(HEADER_CONCURRENT_TO, respID)
+	// 响应记录的目标URI以请求为准，避免响应未携带请求时缺失
+	respRecord.Header.Set(HEADER_TARGET_URI, httpReq.URL.String())
+
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+	size := reqRecord.blockSize() + respRecord.blockSize()
+	if err := writer.prepareFile(size); err != nil {
+		return err
+	}
+	for _, record := range []*Record{reqRecord, respRecord} {
+		n, err := record.WriteTo(writer.file)
+		writer.fileSize += n
+		if err != nil {
+			return fmt.Errorf("WARC：写入记录出现异常: %s (file: %s)", err, writer.file.Name())
+		}
+		writer.recordCount++
+	}
+	return nil
+}
+
+func (writer *myWriter) RecordCount() uint64 {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+	return writer.recordCount
+}
+
+func (writer *myWriter) Close() error {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+	return writer.closeFile()
+}
+
+// 用于确保有可写入给定字节数的文件
+// 当前文件写入后会超出大小上限时，就轮转到新文件
+// 单条记录本身超过上限时仍会写入一个新文件中
+func (writer *myWriter) prepareFile(size int64) error {
+	if writer.file != nil && writer.fileSize > 0 &&
+		writer.fileSize+size > writer.maxFileSize {
+		if err := writer.closeFile(); err != nil {
+			return err
+		}
+	}
+	if writer.file != nil {
+		return nil
+	}
+	writer.serial++
+	filename := fmt.Sprintf("%s-%s-%05d.warc",
+		writer.prefix, time.Now().Format("20060102150405"), writer.serial)
+	path := filepath.Join(writer.dir, filename)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("WARC：创建文件出现异常: %s (path: %s)", err, path)
+	}
+	writer.file = file
+	writer.fileSize = 0
+	n, err := newWarcinfoRecord(filename, softwareName).WriteTo(file)
+	writer.fileSize += n
+	if err != nil {
+		return fmt.Errorf("WARC：写入warcinfo记录出现异常: %s (path: %s)", err, path)
+	}
+	return nil
+}
+
+// 用于关闭当前文件
+func (writer *myWriter) closeFile() error {
+	if writer.file == nil {
+		return nil
+	}
+	err := writer.file.Close()
+	writer.file = nil
+	writer.fileSize = 0
+	if err != nil {
+		return fmt.Errorf("WARC：关闭文件出现异常: %s", err)
+	}
+	return nil
+}